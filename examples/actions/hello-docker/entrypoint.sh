@@ -0,0 +1,10 @@
+#!/bin/sh
+set -e
+
+MESSAGE="Hello, $1!"
+echo "🐳 $MESSAGE"
+echo "Input from environment: $INPUT_NAME"
+echo "Working directory: $(pwd)"
+ls -la
+
+echo "message=$MESSAGE" >> "$GITHUB_OUTPUT"
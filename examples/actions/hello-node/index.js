@@ -0,0 +1,12 @@
+// Reads its input and writes its output the way @actions/core does, without needing node_modules
+const fs = require('fs');
+
+const name = process.env.INPUT_NAME || 'World';
+const message = `Hello, ${name}!`;
+
+console.log(`🟢 ${message}`);
+console.log(`Running in a container: ${fs.existsSync('/.dockerenv')}`);
+console.log(`NODE_OPTIONS: ${process.env.NODE_OPTIONS}`);
+
+fs.appendFileSync(process.env.GITHUB_OUTPUT, `message=${message}\n`);
+fs.appendFileSync(process.env.GITHUB_OUTPUT, `source=${process.env.HELLO_SOURCE}\n`);
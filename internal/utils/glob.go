@@ -0,0 +1,155 @@
+// Package utils holds helpers shared across Vermont, such as matching the glob patterns
+// used by workflows and the config: hashFiles arguments, path filters and artifact paths.
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether path matches the pattern. Besides the syntax of
+// path.Match ('*', '?' and character classes, none of which cross a '/'), a
+// path segment of "**" matches zero or more whole segments and {a,b} matches
+// either alternative. Backslashes in path are treated as separators so
+// Windows paths can be matched against the same patterns.
+func MatchGlob(pattern, path string) (bool, error) {
+	path = strings.ReplaceAll(path, `\`, "/")
+
+	alternatives, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	for _, alternative := range alternatives {
+		matched, err := matchSegments(strings.Split(alternative, "/"), strings.Split(path, "/"))
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidateGlob reports whether the pattern is well-formed, even in the parts a
+// particular path would never reach while matching.
+func ValidateGlob(pattern string) error {
+	alternatives, err := expandBraces(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, alternative := range alternatives {
+		for _, segment := range strings.Split(alternative, "/") {
+			if segment == "**" {
+				continue
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchSegments matches the path segments against the pattern segments
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		segment := pattern[0]
+
+		if segment == "**" {
+			// Collapse repeated ** and try every possible number of skipped segments
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchSegments(pattern[1:], name[i:])
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(segment, name[0])
+		if err != nil || !matched {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
+
+// expandBraces expands every {a,b} group in the pattern into the list of patterns it stands for
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			var expanded []string
+			for _, option := range splitOptions(pattern[start+1 : i]) {
+				// The option and the suffix may contain further groups
+				rest, err := expandBraces(option + suffix)
+				if err != nil {
+					return nil, err
+				}
+				for _, r := range rest {
+					expanded = append(expanded, prefix+r)
+				}
+			}
+			return expanded, nil
+		}
+	}
+	if depth > 0 {
+		return nil, path.ErrBadPattern
+	}
+
+	return []string{pattern}, nil
+}
+
+// splitOptions splits the inside of a brace group on the commas that aren't nested in another group
+func splitOptions(group string) []string {
+	var options []string
+	depth, last := 0, 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				options = append(options, group[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(options, group[last:])
+}
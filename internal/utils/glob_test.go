@@ -0,0 +1,76 @@
+package utils
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// * and ? stay within one segment
+		{"*.go", "main.go", true},
+		{"*.go", "pkg/main.go", false},
+		{"pkg/*", "pkg/glob", true},
+		{"pkg/*", "pkg/glob/glob.go", false},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"file?.txt", "file/.txt", false},
+		{"[a-c].txt", "b.txt", true},
+
+		// ** matches zero or more whole segments
+		{"**/go.sum", "go.sum", true},
+		{"**/go.sum", "a/b/go.sum", true},
+		{"**", "a/b/c", true},
+		{"src/**", "src", true},
+		{"src/**/*.ts", "src/index.ts", true},
+		{"src/**/*.ts", "src/a/b/index.ts", true},
+		{"src/**/*.ts", "lib/index.ts", false},
+		{"a/**/**/b", "a/b", true},
+		{"**/test", "a/contest", false},
+
+		// Braces pick one of the alternatives, and may nest
+		{"*.{go,mod}", "go.mod", true},
+		{"*.{go,mod}", "go.sum", false},
+		{"{cmd,pkg}/**/*.go", "pkg/glob/glob.go", true},
+		{"{a,b{c,d}}.txt", "bd.txt", true},
+		{"{a,b{c,d}}.txt", "b.txt", false},
+		{"file.{,bak}", "file.", true},
+
+		// Backslashes are separators in names
+		{"src/*.go", `src\main.go`, true},
+
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		got, err := MatchGlob(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("MatchGlob(%q, %q) error = %v", tt.pattern, tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"**/*.go", true},
+		{"{a,b}/[0-9]*", true},
+		{"[a-", false},
+		{"{a,b", false},
+		{"a}", false},
+		{"x/{y,[}", false},
+	}
+	for _, tt := range tests {
+		err := ValidateGlob(tt.pattern)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateGlob(%q) error = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
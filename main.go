@@ -1,1441 +1,8133 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"math/rand"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"vermont/internal/utils"
+	"vermont/pkg/cron"
+	"vermont/pkg/envfile"
+	"vermont/pkg/expression"
+	"vermont/pkg/reporting"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Env map[string]string `json:"env"`
+	Env          map[string]string `json:"env"`
+	Secrets      map[string]string `json:"secrets,omitempty"`
+	Vars         map[string]string `json:"vars,omitempty"`
+	Environments map[string]EnvDef `json:"environments,omitempty"`
+	Container    ContainerConfig   `json:"container,omitempty"`
+	Runner       RunnerConfig      `json:"runner,omitempty"`
+	Storage      StorageConfig     `json:"storage,omitempty"`
+
+	// SecretsCommand is run with a secret's name appended to fetch secrets the config doesn't
+	// define; its standard output is the value
+	SecretsCommand []string `json:"secretsCommand,omitempty"`
+
+	// JobPaths maps job names to path filters; with --since-ref a job only runs when a changed
+	// file matches its filter. Patterns starting with ! exclude files again.
+	JobPaths map[string][]string `json:"jobPaths,omitempty"`
+}
+
+// StorageConfig controls where Vermont keeps files between runs
+type StorageConfig struct {
+	// ActionsCacheDir keeps cloned remote actions across runs; empty clones them per job
+	ActionsCacheDir string `json:"actionsCacheDir,omitempty"`
+}
+
+// RunnerConfig represents limits applied to step execution
+type RunnerConfig struct {
+	// MaxOutputBytes caps the output of a step Vermont keeps in memory, for a single line as
+	// well as for the output held or captured for reports
+	MaxOutputBytes int `json:"maxOutputBytes,omitempty"`
+	// BashOptions are passed to bash for run steps without an explicit custom shell
+	BashOptions string `json:"bashOptions,omitempty"`
+	// DefaultJobTimeout and DefaultStepTimeout (seconds) apply when the workflow omits timeout-minutes
+	DefaultJobTimeout  int `json:"defaultJobTimeout,omitempty"`
+	DefaultStepTimeout int `json:"defaultStepTimeout,omitempty"`
+	// Labels are the self-hosted labels this runner advertises; self-hosted, linux and the
+	// architecture label are implied
+	Labels []string `json:"labels,omitempty"`
+	// MaxActionDepth bounds how deeply composite actions may use other composite actions
+	MaxActionDepth int `json:"maxActionDepth,omitempty"`
+}
+
+const (
+	// defaultMaxOutputBytes is used when the config doesn't set runner.maxOutputBytes
+	defaultMaxOutputBytes = 10 * 1024 * 1024
+	// defaultMaxActionDepth is used when the config doesn't set runner.maxActionDepth
+	defaultMaxActionDepth = 10
+	// defaultBashOptions matches the way GitHub runs bash steps
+	defaultBashOptions = "-eo pipefail"
+)
+
+// Image pull retries when the config doesn't set container.pullRetries and pullRetryBackoff
+const (
+	defaultPullRetries      = 3
+	defaultPullRetryBackoff = 2 // seconds
+)
+
+// Image pull policies, with the same meaning as in Kubernetes
+const (
+	pullNever   = "never"
+	pullMissing = "missing"
+	pullAlways  = "always"
+)
+
+// ContainerConfig represents the container runtime configuration
+type ContainerConfig struct {
+	RegistryMirror string `json:"registryMirror,omitempty"`
+	// PullPolicy decides when images are pulled: never, missing (the default) or always
+	PullPolicy string `json:"pullPolicy,omitempty"`
+	// PullRetries is how often a pull that failed with a transient error is retried; nil means
+	// defaultPullRetries and 0 disables retries
+	PullRetries *int `json:"pullRetries,omitempty"`
+	// PullRetryBackoff is the delay in seconds before the first retry; it doubles for each one
+	PullRetryBackoff int `json:"pullRetryBackoff,omitempty"`
+	// RunnersDir holds the Dockerfile.<label> files runner images are built from
+	RunnersDir string `json:"runnersDir,omitempty"`
+	// User is passed to docker run --user, e.g. "1000:1000", so workspace files get host ownership
+	User string `json:"user,omitempty"`
+	// Volumes are extra host:container[:ro] bind mounts added to every step container
+	Volumes []string `json:"volumes,omitempty"`
+	// ExtraHosts are host:ip entries added to every step container's /etc/hosts
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+	// DNS servers step containers resolve names with instead of the Docker defaults
+	DNS []string `json:"dns,omitempty"`
+	// Labels are key=value labels added to every container besides vermont=true
+	Labels []string `json:"labels,omitempty"`
+	// Tmpfs are path[:options] RAM-backed mounts added to every step container
+	Tmpfs []string `json:"tmpfs,omitempty"`
+	// StepEntrypoint is the entrypoint run steps start with; empty clears the image's own
+	// so the shell command runs directly
+	StepEntrypoint string `json:"stepEntrypoint,omitempty"`
+}
+
+// EnvDef represents a deployment environment definition in the configuration
+type EnvDef struct {
+	Secrets   map[string]string `json:"secrets,omitempty"`
+	Vars      map[string]string `json:"vars,omitempty"`
+	Protected bool              `json:"protected,omitempty"`
 }
 
 // Workflow represents a GitHub Actions workflow
 type Workflow struct {
-	Name string            `yaml:"name"`
-	On   interface{}       `yaml:"on"`
-	Jobs map[string]*Job   `yaml:"jobs"`
-	Env  map[string]string `yaml:"env,omitempty"`
+	Name     string            `yaml:"name"`
+	On       interface{}       `yaml:"on"`
+	Jobs     map[string]*Job   `yaml:"jobs"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	Defaults Defaults          `yaml:"defaults,omitempty"`
+
+	Permissions *Permissions `yaml:"permissions,omitempty"`
+	Concurrency *Concurrency `yaml:"concurrency,omitempty"`
+
+	// WorkflowCall holds the on.workflow_call definitions of a reusable workflow, nil otherwise
+	WorkflowCall *WorkflowCall `yaml:"-"`
+	// DispatchInputs holds the on.workflow_dispatch inputs of a manually triggered workflow
+	DispatchInputs map[string]WorkflowCallInput `yaml:"-"`
+	// Schedule holds the on.schedule cron expressions
+	Schedule []string `yaml:"-"`
+}
+
+// WorkflowCall represents the inputs, secrets and outputs a reusable workflow declares
+type WorkflowCall struct {
+	Inputs  map[string]WorkflowCallInput  `yaml:"inputs"`
+	Secrets map[string]WorkflowCallSecret `yaml:"secrets"`
+	Outputs map[string]WorkflowCallOutput `yaml:"outputs"`
+}
+
+// WorkflowCallInput is an input of a reusable workflow; type is boolean, number or string.
+// Inputs of on.workflow_dispatch use it too and may also have type choice or environment.
+type WorkflowCallInput struct {
+	Description string      `yaml:"description"`
+	Required    bool        `yaml:"required"`
+	Type        string      `yaml:"type"`
+	Default     interface{} `yaml:"default"`
+	// Options lists the values a choice input accepts
+	Options []string `yaml:"options"`
+}
+
+// Coerce converts a value to the input's type; a choice input only accepts one of its options
+func (i WorkflowCallInput) Coerce(value interface{}) (interface{}, error) {
+	typed, err := coerceWorkflowCallInput(i.Type, value)
+	if err != nil {
+		return nil, err
+	}
+	if i.Type == "choice" {
+		if err := checkInputOption(typed.(string), i.Options); err != nil {
+			return nil, err
+		}
+	}
+	return typed, nil
+}
+
+// WorkflowCallSecret is a secret a reusable workflow expects from its caller
+type WorkflowCallSecret struct {
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// WorkflowCallOutput maps a reusable workflow output to an expression over its jobs' outputs
+type WorkflowCallOutput struct {
+	Description string `yaml:"description"`
+	Value       string `yaml:"value"`
+}
+
+// Defaults represents the defaults section of a workflow or job
+type Defaults struct {
+	Run RunDefaults `yaml:"run,omitempty"`
+}
+
+// RunDefaults represents default settings for run steps
+type RunDefaults struct {
+	Shell string `yaml:"shell,omitempty"`
 }
 
 // JobNeeds represents the needs field that can be either a string or []string
 type JobNeeds []string
 
-// UnmarshalYAML implements custom unmarshaling for JobNeeds
+// UnmarshalYAML implements custom unmarshaling for JobNeeds.
+// Both forms are normalized here: an empty string means no dependencies and duplicates are dropped.
 func (jn *JobNeeds) UnmarshalYAML(value *yaml.Node) error {
+	var needs []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		// Handle single string case
+		if value.Value != "" {
+			needs = []string{value.Value}
+		}
+	case yaml.SequenceNode:
+		// Handle array case
+		if err := value.Decode(&needs); err != nil {
+			return fmt.Errorf("needs must be either a string or an array of strings: %w", err)
+		}
+	default:
+		return fmt.Errorf("needs must be either a string or an array of strings")
+	}
+
+	seen := make(map[string]bool)
+	var normalized JobNeeds
+	for _, need := range needs {
+		need = strings.TrimSpace(need)
+		if need == "" {
+			return fmt.Errorf("needs must not contain empty job names")
+		}
+		if !seen[need] {
+			seen[need] = true
+			normalized = append(normalized, need)
+		}
+	}
+	*jn = normalized
+	return nil
+}
+
+// JobEnvironment represents the environment field that can be either a name or an object
+type JobEnvironment struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url,omitempty"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for JobEnvironment
+func (je *JobEnvironment) UnmarshalYAML(value *yaml.Node) error {
 	// Handle single string case
 	if value.Kind == yaml.ScalarNode {
-		*jn = []string{value.Value}
+		je.Name = value.Value
 		return nil
 	}
 
-	// Handle array case
-	if value.Kind == yaml.SequenceNode {
-		var needs []string
-		if err := value.Decode(&needs); err != nil {
+	// Handle object case
+	if value.Kind == yaml.MappingNode {
+		var env struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		}
+		if err := value.Decode(&env); err != nil {
 			return err
 		}
-		*jn = needs
+		je.Name = env.Name
+		je.URL = env.URL
 		return nil
 	}
 
-	return fmt.Errorf("needs must be either a string or an array of strings")
+	return fmt.Errorf("environment must be either a string or an object with a name")
 }
 
-// Job represents a single job in a workflow
-type Job struct {
-	RunsOn      interface{}       `yaml:"runs-on"`
-	Needs       JobNeeds          `yaml:"needs"`
-	Steps       []*Step           `yaml:"steps"`
-	Strategy    *Strategy         `yaml:"strategy"`
-	If          string            `yaml:"if,omitempty"`
-	Outputs     map[string]string `yaml:"outputs,omitempty"`
-	Environment string            `yaml:"environment,omitempty"`
+// permissionScopes are the GITHUB_TOKEN scopes a permissions block can set
+var permissionScopes = []string{
+	"actions", "attestations", "checks", "contents", "deployments", "discussions", "id-token",
+	"issues", "models", "packages", "pages", "pull-requests", "repository-projects", "security-events", "statuses",
 }
 
-// Strategy represents the strategy configuration for a job
-type Strategy struct {
-	Matrix map[string]interface{} `yaml:"matrix"`
+// Permissions represents the permissions field: read-all, write-all or a map of scope to access level
+type Permissions struct {
+	All    string            // read-all or write-all when the shorthand form is used
+	Scopes map[string]string // access per scope (read, write or none) in the map form
 }
 
-// Step represents a single step in a job
-type Step struct {
-	Name string                 `yaml:"name"`
-	Run  string                 `yaml:"run"`
-	Uses string                 `yaml:"uses"`
-	With map[string]interface{} `yaml:"with"`
-	Env  map[string]string      `yaml:"env"`
+// UnmarshalYAML implements custom unmarshaling for Permissions
+func (p *Permissions) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		if value.Value != "read-all" && value.Value != "write-all" {
+			return fmt.Errorf("permissions must be read-all, write-all or a map of scopes, got %q", value.Value)
+		}
+		p.All = value.Value
+		return nil
+	case yaml.MappingNode:
+		var scopes map[string]string
+		if err := value.Decode(&scopes); err != nil {
+			return fmt.Errorf("permissions must map scopes to read, write or none: %w", err)
+		}
+		for scope, level := range scopes {
+			if !contains(permissionScopes, scope) {
+				return fmt.Errorf("unknown permission scope %q", scope)
+			}
+			if level != "read" && level != "write" && level != "none" {
+				return fmt.Errorf("permission %s must be read, write or none, got %q", scope, level)
+			}
+		}
+		p.Scopes = scopes
+		return nil
+	}
+	return fmt.Errorf("permissions must be read-all, write-all or a map of scopes")
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: vermont <workflow-file>")
-		fmt.Println("Example: vermont examples/parallel-test.yml")
-		os.Exit(1)
+// Effective returns the access level of every scope; scopes left out of the map form get none
+func (p *Permissions) Effective() map[string]string {
+	effective := make(map[string]string, len(permissionScopes))
+	for _, scope := range permissionScopes {
+		switch p.All {
+		case "read-all":
+			effective[scope] = "read"
+		case "write-all":
+			effective[scope] = "write"
+		default:
+			effective[scope] = "none"
+			if level, ok := p.Scopes[scope]; ok {
+				effective[scope] = level
+			}
+		}
 	}
+	return effective
+}
 
-	workflowFile := os.Args[1]
+// BoolExpr is a field that can be either a boolean or an expression, such as
+// cancel-in-progress; the empty value is false
+type BoolExpr string
 
-	// Load configuration
-	config, err := loadConfig("config.json")
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+// UnmarshalYAML implements custom unmarshaling for BoolExpr
+func (b *BoolExpr) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("must be either a boolean or an expression")
 	}
 
-	// Load workflow
-	workflow, err := loadWorkflow(workflowFile)
-	if err != nil {
-		log.Fatalf("Failed to load workflow: %v", err)
+	// Normalize YAML booleans (true, yes, on, ...) to their canonical form
+	if value.Tag == "!!bool" {
+		var v bool
+		if err := value.Decode(&v); err != nil {
+			return err
+		}
+		*b = BoolExpr(fmt.Sprintf("%t", v))
+		return nil
 	}
 
-	// Execute workflow
-	if err := executeWorkflow(workflow, config); err != nil {
-		log.Fatalf("Failed to execute workflow: %v", err)
+	*b = BoolExpr(value.Value)
+	return nil
+}
+
+// Evaluate resolves the value, defaulting to false when empty
+func (b BoolExpr) Evaluate(evaluator *expression.Evaluator) (bool, error) {
+	expr := strings.TrimSpace(string(b))
+	if spans, err := expression.FindExpressions(expr); err == nil && len(spans) == 1 && spans[0].Start == 0 && spans[0].End == len(expr) {
+		expr = spans[0].Expr
+	}
+	if expr == "" {
+		return false, nil
 	}
 
-	fmt.Println("Workflow completed successfully!")
+	value, err := evaluator.Evaluate(expr)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate '%s': %w", b, err)
+	}
+	return expression.Truthy(value), nil
 }
 
-func loadConfig(configFile string) (*Config, error) {
-	data, err := os.ReadFile(configFile)
+// ContinueOnError represents the continue-on-error field that can be either a boolean or an expression
+type ContinueOnError string
+
+// UnmarshalYAML implements custom unmarshaling for ContinueOnError
+func (c *ContinueOnError) UnmarshalYAML(value *yaml.Node) error {
+	var expr BoolExpr
+	if err := expr.UnmarshalYAML(value); err != nil {
+		return fmt.Errorf("continue-on-error %w", err)
+	}
+	*c = ContinueOnError(expr)
+	return nil
+}
+
+// Evaluate resolves the continue-on-error value, defaulting to false when empty
+func (c ContinueOnError) Evaluate(evaluator *expression.Evaluator) (bool, error) {
+	value, err := BoolExpr(c).Evaluate(evaluator)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return false, fmt.Errorf("continue-on-error: %w", err)
 	}
+	return value, nil
+}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+// StepWith holds the with inputs of a step. Booleans are decoded as such and become true or
+// false; numbers keep the text they were written with, so 3.10 stays 3.10; everything else is
+// decoded as usual and inputValueString turns it into the INPUT_<NAME> value.
+type StepWith map[string]interface{}
+
+// UnmarshalYAML implements custom unmarshaling for StepWith
+func (w *StepWith) UnmarshalYAML(value *yaml.Node) error {
+	if value.Tag == "!!null" {
+		return nil
+	}
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: with must be a mapping", value.Line)
 	}
 
-	// Expand environment variables
-	for key, value := range config.Env {
-		if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
-			envVar := strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")
-			if envValue := os.Getenv(envVar); envValue != "" {
-				config.Env[key] = envValue
-			} else {
-				config.Env[key] = "fake-" + strings.ToLower(envVar)
+	with := make(StepWith, len(value.Content)/2)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, node := value.Content[i].Value, value.Content[i+1]
+
+		var decoded interface{}
+		if err := node.Decode(&decoded); err != nil {
+			return err
+		}
+		if node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float") {
+			// GitHub passes the number, not its text; warn where that changes the value
+			if github := inputValueString(decoded); github != node.Value {
+				warnf("Warning: line %d: with.%s is the number %s, which GitHub passes as %s; quote it to keep it as written\n", node.Line, key, node.Value, github)
 			}
+			decoded = node.Value
 		}
+		with[key] = decoded
 	}
+	*w = with
+	return nil
+}
 
-	return &config, nil
+// Concurrency represents the concurrency field that can be either a group name or an object
+// with a group and cancel-in-progress; both may contain expressions
+type Concurrency struct {
+	Group            string   `yaml:"group"`
+	CancelInProgress BoolExpr `yaml:"cancel-in-progress,omitempty"`
 }
 
-// expandEnvironmentVariables expands ${VAR} syntax in strings using shell environment
-func expandEnvironmentVariables(value string) string {
-	// Handle ${VAR} syntax
-	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
-		envVar := strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")
-		if envValue := os.Getenv(envVar); envValue != "" {
-			return envValue
+// UnmarshalYAML implements custom unmarshaling for Concurrency
+func (c *Concurrency) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Group = value.Value
+		return nil
+	}
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("concurrency must be either a group name or an object with a group")
+	}
+
+	var concurrency struct {
+		Group            string    `yaml:"group"`
+		CancelInProgress yaml.Node `yaml:"cancel-in-progress"`
+	}
+	if err := value.Decode(&concurrency); err != nil {
+		return err
+	}
+	c.Group = concurrency.Group
+
+	if concurrency.CancelInProgress.Kind != 0 {
+		if err := c.CancelInProgress.UnmarshalYAML(&concurrency.CancelInProgress); err != nil {
+			return fmt.Errorf("cancel-in-progress %w", err)
 		}
-		// Return original value if environment variable not found
-		return value
 	}
-	return value
+	return nil
 }
 
-func loadWorkflow(workflowFile string) (*Workflow, error) {
-	data, err := os.ReadFile(workflowFile)
+// Resolve evaluates the group and cancel-in-progress expressions
+func (c *Concurrency) Resolve(evaluator *expression.Evaluator) (string, bool, error) {
+	group, err := evaluator.Interpolate(c.Group)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read workflow file: %w", err)
+		return "", false, fmt.Errorf("concurrency group: %w", err)
+	}
+	if strings.TrimSpace(group) == "" {
+		return "", false, fmt.Errorf("concurrency group %q is empty", c.Group)
 	}
 
-	var workflow Workflow
-	if err := yaml.Unmarshal(data, &workflow); err != nil {
-		return nil, fmt.Errorf("failed to parse workflow: %w", err)
+	cancel, err := c.CancelInProgress.Evaluate(evaluator)
+	if err != nil {
+		return "", false, fmt.Errorf("concurrency cancel-in-progress: %w", err)
 	}
+	return group, cancel, nil
+}
 
-	return &workflow, nil
+// Job represents a single job in a workflow
+type Job struct {
+	RunsOn          interface{}       `yaml:"runs-on"`
+	Needs           JobNeeds          `yaml:"needs"`
+	Steps           []*Step           `yaml:"steps"`
+	Strategy        *Strategy         `yaml:"strategy"`
+	If              string            `yaml:"if,omitempty"`
+	Outputs         map[string]string `yaml:"outputs,omitempty"`
+	Env             map[string]string `yaml:"env,omitempty"`
+	Environment     JobEnvironment    `yaml:"environment,omitempty"`
+	ContinueOnError ContinueOnError   `yaml:"continue-on-error,omitempty"`
+	Defaults        Defaults          `yaml:"defaults,omitempty"`
+	TimeoutMinutes  float64           `yaml:"timeout-minutes,omitempty"`
+	Permissions     *Permissions      `yaml:"permissions,omitempty"`
+	Container       *JobContainer     `yaml:"container,omitempty"`
+
+	// Matrix holds the matrix values of a job expanded from a matrix strategy
+	Matrix map[string]interface{} `yaml:"-"`
+	// MatrixGroup is the name of the job a matrix job was expanded from
+	MatrixGroup string `yaml:"-"`
+	// FailFast cancels the other jobs of the matrix group when this job fails
+	FailFast bool `yaml:"-"`
+	// MaxParallel limits how many jobs of the matrix group run at once; 0 means no limit
+	MaxParallel int `yaml:"-"`
 }
 
-// expandMatrixJobs takes jobs with matrix strategies and expands them into multiple jobs
-func expandMatrixJobs(jobs map[string]*Job) map[string]*Job {
-	expandedJobs := make(map[string]*Job)
+// JobContainer is the image a job's steps run in instead of the runner image, written as
+// an image name or as a mapping with the image and the credentials to pull it with
+type JobContainer struct {
+	Image       string                `yaml:"image"`
+	Credentials *ContainerCredentials `yaml:"credentials,omitempty"`
+}
 
-	for jobName, job := range jobs {
-		if job.Strategy != nil && job.Strategy.Matrix != nil {
-			// Generate all matrix combinations
-			combinations := generateMatrixCombinations(job.Strategy.Matrix)
+// ContainerCredentials log in to the registry of a private job container image
+type ContainerCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
 
-			for i, combination := range combinations {
-				// Create unique job name for each matrix combination
-				matrixJobName := fmt.Sprintf("%s_%d", jobName, i)
+// UnmarshalYAML accepts container: image as a shorthand for container: {image: image}
+func (c *JobContainer) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Image = value.Value
+		return nil
+	}
+	type plain JobContainer
+	return value.Decode((*plain)(c))
+}
 
-				// Clone the job
-				matrixJob := &Job{
-					RunsOn: job.RunsOn,
-					Needs:  job.Needs,
-					Steps:  cloneSteps(job.Steps, combination),
-				}
+// Strategy represents the strategy configuration for a job
+type Strategy struct {
+	Matrix      map[string]interface{} `yaml:"matrix"`
+	FailFast    *bool                  `yaml:"fail-fast,omitempty"`
+	MaxParallel int                    `yaml:"max-parallel,omitempty"`
 
-				expandedJobs[matrixJobName] = matrixJob
-			}
-		} else {
-			// Job without matrix, just copy as-is
-			expandedJobs[jobName] = job
+	// MatrixKeys lists the matrix keys in the order they are declared in the workflow
+	MatrixKeys []string `yaml:"-"`
+}
+
+// UnmarshalYAML decodes the strategy and records the declaration order of the matrix keys
+func (s *Strategy) UnmarshalYAML(value *yaml.Node) error {
+	type plain Strategy
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value != "matrix" || value.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		matrix := value.Content[i+1]
+		for j := 0; j+1 < len(matrix.Content); j += 2 {
+			s.MatrixKeys = append(s.MatrixKeys, matrix.Content[j].Value)
 		}
 	}
+	return nil
+}
 
-	return expandedJobs
+// Step represents a single step in a job
+type Step struct {
+	ID              string            `yaml:"id"`
+	Name            string            `yaml:"name"`
+	Run             string            `yaml:"run"`
+	Uses            string            `yaml:"uses"`
+	If              string            `yaml:"if,omitempty"`
+	With            StepWith          `yaml:"with"`
+	Env             map[string]string `yaml:"env"`
+	Shell           string            `yaml:"shell,omitempty"`
+	ContinueOnError ContinueOnError   `yaml:"continue-on-error,omitempty"`
+	TimeoutMinutes  float64           `yaml:"timeout-minutes,omitempty"`
 }
 
-// generateMatrixCombinations generates all possible combinations from a matrix
-func generateMatrixCombinations(matrix map[string]interface{}) []map[string]interface{} {
-	var combinations []map[string]interface{}
+// Options represents the command line options
+type Options struct {
+	WorkflowFile string
+	Confirm      bool
+	Watch        bool
+	NoCleanup    bool
+	Env          map[string]string
 
-	// Separate matrix dimensions from include/exclude directives
-	dimensions := make(map[string]interface{})
-	var includeList []map[string]interface{}
-	var excludeList []map[string]interface{}
+	AnnotationsFile   string
+	AnnotationsFormat string
 
-	for key, value := range matrix {
-		switch key {
-		case "include":
-			if includes, ok := value.([]interface{}); ok {
-				for _, include := range includes {
-					if includeMap, ok := include.(map[string]interface{}); ok {
-						includeList = append(includeList, includeMap)
-					}
-				}
-			}
-		case "exclude":
-			if excludes, ok := value.([]interface{}); ok {
-				for _, exclude := range excludes {
-					if excludeMap, ok := exclude.(map[string]interface{}); ok {
-						excludeList = append(excludeList, excludeMap)
-					}
-				}
-			}
-		default:
-			dimensions[key] = value
-		}
-	}
+	// JUnitOut writes a JUnit XML report with a test case per step to this file when set
+	JUnitOut string
 
-	// Get all keys and values for base dimensions
-	keys := make([]string, 0, len(dimensions))
-	values := make([][]interface{}, 0, len(dimensions))
+	// ReportFile receives the run report in the format its extension selects when set
+	ReportFile string
 
-	for key, value := range dimensions {
-		keys = append(keys, key)
-		switch v := value.(type) {
-		case []interface{}:
-			values = append(values, v)
-		default:
-			values = append(values, []interface{}{v})
-		}
-	}
+	// Repository, Ref, SHA and Actor override the github context and GITHUB_* variables when set
+	Repository string
+	Ref        string
+	SHA        string
+	Actor      string
 
-	// Generate cartesian product for base dimensions
-	var generate func(int, map[string]interface{})
-	generate = func(index int, current map[string]interface{}) {
-		if index == len(keys) {
-			// Make a copy of current combination
-			combination := make(map[string]interface{})
-			for k, v := range current {
-				combination[k] = v
-			}
+	// SinceRef skips jobs whose jobPaths filter matches none of the files changed since this ref
+	SinceRef string
 
-			// Check if this combination should be excluded
-			excluded := false
-			for _, exclude := range excludeList {
-				if matchesCombination(combination, exclude) {
-					excluded = true
-					break
-				}
-			}
+	// MatrixFailFast overrides every strategy's fail-fast when set
+	MatrixFailFast *bool
 
-			if !excluded {
-				combinations = append(combinations, combination)
-			}
-			return
-		}
+	// ContainerUser overrides the configured container user when set
+	ContainerUser string
 
-		key := keys[index]
-		for _, value := range values[index] {
-			current[key] = value
-			generate(index+1, current)
-		}
-	}
+	// ContainerEntrypoint overrides the configured run step entrypoint when set
+	ContainerEntrypoint string
 
-	generate(0, make(map[string]interface{}))
+	// PullPolicy overrides the configured image pull policy when set
+	PullPolicy string
 
-	// Add include combinations
-	for _, include := range includeList {
-		// Check if any existing combination matches the base dimensions of include
-		matchFound := false
-		for i, existing := range combinations {
-			if matchesBaseDimensions(existing, include, keys) {
-				// Merge additional properties from include
-				for k, v := range include {
-					if !contains(keys, k) {
-						combinations[i][k] = v
-					}
-				}
-				matchFound = true
-				break
-			}
-		}
+	// Volumes are added to the configured container volumes
+	Volumes []string
 
-		// If no match found, add as new combination
-		if !matchFound {
-			combinations = append(combinations, include)
-		}
-	}
+	// Labels are added to the configured container labels
+	Labels []string
 
-	return combinations
-}
+	// Tmpfs mounts are added to the configured container tmpfs mounts
+	Tmpfs []string
 
-// matchesCombination checks if a combination matches all fields in a pattern
-func matchesCombination(combination, pattern map[string]interface{}) bool {
-	for key, value := range pattern {
-		if combination[key] != value {
-			return false
-		}
-	}
-	return true
-}
+	// Event limits a directory run to workflows triggered by this event
+	Event string
 
-// matchesBaseDimensions checks if a combination matches the base dimensions of an include
-func matchesBaseDimensions(existing, include map[string]interface{}, baseDimensions []string) bool {
-	for _, dim := range baseDimensions {
-		if includeVal, exists := include[dim]; exists {
-			if existing[dim] != includeVal {
-				return false
-			}
-		}
-	}
-	return true
-}
+	// JSONLogs writes step output as one JSON event per line instead of raw text
+	JSONLogs bool
 
-// contains checks if a slice contains a string
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
+	// ActionsCacheDir overrides the configured actions cache directory when set
+	ActionsCacheDir string
 
-// cloneSteps clones steps and substitutes matrix variables
-func cloneSteps(steps []*Step, matrixVars map[string]interface{}) []*Step {
-	clonedSteps := make([]*Step, len(steps))
+	// StrictExit makes failures tolerated by continue-on-error fail the run with exitToleratedFailures
+	StrictExit bool
 
-	for i, step := range steps {
-		clonedSteps[i] = &Step{
-			Name: substituteMatrixVars(step.Name, matrixVars),
-			Run:  substituteMatrixVars(step.Run, matrixVars),
-			Uses: substituteMatrixVars(step.Uses, matrixVars),
-			With: cloneWithVars(step.With, matrixVars),
-			Env:  cloneEnvVars(step.Env, matrixVars),
-		}
-	}
+	// FixPermissions hands the workspace back to the host user after every container step
+	FixPermissions bool
 
-	return clonedSteps
-}
+	// StepOutputTail shows only the last lines of a successful step's output when positive
+	StepOutputTail int
 
-// substituteMatrixVars replaces ${{ matrix.* }} variables in strings
-func substituteMatrixVars(text string, matrixVars map[string]interface{}) string {
-	result := text
+	// Trace prints every docker command a step runs, with secrets masked
+	Trace bool
 
-	// First, substitute all variables that exist in matrixVars
-	for key, value := range matrixVars {
-		placeholder := fmt.Sprintf("${{ matrix.%s }}", key)
-		result = strings.ReplaceAll(result, placeholder, fmt.Sprintf("%v", value))
-	}
+	// SkipCheckout turns actions/checkout steps into no-ops for runs on a local checkout
+	SkipCheckout bool
 
-	// Then, find any remaining matrix variables and substitute them with empty string
-	// This handles cases where a matrix variable is referenced but doesn't exist in this combination
-	for {
-		start := strings.Index(result, "${{ matrix.")
-		if start == -1 {
-			break
-		}
-		end := strings.Index(result[start:], " }}")
-		if end == -1 {
-			break
-		}
-		end += start + 3 // Include the " }}"
+	// Inputs are the values of the workflow's dispatch or call inputs, by name
+	Inputs map[string]string
 
-		// Replace unknown matrix variable with empty string
-		result = result[:start] + result[end:]
-	}
+	// DumpEnvDir receives a <job>.env file with each job's final environment when set
+	DumpEnvDir string
+	// DumpEnvUnsafe writes secret values to the dumped env files instead of masking them
+	DumpEnvUnsafe bool
 
-	return result
+	// LogLevel decides which of Vermont's own messages are printed
+	LogLevel LogLevel
 }
 
-// cloneWithVars clones and substitutes matrix vars in with map
-func cloneWithVars(with map[string]interface{}, matrixVars map[string]interface{}) map[string]interface{} {
-	if with == nil {
-		return nil
-	}
+// Exit codes: 0 means every job and step succeeded
+const (
+	exitFailure           = 1 // a job failed, or vermont couldn't run the workflow
+	exitToleratedFailures = 2 // with --strict-exit, only continue-on-error failures occurred
+	exitInvalidWorkflow   = 3 // the workflow couldn't be parsed, is invalid or its jobs depend on each other in a cycle
+	exitDockerUnavailable = 4 // docker isn't installed or the daemon can't be reached
+	exitActionNotFound    = 5 // a step uses an action that doesn't exist
+	exitStepTimeout       = 6 // a step exceeded its timeout-minutes
+)
 
-	cloned := make(map[string]interface{})
-	for key, value := range with {
-		if strValue, ok := value.(string); ok {
-			cloned[key] = substituteMatrixVars(strValue, matrixVars)
-		} else {
-			cloned[key] = value
-		}
+// exitCode maps the error of a run to the exit code that tells its cause apart
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errInvalidWorkflow), errors.Is(err, errCircularDependency):
+		return exitInvalidWorkflow
+	case errors.Is(err, errDockerUnavailable):
+		return exitDockerUnavailable
+	case errors.Is(err, errActionNotFound):
+		return exitActionNotFound
+	case errors.Is(err, errStepTimeout):
+		return exitStepTimeout
+	case errors.Is(err, errToleratedFailures):
+		return exitToleratedFailures
 	}
-	return cloned
+	return exitFailure
 }
 
-// cloneEnvVars clones and substitutes matrix vars in env map
-func cloneEnvVars(env map[string]string, matrixVars map[string]interface{}) map[string]string {
-	if env == nil {
-		return nil
+// errToleratedFailures is returned with --strict-exit when continue-on-error hid a failure
+var errToleratedFailures = errors.New("failures were tolerated by continue-on-error")
+
+// optionalBoolFlag is a boolean flag that records whether it was given at all
+type optionalBoolFlag struct {
+	value **bool
+}
+
+func (f optionalBoolFlag) String() string {
+	if f.value == nil || *f.value == nil {
+		return ""
 	}
+	return strconv.FormatBool(**f.value)
+}
 
-	cloned := make(map[string]string)
-	for key, value := range env {
-		cloned[key] = substituteMatrixVars(value, matrixVars)
+func (f optionalBoolFlag) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
 	}
-	return cloned
+	*f.value = &b
+	return nil
 }
 
-// substituteActionTemplates replaces action template variables in strings
-func substituteActionTemplates(text string, inputs map[string]interface{}, stepOutputs map[string]map[string]string) string {
-	result := text
+func (f optionalBoolFlag) IsBoolFlag() bool {
+	return true
+}
 
-	// Substitute inputs: ${{ inputs.name }}
-	for inputName, value := range inputs {
-		placeholder := fmt.Sprintf("${{ inputs.%s }}", inputName)
-		result = strings.ReplaceAll(result, placeholder, fmt.Sprintf("%v", value))
+// envFlag collects repeatable --env KEY=VALUE (or bare KEY) flags
+type envFlag map[string]string
+
+func (e envFlag) String() string {
+	return ""
+}
+
+func (e envFlag) Set(value string) error {
+	key, val, hasValue := strings.Cut(value, "=")
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("invalid environment variable %q (expected KEY=VALUE or KEY)", value)
 	}
 
-	// Substitute step outputs: ${{ steps.stepid.outputs.outputname }}
-	for stepId, outputs := range stepOutputs {
-		for outputName, value := range outputs {
-			placeholder := fmt.Sprintf("${{ steps.%s.outputs.%s }}", stepId, outputName)
-			result = strings.ReplaceAll(result, placeholder, value)
+	// A bare KEY imports the variable from the current process environment
+	if !hasValue {
+		envValue, ok := os.LookupEnv(key)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", key)
 		}
+		val = envValue
 	}
 
-	return result
+	e[key] = val
+	return nil
 }
 
-// substituteWorkflowTemplates replaces workflow context template variables with safe defaults
-func substituteWorkflowTemplates(text string, workflowEnv map[string]string, configEnv map[string]string) string {
-	result := text
+// LogLevel orders Vermont's messages from errors only to debug output
+type LogLevel int
 
-	// Handle workflow environment variables: ${{ env.VAR }}
-	for key, value := range workflowEnv {
-		placeholder := fmt.Sprintf("${{ env.%s }}", key)
-		result = strings.ReplaceAll(result, placeholder, value)
-	}
+const (
+	LogError LogLevel = iota
+	LogWarn
+	LogInfo
+	LogDebug
+)
 
-	// Handle unknown template expressions with safe defaults
-	// This prevents bash substitution errors by replacing unknown variables
-	for {
-		start := strings.Index(result, "${{")
-		if start == -1 {
-			break
-		}
-		end := strings.Index(result[start:], "}}")
-		if end == -1 {
-			break
-		}
-		end += start + 2 // Include the "}}"
+var logLevelNames = []string{"error", "warn", "info", "debug"}
 
-		// Extract the template expression
-		templateExpr := result[start:end]
-		templateContent := strings.TrimSpace(templateExpr[3 : len(templateExpr)-2]) // Remove ${{ and }}
+// logLevel is the level of the current invocation; step output is never filtered
+var logLevel = LogInfo
 
-		// Provide safe defaults for common patterns
-		var replacement string
-		switch {
-		case strings.Contains(templateExpr, "needs.") && strings.Contains(templateExpr, ".result"):
-			// Job result expressions: default to "success" for demo purposes
-			replacement = "success"
-		case strings.Contains(templateExpr, "needs.") && strings.Contains(templateExpr, ".outputs."):
-			// Job output expressions: default to "unknown"
-			replacement = "unknown"
-		case templateContent == "github.repository":
-			// GitHub repository: use the configured repository
-			replacement = configEnv["GITHUB_REPOSITORY"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_REPOSITORY")
-			}
-			if replacement == "" {
-				replacement = "owner/repo" // fallback
-			}
-		case templateContent == "github.token":
-			// GitHub token: use the configured token
-			replacement = configEnv["GITHUB_TOKEN"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_TOKEN")
-			}
-		case templateContent == "github.ref":
-			// GitHub ref: use the configured ref
-			replacement = configEnv["GITHUB_REF"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_REF")
-			}
-			if replacement == "" {
-				replacement = "refs/heads/main" // fallback
-			}
-		case templateContent == "github.sha":
-			// GitHub SHA: use the configured SHA
-			replacement = configEnv["GITHUB_SHA"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_SHA")
-			}
-			if replacement == "" {
-				replacement = "unknown" // fallback
-			}
-		case templateContent == "github.workspace":
-			// GitHub workspace: use the configured workspace
-			replacement = configEnv["GITHUB_WORKSPACE"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_WORKSPACE")
-			}
-			if replacement == "" {
-				replacement = "/workspace" // fallback
-			}
-		case templateContent == "github.token":
-			// GitHub token: use the configured token
-			replacement = configEnv["GITHUB_TOKEN"]
-			if replacement == "" {
-				replacement = os.Getenv("GITHUB_TOKEN")
-			}
-			if replacement == "" {
-				replacement = "github_pat_placeholder" // fallback
-			}
-		case strings.HasPrefix(templateContent, "github."):
-			// Other GitHub context variables: try config first, then environment variable
-			envVar := strings.ToUpper(strings.ReplaceAll(templateContent, ".", "_"))
-			replacement = configEnv[envVar]
-			if replacement == "" {
-				replacement = os.Getenv(envVar)
-			}
-			if replacement == "" {
-				replacement = "unknown" // fallback
-			}
-		case strings.Contains(templateContent, "runner.debug"):
-			// Runner debug expressions: default to "false" for boolean compatibility
-			replacement = "false"
-		case strings.Contains(templateExpr, "env."):
-			// Environment variables: extract name and use empty default
-			replacement = ""
-		default:
-			// Unknown expressions: replace with empty string
-			replacement = ""
-		}
+// logFlags holds --log-level, the repeatable -v, each of which raises the level by one,
+// and --quiet, a shorthand for the error level
+type logFlags struct {
+	level     string
+	verbosity int
+	quiet     bool
+}
 
-		result = result[:start] + replacement + result[end:]
-	}
+// register adds the logging flags to a flag set
+func (l *logFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&l.level, "log-level", "info", "Messages to print: error, warn, info or debug")
+	fs.Var((*verbosityFlag)(&l.verbosity), "v", "Print more messages; raises --log-level by one (repeatable)")
+	fs.BoolVar(&l.quiet, "quiet", false, "Only print step output and errors (same as --log-level error)")
+}
 
-	return result
+// resolve returns the level selected by the flags
+func (l *logFlags) resolve() (LogLevel, error) {
+	if l.quiet {
+		if l.verbosity > 0 || !strings.EqualFold(l.level, "info") {
+			return LogInfo, fmt.Errorf("--quiet can't be combined with --log-level or -v")
+		}
+		return LogError, nil
+	}
+	for i, name := range logLevelNames {
+		if strings.EqualFold(l.level, name) {
+			level := LogLevel(i) + LogLevel(l.verbosity)
+			if level > LogDebug {
+				level = LogDebug
+			}
+			return level, nil
+		}
+	}
+	return LogInfo, fmt.Errorf("invalid log level %q (expected %s)", l.level, strings.Join(logLevelNames, ", "))
 }
 
-// parseStepOutputs reads outputs from GITHUB_OUTPUT file
-func parseStepOutputs(githubOutputPath string) (map[string]string, error) {
-	outputs := make(map[string]string)
+// verbosityFlag counts how often a boolean flag was given
+type verbosityFlag int
 
-	if _, err := os.Stat(githubOutputPath); os.IsNotExist(err) {
-		return outputs, nil
+func (v *verbosityFlag) String() string {
+	if v == nil {
+		return "0"
 	}
+	return strconv.Itoa(int(*v))
+}
 
-	data, err := os.ReadFile(githubOutputPath)
+func (v *verbosityFlag) Set(value string) error {
+	b, err := strconv.ParseBool(value)
 	if err != nil {
-		return outputs, err
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	if b {
+		*v++
 	}
+	return nil
+}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
+func (v *verbosityFlag) IsBoolFlag() bool {
+	return true
+}
 
-		// Parse name=value format
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			outputs[parts[0]] = parts[1]
-		}
+// logf prints a message when the current log level includes level
+func logf(level LogLevel, format string, args ...interface{}) {
+	if level <= logLevel {
+		fmt.Printf(format, args...)
 	}
+}
 
-	return outputs, nil
+// infof, warnf and debugf print progress messages, warnings and debug details
+func infof(format string, args ...interface{}) {
+	logf(LogInfo, format, args...)
 }
 
-// ActionRef represents a parsed action reference
-type ActionRef struct {
-	Owner     string
-	Repo      string
-	Ref       string // version, branch, or commit
-	IsLocal   bool
-	LocalPath string
+func warnf(format string, args ...interface{}) {
+	logf(LogWarn, format, args...)
 }
 
-// parseActionRef parses action reference like "actions/checkout@v4" or "./path/to/action"
-func parseActionRef(uses string) (*ActionRef, error) {
-	// Handle relative paths (./path/to/action)
-	if strings.HasPrefix(uses, "./") {
-		return &ActionRef{
-			IsLocal:   true,
-			LocalPath: uses,
-		}, nil
+func debugf(format string, args ...interface{}) {
+	logf(LogDebug, format, args...)
+}
+
+// progressOutput returns where the progress of tools Vermont runs itself, such as docker
+// build and pull, is written: stdout at the info level and above, nowhere below it
+func progressOutput() io.Writer {
+	if logLevel < LogInfo {
+		return io.Discard
 	}
+	return os.Stdout
+}
 
-	// Split by @ to get ref
-	parts := strings.Split(uses, "@")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid action reference format: %s (expected owner/repo@ref)", uses)
+// quietCommand returns the arguments of a git or docker subcommand, adding --quiet when
+// progress isn't shown so the tool still reports errors on stderr but nothing else
+func quietCommand(subcommand string, args ...string) []string {
+	command := []string{subcommand}
+	if logLevel < LogInfo {
+		command = append(command, "--quiet")
 	}
+	return append(command, args...)
+}
 
-	// Split owner/repo
-	ownerRepo := strings.Split(parts[0], "/")
-	if len(ownerRepo) != 2 {
-		return nil, fmt.Errorf("invalid action reference format: %s (expected owner/repo@ref)", uses)
+// stringsFlag collects the values of a repeatable flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	if f == nil {
+		return ""
 	}
+	return strings.Join(*f, ", ")
+}
 
-	return &ActionRef{
-		Owner: ownerRepo[0],
-		Repo:  ownerRepo[1],
-		Ref:   parts[1],
-	}, nil
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
-// cloneAction clones an action repository to the steps directory or resolves local path
-func cloneAction(actionRef *ActionRef, stepsDir string, jobDir string) (string, error) {
-	// Handle local actions
-	if actionRef.IsLocal {
-		// Get absolute path relative to current working directory
-		currentDir, err := os.Getwd()
-		if err != nil {
-			return "", fmt.Errorf("failed to get current directory: %w", err)
+func main() {
+	args := os.Args[1:]
+
+	// Subcommands that don't run a workflow
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			// Explicit form of the default command
+			args = args[1:]
+		case "validate":
+			if err := runValidateCommand(args[1:]); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					os.Exit(0)
+				}
+				os.Exit(exitCode(err))
+			}
+			return
+		case "action":
+			if err := runActionCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "config":
+			if err := runConfigCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "images":
+			if err := runImagesCommand(os.Args[2:]); err != nil {
+				if err == flag.ErrHelp {
+					os.Exit(0)
+				}
+				log.Fatal(err)
+			}
+			return
+		case "doctor":
+			if !runDoctor() {
+				os.Exit(exitFailure)
+			}
+			return
+		case "exec":
+			if err := runExecCommand(os.Args[2:]); err != nil {
+				if err == flag.ErrHelp {
+					os.Exit(0)
+				}
+				// The command's own exit code is passed on
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					os.Exit(exitErr.ExitCode())
+				}
+				log.Fatal(err)
+			}
+			return
 		}
-		actionDir := filepath.Join(currentDir, actionRef.LocalPath)
+	}
 
-		// Check if local action exists
-		if _, err := os.Stat(actionDir); err != nil {
-			return "", fmt.Errorf("local action not found: %s", actionDir)
-		}
+	// Defaults from .vermontrc come first so command line flags override them
+	rcArgs, err := loadRCArgs(".vermontrc")
+	if err != nil {
+		log.Fatalf("Failed to read .vermontrc: %v", err)
+	}
 
-		fmt.Printf("      Using local action: %s\n", actionDir)
-		return actionDir, nil
+	opts, err := parseOptions(append(rcArgs, args...))
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
+	if err != nil {
+		// The flag package already printed what was wrong with the flags themselves
+		if !errors.Is(err, errFlagsReported) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitFailure)
+	}
+	logLevel = opts.LogLevel
 
-	// Handle remote actions - make unique per job to avoid race conditions
-	jobName := filepath.Base(jobDir)
-	actionDir := filepath.Join(stepsDir, fmt.Sprintf("%s_%s_%s_%s", actionRef.Owner, actionRef.Repo, actionRef.Ref, jobName))
+	// Load configuration
+	config, err := loadConfig("config.json")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
-	// Check if already cloned
-	if _, err := os.Stat(actionDir); err == nil {
-		return actionDir, nil
+	// Command line variables override the configuration
+	applyEnvOverrides(config, opts.Env)
+	applyGitHubOverrides(config, opts)
+	if opts.ContainerUser != "" {
+		config.Container.User = opts.ContainerUser
+	}
+	if opts.ContainerEntrypoint != "" {
+		config.Container.StepEntrypoint = opts.ContainerEntrypoint
+	}
+	if opts.PullPolicy != "" {
+		config.Container.PullPolicy = opts.PullPolicy
+	}
+	if opts.ActionsCacheDir != "" {
+		applyActionsCacheDir(config, opts.ActionsCacheDir)
 	}
+	volumes, err := normalizeVolumes(opts.Volumes)
+	if err != nil {
+		log.Fatalf("Invalid --volume: %v", err)
+	}
+	config.Container.Volumes = append(config.Container.Volumes, volumes...)
+	if err := validateLabels(opts.Labels); err != nil {
+		log.Fatalf("Invalid --container-label: %v", err)
+	}
+	config.Container.Labels = append(config.Container.Labels, opts.Labels...)
+	if err := validateTmpfs(opts.Tmpfs); err != nil {
+		log.Fatalf("Invalid --tmpfs: %v", err)
+	}
+	config.Container.Tmpfs = append(config.Container.Tmpfs, opts.Tmpfs...)
 
-	// Clone repository
-	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", actionRef.Owner, actionRef.Repo)
-	fmt.Printf("      Cloning action: %s@%s\n", repoURL, actionRef.Ref)
+	// Re-run on changes until interrupted
+	if opts.Watch {
+		watchWorkflow(opts, config)
+		return
+	}
 
-	// Clone with specific ref
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", actionRef.Ref, repoURL, actionDir)
-	cmd.Stderr = os.Stderr
+	if err := runWorkflow(opts, config); err != nil {
+		log.Print(err)
+		os.Exit(exitCode(err))
+	}
+}
 
-	if err := cmd.Run(); err != nil {
-		// If branch clone fails, try cloning and checking out the ref
-		fmt.Printf("      Branch clone failed, trying full clone and checkout...\n")
+// applyActionsCacheDir points the actions cache at dir, keeping the configured cache
+// when dir can't be created or written
+func applyActionsCacheDir(config *Config, dir string) {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = checkWritable(dir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't use actions cache directory %s, using the configured one: %v\n", dir, err)
+		return
+	}
+	config.Storage.ActionsCacheDir = dir
+}
 
-		// Remove failed directory
-		if removeErr := os.RemoveAll(actionDir); removeErr != nil {
-			fmt.Printf("      Warning: failed to remove failed directory: %v\n", removeErr)
-		}
+// loadRCArgs reads default command line arguments from an rc file, one or more per line.
+// Blank lines and lines starting with # are ignored; a missing file yields no arguments.
+// Only workflow runs use them, as the other subcommands have flags of their own.
+func loadRCArgs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		// Full clone
-		cmd = exec.Command("git", "clone", repoURL, actionDir)
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to clone action repository: %w", err)
+	var args []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		args = append(args, strings.Fields(line)...)
+	}
+	return args, nil
+}
 
-		// Checkout specific ref
-		cmd = exec.Command("git", "checkout", actionRef.Ref)
-		cmd.Dir = actionDir
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to checkout ref %s: %w", actionRef.Ref, err)
-		}
+// applyEnvOverrides sets --env variables on top of the configuration's env
+func applyEnvOverrides(config *Config, env map[string]string) {
+	for key, value := range env {
+		config.Env[key] = value
 	}
+}
 
-	return actionDir, nil
+// applyGitHubOverrides sets the GITHUB_* variables behind the github context from --repository,
+// --ref, --sha and --actor, which win over the config, --env and the local git checkout
+func applyGitHubOverrides(config *Config, opts *Options) {
+	if opts.Repository != "" {
+		config.Env["GITHUB_REPOSITORY"] = opts.Repository
+		config.Env["GITHUB_REPOSITORY_OWNER"], _, _ = strings.Cut(opts.Repository, "/")
+	}
+	if opts.Ref != "" {
+		// The derived ref variables must describe the new ref, not one set in the config
+		refName, refType := splitRef(opts.Ref)
+		config.Env["GITHUB_REF"] = opts.Ref
+		config.Env["GITHUB_REF_NAME"] = refName
+		config.Env["GITHUB_REF_TYPE"] = refType
+	}
+	if opts.SHA != "" {
+		config.Env["GITHUB_SHA"] = opts.SHA
+	}
+	if opts.Actor != "" {
+		config.Env["GITHUB_ACTOR"] = opts.Actor
+	}
+	if opts.Event != "" {
+		// github.event_name in job and step conditions follows the event the run simulates
+		config.Env["GITHUB_EVENT_NAME"] = opts.Event
+	}
 }
 
-// executeAction executes a GitHub Action
-func executeAction(step *Step, jobDir, runnerImage string, config *Config, stepsDir string) error {
-	// Parse action reference
-	actionRef, err := parseActionRef(step.Uses)
-	if err != nil {
-		return fmt.Errorf("failed to parse action reference: %w", err)
+// runConfigCommand handles "vermont config print"
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Println("Usage: vermont config print [--redact] [--env KEY=VALUE]")
+		return fmt.Errorf("expected: config print")
 	}
 
-	// Clone action
-	actionDir, err := cloneAction(actionRef, stepsDir, jobDir)
-	if err != nil {
-		return fmt.Errorf("failed to clone action: %w", err)
+	env := make(map[string]string)
+	fs := flag.NewFlagSet("vermont config print", flag.ContinueOnError)
+	redact := fs.Bool("redact", false, "Replace env, secret and var values with ***")
+	fs.Var(envFlag(env), "env", "Set an environment variable as KEY=VALUE, or import KEY from the current environment (repeatable)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
 	}
 
-	// Read action.yml or action.yaml
-	actionFile := ""
-	for _, filename := range []string{"action.yml", "action.yaml"} {
-		path := filepath.Join(actionDir, filename)
-		if _, err := os.Stat(path); err == nil {
-			actionFile = path
-			break
-		}
+	config, err := loadConfig("config.json")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	applyEnvOverrides(config, env)
 
-	if actionFile == "" {
-		return fmt.Errorf("action.yml or action.yaml not found in action directory")
+	if *redact {
+		config = redactConfig(config)
 	}
 
-	// Parse action metadata
-	actionData, err := os.ReadFile(actionFile)
+	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to read action file: %w", err)
-	}
-
-	var actionMeta struct {
-		Runs struct {
-			Using string `yaml:"using"`
-			Main  string `yaml:"main"`
-			Steps []struct {
-				Name string                 `yaml:"name"`
-				Run  string                 `yaml:"run"`
-				Uses string                 `yaml:"uses"`
-				With map[string]interface{} `yaml:"with"`
-				Env  map[string]string      `yaml:"env"`
-				ID   string                 `yaml:"id"`
-			} `yaml:"steps"`
-		} `yaml:"runs"`
-		Inputs map[string]struct {
-			Description string `yaml:"description"`
-			Required    bool   `yaml:"required"`
-			Default     string `yaml:"default"`
-		} `yaml:"inputs"`
+		return fmt.Errorf("failed to marshal config: %w", err)
 	}
+	fmt.Println(string(data))
+	return nil
+}
 
-	if err := yaml.Unmarshal(actionData, &actionMeta); err != nil {
-		return fmt.Errorf("failed to parse action metadata: %w", err)
+// redactConfig returns a copy of the config with env, secret and var values replaced by ***
+func redactConfig(config *Config) *Config {
+	redact := func(values map[string]string) map[string]string {
+		if values == nil {
+			return nil
+		}
+		redacted := make(map[string]string, len(values))
+		for key := range values {
+			redacted[key] = "***"
+		}
+		return redacted
+	}
+
+	redacted := *config
+	redacted.Env = redact(config.Env)
+	redacted.Secrets = redact(config.Secrets)
+	redacted.Vars = redact(config.Vars)
+	if config.Environments != nil {
+		redacted.Environments = make(map[string]EnvDef, len(config.Environments))
+		for name, envDef := range config.Environments {
+			redacted.Environments[name] = EnvDef{
+				Secrets:   redact(envDef.Secrets),
+				Vars:      redact(envDef.Vars),
+				Protected: envDef.Protected,
+			}
+		}
+	}
+	return &redacted
+}
+
+// doctorCheck is a single environment check performed by "vermont doctor"
+type doctorCheck struct {
+	Name     string
+	Critical bool
+	Run      func() (detail string, remediation string, ok bool)
+}
+
+// runDoctor checks that the tools and directories Vermont relies on are available.
+// It returns false if any critical check fails.
+func runDoctor() bool {
+	checks := []doctorCheck{
+		{Name: "Docker CLI", Critical: true, Run: func() (string, string, bool) {
+			path, err := exec.LookPath("docker")
+			if err != nil {
+				return "docker not found in PATH", "Install Docker: https://docs.docker.com/get-docker/", false
+			}
+			return path, "", true
+		}},
+		{Name: "Docker daemon", Critical: true, Run: func() (string, string, bool) {
+			output, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").Output()
+			if err != nil {
+				return "cannot reach the Docker daemon", "Start Docker and check that your user may access it (e.g. is in the docker group)", false
+			}
+			return "server version " + strings.TrimSpace(string(output)), "", true
+		}},
+		{Name: "git", Critical: true, Run: func() (string, string, bool) {
+			output, err := exec.Command("git", "--version").Output()
+			if err != nil {
+				return "git not found", "Install git; it is needed to clone remote actions", false
+			}
+			return strings.TrimSpace(string(output)), "", true
+		}},
+		{Name: "Pipeline directory", Critical: true, Run: func() (string, string, bool) {
+			if err := checkWritable(pipelineBaseDir); err != nil {
+				return err.Error(), fmt.Sprintf("Make %s writable for the current user", pipelineBaseDir), false
+			}
+			return pipelineBaseDir + " is writable", "", true
+		}},
+		{Name: "Runner Dockerfiles", Critical: true, Run: func() (string, string, bool) {
+			config, err := loadConfig("config.json")
+			if err != nil {
+				return err.Error(), "Fix config.json", false
+			}
+			matches, _ := filepath.Glob(filepath.Join(config.Container.RunnersDir, "Dockerfile.*"))
+			if len(matches) == 0 {
+				return "no Dockerfile.<label> files in " + config.Container.RunnersDir, "Run Vermont from the repository root, keep runners/ next to the vermont binary or set container.runnersDir in config.json", false
+			}
+			return fmt.Sprintf("%d runner images available in %s", len(matches), config.Container.RunnersDir), "", true
+		}},
+		{Name: "Data directory", Critical: false, Run: func() (string, string, bool) {
+			path, err := runNumbersFile()
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(path), 0755)
+			}
+			if err == nil {
+				err = checkWritable(filepath.Dir(path))
+			}
+			if err != nil {
+				return err.Error(), "Run numbers won't persist; make ~/.vermont writable", false
+			}
+			return filepath.Dir(path) + " is writable", "", true
+		}},
+		{Name: "config.json", Critical: false, Run: func() (string, string, bool) {
+			if _, err := os.Stat("config.json"); err != nil {
+				return "not found in the current directory", "Defaults will be used; create config.json to set env, secrets and vars", false
+			}
+			return "found", "", true
+		}},
+	}
+
+	fmt.Println("Vermont doctor")
+	healthy := true
+	for _, check := range checks {
+		detail, remediation, ok := check.Run()
+		status := "PASS"
+		if !ok {
+			status = "WARN"
+			if check.Critical {
+				status = "FAIL"
+				healthy = false
+			}
+		}
+
+		fmt.Printf("  [%s] %s: %s\n", status, check.Name, detail)
+		if !ok && remediation != "" {
+			fmt.Printf("         %s\n", remediation)
+		}
+	}
+
+	if healthy {
+		fmt.Println("All critical checks passed")
+	} else {
+		fmt.Println("Some critical checks failed")
+	}
+	return healthy
+}
+
+// checkWritable verifies that a file can be created in dir
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".vermont-write-check-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// runActionCommand handles "vermont action <subcommand>"
+func runActionCommand(args []string) error {
+	usage := func() error {
+		fmt.Println("Usage: vermont action inspect [--strict] <owner/repo@ref | ./path/to/action>")
+		return fmt.Errorf("expected: action inspect <action>")
+	}
+	if len(args) == 0 || args[0] != "inspect" {
+		return usage()
+	}
+
+	fs := flag.NewFlagSet("vermont action inspect", flag.ContinueOnError)
+	strict := fs.Bool("strict", false, "Fail when the action's metadata has values GitHub would reject, such as invalid branding")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usage()
+	}
+	return inspectAction(fs.Arg(0), *strict)
+}
+
+// runExecCommand runs "exec [--runs-on LABEL] [--env KEY=VALUE] [-- command...]": an ad-hoc
+// command, or an interactive shell, in the runner image of a label with the current directory
+// mounted as the workspace, to see what a job's steps would find there
+func runExecCommand(args []string) error {
+	fs := flag.NewFlagSet("vermont exec", flag.ContinueOnError)
+	runsOn := fs.String("runs-on", "ubuntu-latest", "Runner label whose image the command runs in")
+	env := make(map[string]string)
+	fs.Var(envFlag(env), "env", "Set an environment variable as KEY=VALUE, or import KEY from the current environment (repeatable)")
+	fs.Usage = func() {
+		fmt.Println("Usage: vermont exec [--runs-on LABEL] [--env KEY=VALUE] [-- command [args...]]")
+		fmt.Println("Example: vermont exec --runs-on alpine-latest -- env")
+		fmt.Println("")
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Without a command, open a shell
+	command := fs.Args()
+	if len(command) == 0 {
+		command = []string{"bash"}
+	}
+
+	config, err := loadConfig("config.json")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	applyEnvOverrides(config, env)
+
+	runnerImage, err := getRunnerImage(*runsOn, config)
+	if err != nil {
+		return fmt.Errorf("failed to get runner image: %w", err)
+	}
+
+	workspace, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Steps see the same ref variables, but exec isn't a run, so it gets no run number
+	stepEnv := resolveEnv(refEnvironment(config.Env), map[string]string{"GITHUB_WORKSPACE": "/workspace"}, config.Env)
+
+	dockerArgs := []string{"run", "--rm", "-i"}
+	if stdinIsTerminal() {
+		dockerArgs = append(dockerArgs, "-t")
+	}
+	dockerArgs = append(dockerArgs,
+		"--network", "host",
+		"-v", fmt.Sprintf("%s:/workspace", workspace),
+		"--workdir", "/workspace",
+	)
+	dockerArgs = append(dockerArgs, containerRunOptions(config)...)
+	dockerArgs = append(dockerArgs, runStepEntrypoint(config)...)
+	dockerArgs = append(dockerArgs, envArgs(stepEnv)...)
+	dockerArgs = append(dockerArgs, runnerImage)
+	dockerArgs = append(dockerArgs, command...)
+
+	cmd := exec.Command("docker", dockerArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runImagesCommand runs "images [--pull] <workflow-file>": it prints the container images a
+// workflow needs, so they can be pulled before an offline run, and with --pull pulls them
+func runImagesCommand(args []string) error {
+	fs := flag.NewFlagSet("vermont images", flag.ContinueOnError)
+	pull := fs.Bool("pull", false, "Pull every listed image and build the runner images")
+	fs.Usage = func() {
+		fmt.Println("Usage: vermont images [--pull] <workflow-file>")
+		fmt.Println("")
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one workflow file")
+	}
+
+	config, err := loadConfig("config.json")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	workflow, err := loadWorkflow(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	images, err := workflowImages(workflow, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Images used by %s:\n", fs.Arg(0))
+	for _, image := range images {
+		fmt.Printf("  %s (%s)\n", image.Name, strings.Join(image.UsedBy, "; "))
+	}
+
+	if !*pull {
+		return nil
+	}
+	config.Container.PullPolicy = pullAlways
+	for _, image := range images {
+		if image.Dockerfile != "" {
+			if err := buildRunnerImage(image.Label, image.Name, config); err != nil {
+				return fmt.Errorf("failed to build runner image %s: %w", image.Name, err)
+			}
+			continue
+		}
+		if err := pullImage(image.Name, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workflowImage is an image a workflow needs and what needs it. Runner images are built from
+// a Dockerfile and have its label; every other image is pulled.
+type workflowImage struct {
+	Name       string
+	UsedBy     []string
+	Label      string
+	Dockerfile string
+}
+
+// workflowImages lists the images a workflow's jobs need after matrix expansion: the runner
+// image of each job and the base images it is built from, the images of docker:// steps and
+// those of local Docker actions, also when a local composite action uses them. Remote actions
+// aren't cloned, so their images only show up when they run.
+func workflowImages(workflow *Workflow, config *Config) ([]workflowImage, error) {
+	byName := make(map[string]*workflowImage)
+	add := func(image workflowImage, usedBy string) {
+		existing, ok := byName[image.Name]
+		if !ok {
+			existing = &image
+			byName[image.Name] = existing
+		}
+		if !contains(existing.UsedBy, usedBy) {
+			existing.UsedBy = append(existing.UsedBy, usedBy)
+		}
+	}
+	addDockerfile := func(dockerfilePath, usedBy string) error {
+		baseImages, err := dockerfileBaseImages(dockerfilePath)
+		if err != nil {
+			return err
+		}
+		for _, baseImage := range baseImages {
+			add(workflowImage{Name: baseImage}, usedBy)
+		}
+		return nil
+	}
+
+	jobs := expandMatrixJobs(workflow.Jobs)
+	jobNames := make([]string, 0, len(jobs))
+	for jobName := range jobs {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+
+	for _, jobName := range jobNames {
+		job := jobs[jobName]
+		label, err := runnerLabel(job.RunsOn, config)
+		if job.MatrixGroup != "" {
+			jobName = job.MatrixGroup // the jobs of a matrix are listed once
+		}
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", jobName, err)
+		}
+		runnerImage := fmt.Sprintf("vermont-runner:%s", label)
+		dockerfilePath := runnerDockerfilePath(label, config)
+		add(workflowImage{Name: runnerImage, Label: label, Dockerfile: dockerfilePath}, "runner of job "+jobName)
+		if err := addDockerfile(dockerfilePath, "base of "+runnerImage); err != nil {
+			return nil, fmt.Errorf("job %s: %w", jobName, err)
+		}
+
+		visited := make(map[string]bool)
+		var addSteps func(uses []string, usedBy, parentDir string) error
+		addSteps = func(uses []string, usedBy, parentDir string) error {
+			for _, ref := range uses {
+				if strings.HasPrefix(ref, "docker://") {
+					add(workflowImage{Name: strings.TrimPrefix(ref, "docker://")}, usedBy)
+					continue
+				}
+				if !strings.HasPrefix(ref, "./") {
+					continue
+				}
+				actionDir, err := localActionDir(ref, parentDir)
+				if err != nil {
+					return err
+				}
+				if visited[actionDir] {
+					continue
+				}
+				visited[actionDir] = true
+
+				meta, err := loadActionMetadata(actionDir)
+				if err != nil {
+					return err
+				}
+				switch meta.Runs.Using {
+				case "docker":
+					if strings.HasPrefix(meta.Runs.Image, "docker://") {
+						add(workflowImage{Name: strings.TrimPrefix(meta.Runs.Image, "docker://")}, "action "+ref)
+					} else if err := addDockerfile(filepath.Join(actionDir, meta.Runs.Image), "base of action "+ref); err != nil {
+						return err
+					}
+				case "composite":
+					var nested []string
+					for _, step := range meta.Runs.Steps {
+						nested = append(nested, step.Uses)
+					}
+					if err := addSteps(nested, "action "+ref, actionDir); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+
+		var uses []string
+		for _, step := range job.Steps {
+			uses = append(uses, step.Uses)
+		}
+		if err := addSteps(uses, "job "+jobName, ""); err != nil {
+			return nil, fmt.Errorf("job %s: %w", jobName, err)
+		}
+	}
+
+	images := make([]workflowImage, 0, len(byName))
+	for _, image := range byName {
+		images = append(images, *image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+// stdinIsTerminal reports whether standard input is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// inspectAction fetches an action and prints its metadata without running it
+func inspectAction(uses string, strict bool) error {
+	var actionDir string
+	if info, err := os.Stat(uses); err == nil && info.IsDir() {
+		// Local action paths don't need to start with ./ here
+		actionDir = uses
+	} else {
+		actionRef, err := parseActionRef(uses)
+		if err != nil {
+			return fmt.Errorf("failed to parse action reference: %w", err)
+		}
+
+		stepsDir, err := os.MkdirTemp("", "vermont-inspect-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(stepsDir)
+
+		actionDir, err = cloneAction(actionRef, stepsDir, filepath.Join(stepsDir, "inspect"), "", "")
+		if err != nil {
+			return fmt.Errorf("failed to clone action: %w", err)
+		}
+	}
+
+	meta, err := loadActionMetadata(actionDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Action: %s\n", uses)
+	fmt.Printf("  Name: %s\n", meta.Name)
+	if meta.Description != "" {
+		fmt.Printf("  Description: %s\n", strings.TrimSpace(meta.Description))
+	}
+
+	runtime := meta.Runs.Using
+	switch {
+	case meta.Runs.Main != "":
+		runtime += fmt.Sprintf(" (main: %s)", meta.Runs.Main)
+	case meta.Runs.Image != "":
+		runtime += fmt.Sprintf(" (image: %s)", meta.Runs.Image)
+	case len(meta.Runs.Steps) > 0:
+		runtime += fmt.Sprintf(" (%d steps)", len(meta.Runs.Steps))
+	}
+	fmt.Printf("  Runs: %s\n", runtime)
+
+	inputNames := make([]string, 0, len(meta.Inputs))
+	for name := range meta.Inputs {
+		inputNames = append(inputNames, name)
+	}
+	sort.Strings(inputNames)
+
+	fmt.Printf("  Inputs: %d\n", len(inputNames))
+	for _, name := range inputNames {
+		input := meta.Inputs[name]
+		details := "optional"
+		if input.Required {
+			details = "required"
+		}
+		if input.Type != "" {
+			details += ", " + input.Type
+		}
+		if len(input.Options) > 0 {
+			details += fmt.Sprintf(", options: %s", strings.Join(input.Options, ", "))
+		}
+		if input.Default != "" {
+			details += fmt.Sprintf(", default: %q", input.Default)
+		}
+		fmt.Printf("    %s (%s)\n", name, details)
+		if input.Description != "" {
+			fmt.Printf("      %s\n", strings.TrimSpace(input.Description))
+		}
+	}
+
+	outputNames := make([]string, 0, len(meta.Outputs))
+	for name := range meta.Outputs {
+		outputNames = append(outputNames, name)
+	}
+	sort.Strings(outputNames)
+
+	fmt.Printf("  Outputs: %d\n", len(outputNames))
+	for _, name := range outputNames {
+		fmt.Printf("    %s\n", name)
+		if description := meta.Outputs[name].Description; description != "" {
+			fmt.Printf("      %s\n", strings.TrimSpace(description))
+		}
+	}
+
+	if meta.Branding.Icon != "" || meta.Branding.Color != "" {
+		fmt.Printf("  Branding: icon %s, color %s\n", valueOrNone(meta.Branding.Icon), valueOrNone(meta.Branding.Color))
+	}
+	problems := meta.Branding.Problems()
+	for _, problem := range problems {
+		fmt.Printf("  Warning: branding %s\n", problem)
+	}
+	if strict && len(problems) > 0 {
+		return fmt.Errorf("action %s has invalid branding", uses)
+	}
+
+	return nil
+}
+
+// valueOrNone returns value, or (none) when it is empty
+func valueOrNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+// runWorkflow runs the workflow file, or every workflow in a directory one after another
+func runWorkflow(opts *Options, config *Config) error {
+	// Every step runs in a container, so there is no point starting without Docker
+	if err := checkDocker(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(opts.WorkflowFile)
+	if err != nil || !info.IsDir() {
+		return runWorkflowFile(opts.WorkflowFile, opts, config)
+	}
+
+	files, err := discoverWorkflows(opts.WorkflowFile, opts.Event)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		if opts.Event != "" {
+			return fmt.Errorf("no workflows in %s are triggered by %s", opts.WorkflowFile, opts.Event)
+		}
+		return fmt.Errorf("no workflows found in %s", opts.WorkflowFile)
+	}
+
+	// A failing workflow doesn't stop the others
+	failed, tolerated := 0, 0
+	for i, file := range files {
+		infof("\n[%d/%d] %s\n", i+1, len(files), file)
+		if err := runWorkflowFile(file, opts, config); err != nil {
+			log.Printf("Error: %v", err)
+			if errors.Is(err, errToleratedFailures) {
+				tolerated++
+			} else {
+				failed++
+			}
+		}
+	}
+
+	infof("\n%d of %d workflow(s) succeeded\n", len(files)-failed-tolerated, len(files))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d workflow(s) failed", failed, len(files))
+	}
+	if tolerated > 0 {
+		return fmt.Errorf("%d of %d workflow(s): %w", tolerated, len(files), errToleratedFailures)
+	}
+	return nil
+}
+
+// errDockerUnavailable is returned when the docker CLI is missing or the daemon can't be reached
+var errDockerUnavailable = errors.New("docker is unavailable")
+
+// checkDocker makes sure the docker CLI is installed and can reach the daemon
+func checkDocker() error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("%w: docker not found in PATH (run vermont doctor)", errDockerUnavailable)
+	}
+	if output, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: cannot reach the Docker daemon: %s", errDockerUnavailable, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// runWorkflowFile loads and executes a single workflow file
+func runWorkflowFile(workflowFile string, opts *Options, config *Config) error {
+	// Load workflow
+	workflow, err := loadWorkflow(workflowFile)
+	if err != nil {
+		return fmt.Errorf("failed to load workflow: %w", err)
+	}
+
+	// Execute workflow
+	if err := executeWorkflow(workflow, config, opts); err != nil {
+		return fmt.Errorf("failed to execute workflow: %w", err)
+	}
+
+	infof("Workflow completed successfully!\n")
+	return nil
+}
+
+// watchWorkflow runs the workflow and re-runs it whenever the workflow file or its local actions change
+func watchWorkflow(opts *Options, config *Config) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	for run := 1; ; run++ {
+		if run > 1 {
+			infof("\n%s\n", strings.Repeat("=", 60))
+			infof("Re-running workflow (run #%d)\n", run)
+			infof("%s\n\n", strings.Repeat("=", 60))
+		}
+
+		if err := runWorkflow(opts, config); err != nil {
+			log.Printf("Error: %v", err)
+		}
+
+		paths := watchedPaths(opts.WorkflowFile)
+		infof("Watching %d file(s) for changes (Ctrl-C to exit)...\n", len(paths))
+		if !waitForChanges(paths, interrupt) {
+			infof("Stopping watch mode\n")
+			return
+		}
+	}
+}
+
+// watchedPaths returns the workflow file and the metadata files of any local actions it references.
+// For a directory it covers every workflow in it, plus the directory itself to notice added files.
+func watchedPaths(workflowFile string) []string {
+	if info, err := os.Stat(workflowFile); err == nil && info.IsDir() {
+		paths := []string{workflowFile}
+		files, _ := discoverWorkflows(workflowFile, "")
+		for _, file := range files {
+			paths = append(paths, watchedPaths(file)...)
+		}
+		return paths
+	}
+
+	paths := []string{workflowFile}
+
+	workflow, err := loadWorkflow(workflowFile)
+	if err != nil {
+		return paths
+	}
+
+	seen := make(map[string]bool)
+	for _, job := range workflow.Jobs {
+		for _, step := range job.Steps {
+			if !strings.HasPrefix(step.Uses, "./") || seen[step.Uses] {
+				continue
+			}
+			seen[step.Uses] = true
+			for _, filename := range []string{"action.yml", "action.yaml"} {
+				paths = append(paths, filepath.Join(step.Uses, filename))
+			}
+		}
+	}
+
+	return paths
+}
+
+// snapshotModTimes records the modification time of each path (zero for missing files)
+func snapshotModTimes(paths []string) map[string]time.Time {
+	snapshot := make(map[string]time.Time)
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			snapshot[path] = info.ModTime()
+		} else {
+			snapshot[path] = time.Time{}
+		}
+	}
+	return snapshot
+}
+
+// waitForChanges polls the paths until one changes and settles, returning false if interrupted
+func waitForChanges(paths []string, interrupt <-chan os.Signal) bool {
+	const pollInterval = 500 * time.Millisecond
+
+	last := snapshotModTimes(paths)
+	changed := false
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-interrupt:
+			return false
+		case <-ticker.C:
+			current := snapshotModTimes(paths)
+			different := false
+			for path, modTime := range current {
+				if !modTime.Equal(last[path]) {
+					different = true
+					break
+				}
+			}
+			last = current
+
+			// Debounce rapid saves: wait for one quiet poll after the last change
+			if different {
+				changed = true
+			} else if changed {
+				return true
+			}
+		}
+	}
+}
+
+// errFlagsReported wraps flag parsing errors, which the flag set prints itself
+var errFlagsReported = errors.New("invalid flags")
+
+// parseOptions parses command line arguments, allowing flags before and after the workflow file
+func parseOptions(args []string) (*Options, error) {
+	opts := &Options{Env: make(map[string]string), Inputs: make(map[string]string)}
+	var logging logFlags
+
+	fs := flag.NewFlagSet("vermont", flag.ContinueOnError)
+	logging.register(fs)
+	fs.BoolVar(&opts.Confirm, "confirm", false, "Allow jobs that target protected environments to run")
+	fs.BoolVar(&opts.Watch, "watch", false, "Re-run the workflow when it or its local actions change")
+	fs.Var(envFlag(opts.Env), "env", "Set an environment variable as KEY=VALUE, or import KEY from the current environment (repeatable)")
+	fs.Func("input", "Set a workflow_dispatch or workflow_call input as NAME=VALUE (repeatable)", func(value string) error {
+		name, inputValue, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("expected NAME=VALUE, got %q", value)
+		}
+		opts.Inputs[name] = inputValue
+		return nil
+	})
+	fs.Func("repository", "Set github.repository (GITHUB_REPOSITORY) as owner/repo", func(value string) error {
+		owner, name, ok := strings.Cut(value, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("expected owner/repo")
+		}
+		opts.Repository = value
+		return nil
+	})
+	fs.Func("ref", "Set github.ref (GITHUB_REF), e.g. refs/heads/feature or refs/tags/v1.0; a bare name is a branch", func(value string) error {
+		if value == "" {
+			return fmt.Errorf("must not be empty")
+		}
+		if !strings.HasPrefix(value, "refs/") {
+			value = "refs/heads/" + value
+		}
+		opts.Ref = value
+		return nil
+	})
+	fs.Func("sha", "Set github.sha (GITHUB_SHA) to a commit SHA", func(value string) error {
+		if len(value) < 7 || len(value) > 40 || strings.Trim(strings.ToLower(value), "0123456789abcdef") != "" {
+			return fmt.Errorf("expected a hexadecimal commit SHA")
+		}
+		opts.SHA = value
+		return nil
+	})
+	fs.StringVar(&opts.Actor, "actor", "", "Set github.actor (GITHUB_ACTOR)")
+	fs.StringVar(&opts.AnnotationsFile, "annotations-file", "", "Write ::error::, ::warning:: and ::notice:: annotations to this file")
+	fs.StringVar(&opts.AnnotationsFormat, "annotations-format", "json", "Format of the annotations file (json or sarif)")
+	fs.StringVar(&opts.ReportFile, "report-file", "", "Write the run report to this file; the extension picks the format: "+strings.Join(reporting.Extensions(), ", "))
+	fs.StringVar(&opts.JUnitOut, "junit-out", "", "Write a JUnit XML report with one test suite per job and one test case per step to this file")
+	fs.BoolVar(&opts.NoCleanup, "no-cleanup", false, "Preserve the pipeline directory (job workspaces, GITHUB_OUTPUT/GITHUB_ENV, cloned actions)")
+	fs.StringVar(&opts.DumpEnvDir, "dump-env", "", "Write each job's final environment to <dir>/<job>.env, with secrets masked")
+	fs.BoolVar(&opts.DumpEnvUnsafe, "dump-env-unsafe", false, "Don't mask secrets in the --dump-env files")
+	fs.StringVar(&opts.ActionsCacheDir, "actions-cache-dir", "", "Keep cloned remote actions in this directory across runs (overrides storage.actionsCacheDir)")
+	fs.BoolVar(&opts.StrictExit, "strict-exit", false, "Exit with code 2 when a failure was tolerated by continue-on-error")
+	fs.BoolVar(&opts.JSONLogs, "json-logs", false, "Write step output as JSON events (time, job, step, stream, line)")
+	fs.StringVar(&opts.SinceRef, "since-ref", "", "Only run jobs whose jobPaths filter matches a file changed since this ref (git diff <ref>...HEAD)")
+	fs.Var(optionalBoolFlag{&opts.MatrixFailFast}, "matrix-fail-fast", "Override every matrix strategy's fail-fast setting (true or false)")
+	fs.StringVar(&opts.Event, "event", "", "Simulate this event (e.g. push): sets github.event_name, and a directory run only runs workflows triggered by it")
+	fs.Var((*stringsFlag)(&opts.Volumes), "volume", "Mount a host path into every step container as host:container[:ro] (repeatable)")
+	fs.Var((*stringsFlag)(&opts.Tmpfs), "tmpfs", "Mount a tmpfs into every step container as path[:options], e.g. /tmp:size=512m (repeatable)")
+	fs.Var((*stringsFlag)(&opts.Tmpfs), "container-tmpfs", "Same as --tmpfs")
+	fs.Var((*stringsFlag)(&opts.Labels), "container-label", "Add a key=value label to every container Vermont starts (repeatable)")
+	fs.IntVar(&opts.StepOutputTail, "step-output-tail", 0, "Show only the last N lines of output of steps that succeed; failed steps show everything")
+	fs.BoolVar(&opts.Trace, "trace", false, "Print the docker command of every step, with secrets masked")
+	fs.BoolVar(&opts.SkipCheckout, "skip-checkout", false, "Skip actions/checkout steps instead of cloning the repository")
+	fs.BoolVar(&opts.FixPermissions, "fix-permissions", false, "After every step, chown the job workspace to the host user in a throwaway root container")
+	fs.StringVar(&opts.ContainerUser, "container-user", "", "Run step containers as this user (docker --user, e.g. $(id -u):$(id -g))")
+	setPullPolicy := func(value string) error {
+		if err := validatePullPolicy(value); err != nil {
+			return err
+		}
+		opts.PullPolicy = value
+		return nil
+	}
+	fs.Func("container-pull-policy", "When to pull images: never, missing (default) or always (overrides container.pullPolicy)", setPullPolicy)
+	fs.Func("pull", "Shorthand for --container-pull-policy", setPullPolicy)
+	fs.StringVar(&opts.ContainerEntrypoint, "container-entrypoint", "", "Start run step containers with this entrypoint instead of none")
+	fs.Usage = func() {
+		fmt.Println("Usage: vermont [run] [options] <workflow-file | directory>")
+		fmt.Println("Example: vermont examples/parallel-test.yml")
+		fmt.Println("         vermont run --event push .github/workflows/")
+		fmt.Println("")
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %w", errFlagsReported, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != 1 {
+		fs.Usage()
+		return nil, fmt.Errorf("expected exactly one workflow file or directory")
+	}
+	opts.WorkflowFile = positional[0]
+
+	if opts.AnnotationsFormat != "json" && opts.AnnotationsFormat != "sarif" {
+		return nil, fmt.Errorf("invalid annotations format %q (expected json or sarif)", opts.AnnotationsFormat)
+	}
+	if opts.ReportFile != "" {
+		if _, err := reporting.FormatterFor(opts.ReportFile); err != nil {
+			return nil, err
+		}
+	}
+	if opts.StepOutputTail < 0 {
+		return nil, fmt.Errorf("invalid --step-output-tail %d (expected a number of lines, or 0 to show all output)", opts.StepOutputTail)
+	}
+
+	level, err := logging.resolve()
+	if err != nil {
+		return nil, err
+	}
+	opts.LogLevel = level
+
+	return opts, nil
+}
+
+func loadConfig(configFile string) (*Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(configFile)
+	switch {
+	case os.IsNotExist(err):
+		// Run with built-in defaults so workflows work without any setup
+		configWarnf("Warning: %s not found, using default configuration\n", configFile)
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+	}
+
+	if config.Env == nil {
+		config.Env = make(map[string]string)
+	}
+
+	expandConfigStrings(&config)
+
+	if config.Runner.MaxOutputBytes <= 0 {
+		config.Runner.MaxOutputBytes = defaultMaxOutputBytes
+	}
+	if config.Runner.MaxActionDepth <= 0 {
+		config.Runner.MaxActionDepth = defaultMaxActionDepth
+	}
+	config.Container.RunnersDir = resolveRunnersDir(config.Container.RunnersDir)
+	if config.Runner.BashOptions == "" {
+		config.Runner.BashOptions = defaultBashOptions
+	}
+
+	volumes, err := normalizeVolumes(config.Container.Volumes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container volume: %w", err)
+	}
+	config.Container.Volumes = volumes
+
+	if err := validateExtraHosts(config.Container.ExtraHosts); err != nil {
+		return nil, fmt.Errorf("invalid container extra host: %w", err)
+	}
+	if err := validateDNSServers(config.Container.DNS); err != nil {
+		return nil, fmt.Errorf("invalid container DNS server: %w", err)
+	}
+	if err := validateLabels(config.Container.Labels); err != nil {
+		return nil, fmt.Errorf("invalid container label: %w", err)
+	}
+	if err := validateTmpfs(config.Container.Tmpfs); err != nil {
+		return nil, fmt.Errorf("invalid container tmpfs: %w", err)
+	}
+	if config.Container.PullPolicy == "" {
+		config.Container.PullPolicy = pullMissing
+	}
+	if err := validatePullPolicy(config.Container.PullPolicy); err != nil {
+		return nil, fmt.Errorf("invalid container pull policy: %w", err)
+	}
+	if config.Container.PullRetries == nil {
+		retries := defaultPullRetries
+		config.Container.PullRetries = &retries
+	}
+	if *config.Container.PullRetries < 0 {
+		return nil, fmt.Errorf("invalid container pullRetries: must not be negative, got %d", *config.Container.PullRetries)
+	}
+	if config.Container.PullRetryBackoff <= 0 {
+		config.Container.PullRetryBackoff = defaultPullRetryBackoff
+	}
+	for jobName, patterns := range config.JobPaths {
+		for _, pattern := range patterns {
+			if err := utils.ValidateGlob(strings.TrimPrefix(pattern, "!")); err != nil {
+				return nil, fmt.Errorf("invalid jobPaths pattern %q for job %s: %w", pattern, jobName, err)
+			}
+		}
+	}
+	if len(config.SecretsCommand) > 0 && config.SecretsCommand[0] == "" {
+		return nil, fmt.Errorf("invalid secretsCommand: the program name is empty")
+	}
+
+	return &config, nil
+}
+
+// defaultRunnersDir is the runners directory name looked up when container.runnersDir isn't set
+const defaultRunnersDir = "runners"
+
+// resolveRunnersDir returns the directory runner Dockerfiles are read from. A configured
+// directory is used as given, with a leading ~ expanded. Otherwise runners/ in the current
+// directory is used, or runners/ next to the Vermont binary, so Vermont also works when it
+// is invoked from outside its repository.
+func resolveRunnersDir(configured string) string {
+	if configured != "" {
+		if configured == "~" || strings.HasPrefix(configured, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				return filepath.Join(home, strings.TrimPrefix(configured, "~"))
+			}
+		}
+		return configured
+	}
+
+	if info, err := os.Stat(defaultRunnersDir); err == nil && info.IsDir() {
+		return defaultRunnersDir
+	}
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		dir := filepath.Join(filepath.Dir(exe), defaultRunnersDir)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return defaultRunnersDir
+}
+
+// normalizeVolumes validates host:container[:ro|rw] mounts and makes host paths absolute,
+// expanding a leading ~, since docker treats a relative host path as a named volume
+func normalizeVolumes(specs []string) ([]string, error) {
+	var volumes []string
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%q must be host:container or host:container:ro", spec)
+		}
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return nil, fmt.Errorf("%q has mode %q, expected ro or rw", spec, parts[2])
+		}
+		if !strings.HasPrefix(parts[1], "/") {
+			return nil, fmt.Errorf("%q must mount to an absolute container path", spec)
+		}
+
+		host := parts[0]
+		if host == "~" || strings.HasPrefix(host, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", spec, err)
+			}
+			host = filepath.Join(home, strings.TrimPrefix(host, "~"))
+		}
+		host, err := filepath.Abs(host)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+
+		parts[0] = host
+		volumes = append(volumes, strings.Join(parts, ":"))
+	}
+	return volumes, nil
+}
+
+// validateExtraHosts checks that every entry is host:ip, where ip may also be
+// Docker's special host-gateway value
+func validateExtraHosts(entries []string) error {
+	for _, entry := range entries {
+		host, ip, ok := strings.Cut(entry, ":")
+		if !ok || host == "" || ip == "" {
+			return fmt.Errorf("%q must be host:ip", entry)
+		}
+		if ip != "host-gateway" && net.ParseIP(ip) == nil {
+			return fmt.Errorf("%q has invalid IP address %q", entry, ip)
+		}
+	}
+	return nil
+}
+
+// validateLabels checks that container labels are key=value with a non-empty key; the
+// value may be empty, as docker allows
+func validateLabels(labels []string) error {
+	for _, label := range labels {
+		key, _, ok := strings.Cut(label, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%q must be key=value", label)
+		}
+	}
+	return nil
+}
+
+// validateTmpfs checks path[:options] tmpfs mounts: the path must be absolute and may not
+// hide the workspace, and options are a comma-separated list such as size=512m,mode=1777
+func validateTmpfs(mounts []string) error {
+	for _, mount := range mounts {
+		path, options, hasOptions := strings.Cut(mount, ":")
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%q must start with an absolute container path", mount)
+		}
+		if clean := filepath.ToSlash(filepath.Clean(path)); clean == "/" || clean == "/workspace" {
+			return fmt.Errorf("%q would hide %s", mount, clean)
+		}
+		if !hasOptions {
+			continue
+		}
+		for _, option := range strings.Split(options, ",") {
+			key, value, _ := strings.Cut(option, "=")
+			if key == "" {
+				return fmt.Errorf("%q has an empty option", mount)
+			}
+			if key == "size" && !validTmpfsSize(value) {
+				return fmt.Errorf("%q has invalid size %q (expected e.g. 512m or 2g)", mount, value)
+			}
+		}
+	}
+	return nil
+}
+
+// validTmpfsSize reports whether size is a tmpfs size: bytes with an optional k, m or g unit,
+// or a percentage of memory
+func validTmpfsSize(size string) bool {
+	digits := strings.TrimRight(size, "kKmMgG%")
+	if len(size)-len(digits) > 1 {
+		return false
+	}
+	_, err := strconv.ParseUint(digits, 10, 64)
+	return err == nil
+}
+
+// validatePullPolicy checks that a pull policy is never, missing or always
+func validatePullPolicy(policy string) error {
+	switch policy {
+	case pullNever, pullMissing, pullAlways:
+		return nil
+	}
+	return fmt.Errorf("%q is not a pull policy (expected never, missing or always)", policy)
+}
+
+// validateDNSServers checks that every DNS server is an IP address
+func validateDNSServers(servers []string) error {
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("%q is not an IP address", server)
+		}
+	}
+	return nil
+}
+
+// configWarnf prints a warning about the configuration. It goes to stderr so commands like
+// "config print" keep clean output, and like warnf it is hidden below the warn level.
+func configWarnf(format string, args ...interface{}) {
+	if LogWarn <= logLevel {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// expandConfigStrings expands ${VAR} references to environment variables wherever they
+// appear in the config's env, secrets and vars, those of its environments, and its path and
+// host settings, e.g. ${HOME}/vermont. Unset variables expand to nothing, with a warning.
+// A $ without braces is kept, so values such as passwords can contain one. secretsCommand
+// and jobPaths are left alone: they are a command line and patterns, not values.
+func expandConfigStrings(config *Config) {
+	expand := func(field string, value *string) {
+		*value = expandConfigVariables(field, *value)
+	}
+	expandAll := func(field string, values []string) {
+		for i := range values {
+			expand(field, &values[i])
+		}
+	}
+	expandMap := func(field string, values map[string]string) {
+		for key, value := range values {
+			values[key] = expandConfigVariables(field+"."+key, value)
+		}
+	}
+
+	expandMap("env", config.Env)
+	expandMap("secrets", config.Secrets)
+	expandMap("vars", config.Vars)
+	for name, envDef := range config.Environments {
+		expandMap("environments."+name+".secrets", envDef.Secrets)
+		expandMap("environments."+name+".vars", envDef.Vars)
+	}
+	expand("container.registryMirror", &config.Container.RegistryMirror)
+	expand("container.runnersDir", &config.Container.RunnersDir)
+	expand("container.user", &config.Container.User)
+	expandAll("container.volumes", config.Container.Volumes)
+	expandAll("container.extraHosts", config.Container.ExtraHosts)
+	expandAll("container.dns", config.Container.DNS)
+	expandAll("container.labels", config.Container.Labels)
+	expandAll("container.tmpfs", config.Container.Tmpfs)
+	expandAll("runner.labels", config.Runner.Labels)
+	expand("storage.actionsCacheDir", &config.Storage.ActionsCacheDir)
+}
+
+// expandConfigVariables replaces each ${VAR} in a config value with the variable's value
+func expandConfigVariables(field, value string) string {
+	var result strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			break
+		}
+		length := strings.IndexByte(value[start:], '}')
+		if length == -1 {
+			break
+		}
+
+		name := value[start+2 : start+length]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			configWarnf("Warning: %s in config refers to unset variable %s\n", field, name)
+		}
+		result.WriteString(value[:start])
+		result.WriteString(envValue)
+		value = value[start+length+1:]
+	}
+	result.WriteString(value)
+	return result.String()
+}
+
+// expandEnvironmentVariables expands ${VAR} syntax in strings using shell environment
+func expandEnvironmentVariables(value string) string {
+	// Handle ${VAR} syntax
+	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+		envVar := strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")
+		if envValue := os.Getenv(envVar); envValue != "" {
+			return envValue
+		}
+		// Return original value if environment variable not found
+		return value
+	}
+	return value
+}
+
+// expandStepEnvValue expands a ${VAR} value like expandEnvironmentVariables, but looks in
+// the step's environment first, so a default such as ${GITHUB_TOKEN} picks up a variable a
+// step, job, workflow or config env sets before the process environment
+func expandStepEnvValue(value string, stepEnv map[string]string) string {
+	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+		if envValue := stepEnv[strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")]; envValue != "" {
+			return envValue
+		}
+	}
+	return expandEnvironmentVariables(value)
+}
+
+// errInvalidWorkflow is returned when a workflow can't be parsed or fails validation
+var errInvalidWorkflow = errors.New("invalid workflow")
+
+func loadWorkflow(workflowFile string) (*Workflow, error) {
+	return readWorkflow(workflowFile, false)
+}
+
+// readWorkflow loads a workflow; in strict mode keys Vermont doesn't know at the workflow,
+// job and step level are errors instead of being ignored
+func readWorkflow(workflowFile string, strict bool) (*Workflow, error) {
+	data, err := os.ReadFile(workflowFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow file: %w", err)
+	}
+
+	var workflow Workflow
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(strict)
+	if err := decoder.Decode(&workflow); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%w: failed to parse: %w", errInvalidWorkflow, unknownFieldError(err))
+	}
+
+	workflowCall, err := parseWorkflowCall(workflow.On)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidWorkflow, err)
+	}
+	workflow.WorkflowCall = workflowCall
+
+	dispatchInputs, err := parseDispatchInputs(workflow.On)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidWorkflow, err)
+	}
+	workflow.DispatchInputs = dispatchInputs
+
+	schedule, err := parseSchedule(workflow.On)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidWorkflow, err)
+	}
+	workflow.Schedule = schedule
+
+	if err := validateWorkflow(&workflow); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidWorkflow, err)
+	}
+
+	applyWorkflowDefaults(&workflow)
+
+	return &workflow, nil
+}
+
+// unknownFieldError rewords strict decoding errors to name the workflow level instead of a Go type,
+// e.g. "line 3: field job not found in workflow"
+func unknownFieldError(err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	levels := strings.NewReplacer(" in type main.Workflow", " in workflow", " in type main.Job", " in job", " in type main.Step", " in step")
+	messages := make([]string, len(typeErr.Errors))
+	for i, message := range typeErr.Errors {
+		messages[i] = levels.Replace(message)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// discoverWorkflows lists the *.yml and *.yaml files directly inside dir in name order.
+// When event is set, workflows whose on: doesn't include it are left out; workflows that
+// fail to load are kept so running them reports the error.
+func discoverWorkflows(dir, event string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		if event != "" {
+			if workflow, err := loadWorkflow(file); err == nil && !contains(workflowTriggers(workflow.On), event) {
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// workflowTriggers returns the event names in a workflow's on: (a string, list or map)
+func workflowTriggers(on interface{}) []string {
+	var events []string
+	switch v := on.(type) {
+	case string:
+		events = append(events, v)
+	case []interface{}:
+		for _, item := range v {
+			if event, ok := item.(string); ok {
+				events = append(events, event)
+			}
+		}
+	case map[string]interface{}:
+		for event := range v {
+			events = append(events, event)
+		}
+		sort.Strings(events)
+	}
+	return events
+}
+
+// parseSchedule extracts and validates the on.schedule cron expressions. Vermont doesn't run
+// workflows on a schedule; "--event schedule" runs them once, like a scheduled run would.
+func parseSchedule(on interface{}) ([]string, error) {
+	body, ok := on.(map[string]interface{})
+	if !ok || body["schedule"] == nil {
+		return nil, nil
+	}
+
+	entries, ok := body["schedule"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("on.schedule must be a list of cron entries")
+	}
+
+	var schedule []string
+	for i, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("on.schedule entry %d must set cron", i+1)
+		}
+		expr, ok := fields["cron"].(string)
+		if !ok {
+			return nil, fmt.Errorf("on.schedule entry %d must set cron", i+1)
+		}
+		if err := cron.Validate(expr); err != nil {
+			return nil, fmt.Errorf("on.schedule cron %q is invalid: %w", expr, err)
+		}
+		schedule = append(schedule, expr)
+	}
+	return schedule, nil
+}
+
+// parseWorkflowCall extracts the on.workflow_call definitions, returning nil when the
+// workflow can't be called; on: workflow_call without a body declares nothing
+func parseWorkflowCall(on interface{}) (*WorkflowCall, error) {
+	if !contains(workflowTriggers(on), "workflow_call") {
+		return nil, nil
+	}
+
+	call := &WorkflowCall{}
+	body, ok := on.(map[string]interface{})
+	if !ok || body["workflow_call"] == nil {
+		return call, nil
+	}
+
+	data, err := yaml.Marshal(body["workflow_call"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read on.workflow_call: %w", err)
+	}
+	if err := yaml.Unmarshal(data, call); err != nil {
+		return nil, fmt.Errorf("failed to parse on.workflow_call: %w", err)
+	}
+
+	for name, input := range call.Inputs {
+		switch input.Type {
+		case "boolean", "number", "string":
+		default:
+			return nil, fmt.Errorf("workflow_call input %s must have type boolean, number or string, got %q", name, input.Type)
+		}
+		if input.Default != nil {
+			if _, err := coerceWorkflowCallInput(input.Type, input.Default); err != nil {
+				return nil, fmt.Errorf("workflow_call input %s has an invalid default: %w", name, err)
+			}
+		}
+	}
+	return call, nil
+}
+
+// parseDispatchInputs extracts and validates the on.workflow_dispatch inputs. Their type is
+// optional and defaults to string; choice and environment inputs are strings too.
+func parseDispatchInputs(on interface{}) (map[string]WorkflowCallInput, error) {
+	body, ok := on.(map[string]interface{})
+	if !ok || body["workflow_dispatch"] == nil {
+		return nil, nil
+	}
+
+	data, err := yaml.Marshal(body["workflow_dispatch"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read on.workflow_dispatch: %w", err)
+	}
+	var dispatch struct {
+		Inputs map[string]WorkflowCallInput `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal(data, &dispatch); err != nil {
+		return nil, fmt.Errorf("failed to parse on.workflow_dispatch: %w", err)
+	}
+
+	for name, input := range dispatch.Inputs {
+		switch input.Type {
+		case "":
+			input.Type = "string"
+			dispatch.Inputs[name] = input
+		case "boolean", "choice", "environment", "number", "string":
+		default:
+			return nil, fmt.Errorf("workflow_dispatch input %s must have type boolean, choice, environment, number or string, got %q", name, input.Type)
+		}
+		if input.Type == "choice" && len(input.Options) == 0 {
+			return nil, fmt.Errorf("workflow_dispatch input %s has type choice but no options", name)
+		}
+		if input.Default != nil {
+			if _, err := input.Coerce(input.Default); err != nil {
+				return nil, fmt.Errorf("workflow_dispatch input %s has an invalid default: %w", name, err)
+			}
+		}
+	}
+	return dispatch.Inputs, nil
+}
+
+// workflowInputs returns the inputs context of a workflow run from the values given with
+// --input, checked against the inputs the workflow declares for workflow_dispatch and
+// workflow_call. A workflow that declares an input for both triggers uses the dispatch one.
+func workflowInputs(workflow *Workflow, given map[string]string) (map[string]interface{}, error) {
+	declared := make(map[string]WorkflowCallInput)
+	if workflow.WorkflowCall != nil {
+		for name, input := range workflow.WorkflowCall.Inputs {
+			declared[name] = input
+		}
+	}
+	for name, input := range workflow.DispatchInputs {
+		declared[name] = input
+	}
+
+	with := make(map[string]interface{}, len(given))
+	for name, value := range given {
+		with[name] = value
+	}
+	return resolveWorkflowInputs(declared, with, "the workflow")
+}
+
+// ResolveInputs validates the caller's with and secrets against the declarations and returns
+// the inputs context: every declared input, typed, with defaults for the ones not passed
+func (c *WorkflowCall) ResolveInputs(with map[string]interface{}, secrets map[string]string) (map[string]interface{}, error) {
+	names := make([]string, 0, len(c.Secrets))
+	for name := range c.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := secrets[name]; c.Secrets[name].Required && !ok {
+			return nil, fmt.Errorf("required secret %s was not passed to the called workflow", name)
+		}
+	}
+
+	return resolveWorkflowInputs(c.Inputs, with, "the called workflow")
+}
+
+// resolveWorkflowInputs checks the passed values against the declared inputs of a workflow
+// and returns every declared input, typed, with defaults for the ones not passed
+func resolveWorkflowInputs(declared map[string]WorkflowCallInput, with map[string]interface{}, target string) (map[string]interface{}, error) {
+	for name := range with {
+		if _, ok := declared[name]; !ok {
+			return nil, fmt.Errorf("input %s is not defined by %s", name, target)
+		}
+	}
+
+	inputs := make(map[string]interface{}, len(declared))
+	for name, input := range declared {
+		value, passed := with[name]
+		if !passed {
+			if input.Required && input.Default == nil {
+				return nil, fmt.Errorf("required input %s was not passed to %s", name, target)
+			}
+			value = input.Default
+		}
+		if value == nil {
+			inputs[name] = zeroWorkflowCallInput(input.Type)
+			continue
+		}
+
+		typed, err := input.Coerce(value)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", name, err)
+		}
+		inputs[name] = typed
+	}
+	return inputs, nil
+}
+
+// ResolveOutputs evaluates the declared outputs against the results of the called workflow's jobs
+func (c *WorkflowCall) ResolveOutputs(results map[string]JobResult) map[string]string {
+	jobs := make(map[string]interface{}, len(results))
+	for jobName, result := range results {
+		outputs := make(map[string]interface{}, len(result.Outputs))
+		for name, value := range result.Outputs {
+			outputs[name] = value
+		}
+		jobs[jobName] = map[string]interface{}{
+			"result":  result.Result,
+			"outputs": outputs,
+		}
+	}
+	evaluator := &expression.Evaluator{Contexts: map[string]interface{}{"jobs": jobs}}
+
+	outputs := make(map[string]string, len(c.Outputs))
+	for name, output := range c.Outputs {
+		outputs[name] = interpolateTemplates(evaluator, output.Value)
+	}
+	return outputs
+}
+
+// coerceWorkflowCallInput converts a passed or default value to the input's declared type
+func coerceWorkflowCallInput(inputType string, value interface{}) (interface{}, error) {
+	switch inputType {
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+	case "number":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	}
+	return expression.ToString(value), nil
+}
+
+// checkInputOption rejects a value that isn't one of the options of a choice input
+func checkInputOption(value string, options []string) error {
+	if !contains(options, value) {
+		return fmt.Errorf("%q is not one of the options %s", value, strings.Join(options, ", "))
+	}
+	return nil
+}
+
+// zeroWorkflowCallInput is the value of an optional input that has no default
+func zeroWorkflowCallInput(inputType string) interface{} {
+	switch inputType {
+	case "boolean":
+		return false
+	case "number":
+		return float64(0)
+	}
+	return ""
+}
+
+// runValidateCommand validates each workflow file, or every workflow in a directory. It prints
+// what it finds, so the error it returns is only for the exit code: errInvalidWorkflow when
+// every failing workflow is invalid or has a dependency cycle.
+func runValidateCommand(args []string) error {
+	var logging logFlags
+	fs := flag.NewFlagSet("vermont validate", flag.ContinueOnError)
+	logging.register(fs)
+	strict := fs.Bool("strict", false, "Reject workflow, job and step keys Vermont doesn't know, such as job: instead of jobs:")
+	plan := fs.Bool("plan", false, "Print the waves of jobs that can run in parallel, in execution order")
+	validateActions := fs.Bool("validate-actions", false, "Also fetch every action the workflows use (cloning remote ones) and check its metadata and required inputs")
+
+	var paths []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		paths = append(paths, args[0])
+		args = args[1:]
+	}
+
+	level, err := logging.resolve()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	logLevel = level
+
+	if len(paths) == 0 {
+		fmt.Println("Usage: vermont validate [--strict] [--plan] [--validate-actions] [--log-level LEVEL] [-v] <workflow-file | directory>...")
+		return fmt.Errorf("%w: no workflow given", errFlagsReported)
+	}
+
+	var files []string
+	for _, arg := range paths {
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := discoverWorkflows(arg, "")
+		if err != nil {
+			fmt.Printf("  [FAIL] %s: %v\n", arg, err)
+			return err
+		}
+		files = append(files, found...)
+	}
+
+	var actions *actionChecker
+	if *validateActions {
+		actions, err = newActionChecker()
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		defer actions.Close()
+	}
+
+	invalid, otherFailures := 0, 0
+	for _, file := range files {
+		waves, err := validateWorkflowFile(file, *strict, actions)
+		if err != nil {
+			fmt.Printf("  [FAIL] %s: %v\n", file, err)
+			invalid++
+			if exitCode(err) != exitInvalidWorkflow {
+				otherFailures++
+			}
+			continue
+		}
+		infof("  [PASS] %s\n", file)
+		if *plan {
+			for i, wave := range waves {
+				fmt.Printf("    Wave %d: %s\n", i+1, strings.Join(wave, ", "))
+			}
+		}
+	}
+
+	fmt.Printf("%d of %d workflow(s) valid\n", len(files)-invalid, len(files))
+	switch {
+	case otherFailures > 0:
+		// Such as a missing dependency or a problem with an action, which fail a run with 1 too
+		return fmt.Errorf("%d of %d workflow(s) failed validation", invalid, len(files))
+	case invalid > 0:
+		return fmt.Errorf("%d of %d workflow(s): %w", invalid, len(files), errInvalidWorkflow)
+	}
+	return nil
+}
+
+// validateWorkflowFile runs the checks that happen before a workflow's jobs start and
+// returns the waves its jobs run in. With an actionChecker the actions the workflow uses
+// are resolved and checked too.
+func validateWorkflowFile(workflowFile string, strict bool, actions *actionChecker) ([][]string, error) {
+	workflow, err := readWorkflow(workflowFile, strict)
+	if err != nil {
+		return nil, err
+	}
+	debugf("  %s: %d job(s), triggers: %s\n", workflowFile, len(workflow.Jobs), strings.Join(workflowTriggers(workflow.On), ", "))
+	for _, expr := range workflow.Schedule {
+		debugf("  %s: schedule %q\n", workflowFile, expr)
+	}
+	// Dependencies are checked after matrix expansion, the same way a run checks them
+	jobs := expandMatrixJobs(workflow.Jobs)
+	groups := matrixGroups(jobs)
+	if err := validateJobDependencies(jobs, groups); err != nil {
+		return nil, fmt.Errorf("dependency validation failed: %w", err)
+	}
+	waves, err := executionWaves(jobs, groups)
+	if err != nil {
+		return nil, err
+	}
+	if actions != nil {
+		if problems := actions.checkJobs(jobs); len(problems) > 0 {
+			return nil, problems
+		}
+	}
+	return waves, nil
+}
+
+// actionChecker resolves the actions workflows use for validate --validate-actions. Each
+// action is fetched once per validate run, into a temporary directory removed by Close.
+type actionChecker struct {
+	stepsDir string
+	actions  map[string]checkedAction
+}
+
+// checkedAction is a resolved action, or the reason it couldn't be used
+type checkedAction struct {
+	dir  string
+	meta *ActionMetadata
+	err  error
+}
+
+// actionProblems lists everything wrong with the actions a workflow uses
+type actionProblems []string
+
+func (p actionProblems) Error() string {
+	return fmt.Sprintf("%d problem(s) with the actions it uses:\n    %s", len(p), strings.Join(p, "\n    "))
+}
+
+func newActionChecker() (*actionChecker, error) {
+	stepsDir, err := os.MkdirTemp("", "vermont-validate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	return &actionChecker{stepsDir: stepsDir, actions: make(map[string]checkedAction)}, nil
+}
+
+// Close removes the actions fetched for validation
+func (c *actionChecker) Close() {
+	os.RemoveAll(c.stepsDir)
+}
+
+// checkJobs checks the actions of every step of the (matrix expanded) jobs. The jobs of a
+// matrix are reported under the matrix job's name, once.
+func (c *actionChecker) checkJobs(jobs map[string]*Job) actionProblems {
+	jobNames := make([]string, 0, len(jobs))
+	for jobName := range jobs {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+
+	var problems actionProblems
+	reported := make(map[string]bool)
+	visited := make(map[string]bool)
+	for _, jobName := range jobNames {
+		job := jobs[jobName]
+		if job.MatrixGroup != "" {
+			jobName = job.MatrixGroup
+		}
+		for _, problem := range c.checkSteps("job "+jobName, job.Steps, "", visited) {
+			if !reported[problem] {
+				reported[problem] = true
+				problems = append(problems, problem)
+			}
+		}
+	}
+	return problems
+}
+
+// checkSteps resolves the action of each step and checks the inputs the step passes it,
+// following composite actions into their own steps once (visited)
+func (c *actionChecker) checkSteps(context string, steps []*Step, parentDir string, visited map[string]bool) []string {
+	var problems []string
+	for i, step := range steps {
+		// docker:// steps, registered handlers and references built from expressions
+		// have no action.yml to check
+		if step.Uses == "" || strings.HasPrefix(step.Uses, "docker://") || findActionHandler(step.Uses) != nil || strings.Contains(step.Uses, "${{") {
+			continue
+		}
+		where := fmt.Sprintf("%s step %d (%s)", context, i+1, step.Uses)
+
+		action := c.resolve(step.Uses, parentDir)
+		if action.err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", where, action.err))
+			continue
+		}
+		for _, name := range missingActionInputs(action.meta, step) {
+			problems = append(problems, fmt.Sprintf("%s: required input %s is not set", where, name))
+		}
+		if _, err := checkActionInputs(action.meta, step); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", where, err))
+		}
+
+		if action.meta.Runs.Using == "composite" && !visited[action.dir] {
+			visited[action.dir] = true
+			nested := make([]*Step, 0, len(action.meta.Runs.Steps))
+			for _, nestedStep := range action.meta.Runs.Steps {
+				nested = append(nested, &Step{Name: nestedStep.Name, Uses: nestedStep.Uses, With: nestedStep.With})
+			}
+			problems = append(problems, c.checkSteps("action "+step.Uses, nested, action.dir, visited)...)
+		}
+	}
+	return problems
+}
+
+// resolve fetches an action the way a run would and checks its metadata. Local actions
+// are looked up relative to the composite action using them (parentDir) as well.
+func (c *actionChecker) resolve(uses, parentDir string) checkedAction {
+	key := uses
+	if strings.HasPrefix(uses, "./") {
+		key = parentDir + "\x00" + uses
+	}
+	if action, ok := c.actions[key]; ok {
+		return action
+	}
+
+	var action checkedAction
+	actionRef, err := parseActionRef(uses)
+	if err == nil {
+		action.dir, err = cloneAction(actionRef, c.stepsDir, filepath.Join(c.stepsDir, "validate"), "", parentDir)
+		if err != nil {
+			err = fmt.Errorf("failed to clone action: %w", err)
+		}
+	}
+	if err == nil {
+		action.meta, err = loadActionMetadata(action.dir)
+	}
+	if err == nil {
+		err = action.meta.checkRuns()
+	}
+	action.err = err
+	c.actions[key] = action
+	return action
+}
+
+// missingActionInputs returns the required inputs without a default that a step doesn't
+// set, in name order. token and github-token default to GITHUB_TOKEN when a step runs.
+func missingActionInputs(meta *ActionMetadata, step *Step) []string {
+	var missing []string
+	for name, input := range meta.Inputs {
+		if !input.Required || input.Default != "" || name == "token" || name == "github-token" {
+			continue
+		}
+		if _, ok := step.With[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// applyWorkflowDefaults copies workflow-level defaults into jobs that don't override them
+func applyWorkflowDefaults(workflow *Workflow) {
+	for _, job := range workflow.Jobs {
+		if job.Defaults.Run.Shell == "" {
+			job.Defaults.Run.Shell = workflow.Defaults.Run.Shell
+		}
+		// Job permissions replace the workflow's entirely rather than merging with them
+		if job.Permissions == nil {
+			job.Permissions = workflow.Permissions
+		}
+	}
+}
+
+// validateWorkflow checks the workflow for structural errors
+func validateWorkflow(workflow *Workflow) error {
+	for jobName, job := range workflow.Jobs {
+		if err := validateJob(jobName, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateJob checks a single job for structural errors
+func validateJob(jobName string, job *Job) error {
+	// Step ids must be unique so step outputs don't clobber each other
+	stepIDs := make(map[string]int)
+	for i, step := range job.Steps {
+		if step.ID == "" {
+			continue
+		}
+		if first, exists := stepIDs[step.ID]; exists {
+			return fmt.Errorf("job %s: steps %d and %d have the same id %q", jobName, first, i+1, step.ID)
+		}
+		stepIDs[step.ID] = i + 1
+	}
+
+	if container := job.Container; container != nil {
+		if container.Image == "" {
+			return fmt.Errorf("job %s: container.image is required", jobName)
+		}
+		if creds := container.Credentials; creds != nil && (creds.Username == "" || creds.Password == "") {
+			return fmt.Errorf("job %s: container.credentials needs both a username and a password", jobName)
+		}
+	}
+
+	if strategy := job.Strategy; strategy != nil {
+		if strategy.MaxParallel < 0 {
+			return fmt.Errorf("job %s: max-parallel must not be negative, got %d", jobName, strategy.MaxParallel)
+		}
+		// Without a matrix the job runs once, so there is nothing to cancel or throttle
+		if strategy.Matrix == nil {
+			if strategy.FailFast != nil {
+				warnf("Warning: job %s sets strategy.fail-fast without a matrix; it has no effect\n", jobName)
+			}
+			if strategy.MaxParallel != 0 {
+				warnf("Warning: job %s sets strategy.max-parallel without a matrix; it has no effect\n", jobName)
+			}
+		}
+	}
+	return nil
+}
+
+// expandMatrixJobs takes jobs with matrix strategies and expands them into multiple jobs
+func expandMatrixJobs(jobs map[string]*Job) map[string]*Job {
+	expandedJobs := make(map[string]*Job)
+
+	for jobName, job := range jobs {
+		if job.Strategy != nil && job.Strategy.Matrix != nil {
+			// Generate all matrix combinations
+			combinations := generateMatrixCombinations(job.Strategy.Matrix, job.Strategy.MatrixKeys)
+
+			// Like GitHub, fail-fast is on unless the strategy turns it off
+			failFast := job.Strategy.FailFast == nil || *job.Strategy.FailFast
+
+			for i, combination := range combinations {
+				// Create unique job name for each matrix combination
+				matrixJobName := fmt.Sprintf("%s_%d", jobName, i)
+
+				// Clone the job
+				matrixJob := &Job{
+					RunsOn:          cloneRunsOn(job.RunsOn, combination),
+					Needs:           job.Needs,
+					Steps:           cloneSteps(job.Steps, combination),
+					If:              job.If,
+					Outputs:         job.Outputs,
+					Env:             cloneEnvVars(job.Env, combination),
+					Environment:     job.Environment,
+					ContinueOnError: ContinueOnError(substituteMatrixVars(string(job.ContinueOnError), combination)),
+					Defaults:        job.Defaults,
+					TimeoutMinutes:  job.TimeoutMinutes,
+					Permissions:     job.Permissions,
+					Container:       job.Container,
+					Matrix:          combination,
+					MatrixGroup:     jobName,
+					FailFast:        failFast,
+					MaxParallel:     job.Strategy.MaxParallel,
+				}
+
+				expandedJobs[matrixJobName] = matrixJob
+			}
+		} else {
+			// Job without matrix, just copy as-is
+			expandedJobs[jobName] = job
+		}
+	}
+
+	return expandedJobs
+}
+
+// matrixGroups maps the name of every matrix job to the names of the jobs it was expanded
+// into, including the combinations added by include, in name order
+func matrixGroups(jobs map[string]*Job) map[string][]string {
+	groups := make(map[string][]string)
+	for jobName, job := range jobs {
+		if job.MatrixGroup != "" {
+			groups[job.MatrixGroup] = append(groups[job.MatrixGroup], jobName)
+		}
+	}
+	for _, members := range groups {
+		sort.Strings(members)
+	}
+	return groups
+}
+
+// expandNeeds returns the jobs a job waits for: a dependency on a matrix job waits for
+// every job of its matrix
+func expandNeeds(needs []string, groups map[string][]string) []string {
+	var expanded []string
+	for _, dep := range needs {
+		if members, ok := groups[dep]; ok {
+			expanded = append(expanded, members...)
+		} else {
+			expanded = append(expanded, dep)
+		}
+	}
+	return expanded
+}
+
+// generateMatrixCombinations generates all possible combinations from a matrix
+// Dimensions are combined in declaration order (keyOrder) so expanded job names are stable between runs.
+func generateMatrixCombinations(matrix map[string]interface{}, keyOrder []string) []map[string]interface{} {
+	var combinations []map[string]interface{}
+
+	// Separate matrix dimensions from include/exclude directives
+	dimensions := make(map[string]interface{})
+	var includeList []map[string]interface{}
+	var excludeList []map[string]interface{}
+
+	for _, key := range orderedMatrixKeys(matrix, keyOrder) {
+		value := matrix[key]
+		switch key {
+		case "include":
+			if includes, ok := value.([]interface{}); ok {
+				for _, include := range includes {
+					if includeMap, ok := include.(map[string]interface{}); ok {
+						includeList = append(includeList, includeMap)
+					}
+				}
+			}
+		case "exclude":
+			if excludes, ok := value.([]interface{}); ok {
+				for _, exclude := range excludes {
+					if excludeMap, ok := exclude.(map[string]interface{}); ok {
+						excludeList = append(excludeList, excludeMap)
+					}
+				}
+			}
+		default:
+			dimensions[key] = value
+		}
+	}
+
+	// Get all keys and values for base dimensions
+	keys := make([]string, 0, len(dimensions))
+	values := make([][]interface{}, 0, len(dimensions))
+
+	for _, key := range orderedMatrixKeys(dimensions, keyOrder) {
+		value := dimensions[key]
+		keys = append(keys, key)
+		switch v := value.(type) {
+		case []interface{}:
+			values = append(values, v)
+		default:
+			values = append(values, []interface{}{v})
+		}
+	}
+
+	// Generate cartesian product for base dimensions
+	var generate func(int, map[string]interface{})
+	generate = func(index int, current map[string]interface{}) {
+		if index == len(keys) {
+			// Make a copy of current combination
+			combination := make(map[string]interface{})
+			for k, v := range current {
+				combination[k] = v
+			}
+
+			// Check if this combination should be excluded
+			excluded := false
+			for _, exclude := range excludeList {
+				if matchesCombination(combination, exclude) {
+					excluded = true
+					break
+				}
+			}
+
+			if !excluded {
+				combinations = append(combinations, combination)
+			}
+			return
+		}
+
+		key := keys[index]
+		for _, value := range values[index] {
+			current[key] = value
+			generate(index+1, current)
+		}
+	}
+
+	// A matrix made only of include entries has no base combinations to extend
+	if len(keys) > 0 {
+		generate(0, make(map[string]interface{}))
+	}
+
+	// Like GitHub, an include entry extends every base combination whose values it doesn't
+	// change; one that fits none of them, e.g. because it names a value no dimension has,
+	// becomes a combination of its own
+	baseCount := len(combinations)
+	for _, include := range includeList {
+		matchFound := false
+		for i := 0; i < baseCount; i++ {
+			if !matchesBaseDimensions(combinations[i], include, keys) {
+				continue
+			}
+			for k, v := range include {
+				if !contains(keys, k) {
+					combinations[i][k] = v
+				}
+			}
+			matchFound = true
+		}
+
+		if !matchFound {
+			standalone := make(map[string]interface{}, len(include))
+			for k, v := range include {
+				standalone[k] = v
+			}
+			combinations = append(combinations, standalone)
+		}
+	}
+
+	return combinations
+}
+
+// orderedMatrixKeys returns the keys of matrix in declaration order, followed by any undeclared keys sorted
+func orderedMatrixKeys(matrix map[string]interface{}, keyOrder []string) []string {
+	keys := make([]string, 0, len(matrix))
+	seen := make(map[string]bool, len(matrix))
+	for _, key := range keyOrder {
+		if _, exists := matrix[key]; exists && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	var rest []string
+	for key := range matrix {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
+
+// matchesCombination checks if a combination matches all fields in a pattern
+func matchesCombination(combination, pattern map[string]interface{}) bool {
+	for key, value := range pattern {
+		if combination[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesBaseDimensions checks if a combination matches the base dimensions of an include
+func matchesBaseDimensions(existing, include map[string]interface{}, baseDimensions []string) bool {
+	for _, dim := range baseDimensions {
+		if includeVal, exists := include[dim]; exists {
+			if existing[dim] != includeVal {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// contains checks if a slice contains a string
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneSteps clones steps and substitutes matrix variables
+func cloneSteps(steps []*Step, matrixVars map[string]interface{}) []*Step {
+	clonedSteps := make([]*Step, len(steps))
+
+	for i, step := range steps {
+		clonedSteps[i] = &Step{
+			ID:    step.ID,
+			Name:  substituteMatrixVars(step.Name, matrixVars),
+			Run:   substituteMatrixVars(step.Run, matrixVars),
+			Uses:  substituteMatrixVars(step.Uses, matrixVars),
+			If:    substituteMatrixVars(step.If, matrixVars),
+			With:  cloneWithVars(step.With, matrixVars),
+			Env:   cloneEnvVars(step.Env, matrixVars),
+			Shell: substituteMatrixVars(step.Shell, matrixVars),
+
+			TimeoutMinutes: step.TimeoutMinutes,
+
+			ContinueOnError: ContinueOnError(substituteMatrixVars(string(step.ContinueOnError), matrixVars)),
+		}
+	}
+
+	return clonedSteps
+}
+
+// cloneRunsOn clones the runs-on value and substitutes matrix variables in its labels
+func cloneRunsOn(runsOn interface{}, matrixVars map[string]interface{}) interface{} {
+	switch v := runsOn.(type) {
+	case string:
+		return substituteMatrixVars(v, matrixVars)
+	case []string:
+		cloned := make([]string, len(v))
+		for i, label := range v {
+			cloned[i] = substituteMatrixVars(label, matrixVars)
+		}
+		return cloned
+	case []interface{}:
+		cloned := make([]interface{}, len(v))
+		for i, label := range v {
+			if str, ok := label.(string); ok {
+				cloned[i] = substituteMatrixVars(str, matrixVars)
+			} else {
+				cloned[i] = label
+			}
+		}
+		return cloned
+	default:
+		return runsOn
+	}
+}
+
+// substituteMatrixVars replaces ${{ matrix.* }} expressions in strings.
+// Expressions that reference other contexts are left for later substitution.
+func substituteMatrixVars(text string, matrixVars map[string]interface{}) string {
+	evaluator := &expression.Evaluator{
+		Contexts: map[string]interface{}{"matrix": matrixVars},
+	}
+
+	result, err := expression.ReplaceFunc(text, func(expr string) (string, error) {
+		contexts, err := expression.ReferencedContexts(expr)
+		if err != nil || len(contexts) != 1 || contexts[0] != "matrix" {
+			return "${{ " + expr + " }}", nil
+		}
+
+		// Unknown matrix variables evaluate to null and become an empty string
+		value, err := evaluator.Evaluate(expr)
+		if err != nil {
+			return "", nil
+		}
+		return expression.ToString(value), nil
+	})
+	if err != nil {
+		return text
+	}
+
+	return result
+}
+
+// cloneWithVars clones and substitutes matrix vars in with map
+func cloneWithVars(with map[string]interface{}, matrixVars map[string]interface{}) map[string]interface{} {
+	if with == nil {
+		return nil
+	}
+
+	cloned := make(map[string]interface{})
+	for key, value := range with {
+		cloned[key] = substituteValueStrings(value, func(text string) string {
+			return substituteMatrixVars(text, matrixVars)
+		})
+	}
+	return cloned
+}
+
+// substituteValueStrings applies substitute to every string inside a with value, including nested maps and lists
+func substituteValueStrings(value interface{}, substitute func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return substitute(v)
+	case map[string]interface{}:
+		cloned := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			cloned[key] = substituteValueStrings(item, substitute)
+		}
+		return cloned
+	case []interface{}:
+		cloned := make([]interface{}, len(v))
+		for i, item := range v {
+			cloned[i] = substituteValueStrings(item, substitute)
+		}
+		return cloned
+	}
+	return value
+}
+
+// inputValueString converts a with value to the string an action receives as INPUT_<NAME>.
+// Strings are passed unchanged (multiline ones too), booleans as true or false, numbers in
+// plain decimal notation and objects and lists as JSON.
+func inputValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// cloneEnvVars clones and substitutes matrix vars in env map
+func cloneEnvVars(env map[string]string, matrixVars map[string]interface{}) map[string]string {
+	if env == nil {
+		return nil
+	}
+
+	cloned := make(map[string]string)
+	for key, value := range env {
+		cloned[key] = substituteMatrixVars(value, matrixVars)
+	}
+	return cloned
+}
+
+// JobContext holds the per-job values available to template substitution
+type JobContext struct {
+	JobName     string
+	Run         *RunContext
+	Environment string
+	Secrets     map[string]string
+	Vars        map[string]string
+	StepOutputs map[string]map[string]string
+	StepResults map[string]StepResult
+	// Steps holds the result of every step that ran or was skipped, in order, for reports
+	Steps       []StepResult
+	Needs       map[string]JobResult
+	Permissions *Permissions
+
+	// Workspace is the job directory steps see as /workspace, set once the job starts
+	Workspace string
+
+	// JobEnv holds the evaluated workflow env overlaid by the job's own env
+	JobEnv map[string]string
+	// Env holds the variables earlier steps exported through GITHUB_ENV
+	Env map[string]string
+
+	// ctx bounds the step that is currently running by the job and step timeouts
+	ctx context.Context
+
+	// stopToken is set while workflow command processing is paused by ::stop-commands::
+	stopMu    sync.Mutex
+	stopToken string
+
+	// legacyOutputs holds outputs the running step set with the deprecated ::set-output:: command
+	legacyMu      sync.Mutex
+	legacyOutputs map[string]string
+
+	// stepLog keeps the end of the running step's output for the JUnit report
+	stepLog *outputTail
+
+	// heldOutput holds the running step's output under --step-output-tail until it finishes
+	heldOutput *heldOutput
+
+	// actionStack holds the composite actions the running step is nested in, outermost first,
+	// and actionDirs the directories they were loaded from
+	actionStack []string
+	actionDirs  []string
+}
+
+// errActionTooDeep is returned when composite actions nest deeper than runner.maxActionDepth
+var errActionTooDeep = errors.New("composite actions are nested too deeply")
+
+// enterAction records that a composite action starts, failing when it would nest deeper than
+// runner.maxActionDepth, e.g. because the action uses itself directly or through another one
+func (c *JobContext) enterAction(uses, actionDir string, config *Config) error {
+	limit := config.Runner.MaxActionDepth
+	if limit <= 0 {
+		limit = defaultMaxActionDepth
+	}
+	if len(c.actionStack) >= limit {
+		// Show the loop when there is one rather than the whole stack
+		chain := c.actionStack
+		for i := len(c.actionStack) - 1; i >= 0; i-- {
+			if c.actionStack[i] == uses {
+				chain = c.actionStack[i:]
+				break
+			}
+		}
+		chain = append(append([]string(nil), chain...), uses)
+		return fmt.Errorf("%w: more than %d levels (runner.maxActionDepth): %s", errActionTooDeep, limit, strings.Join(chain, " -> "))
+	}
+	c.actionStack = append(c.actionStack, uses)
+	c.actionDirs = append(c.actionDirs, actionDir)
+	return nil
+}
+
+// leaveAction records that the innermost composite action finished
+func (c *JobContext) leaveAction() {
+	c.actionStack = c.actionStack[:len(c.actionStack)-1]
+	c.actionDirs = c.actionDirs[:len(c.actionDirs)-1]
+}
+
+// currentActionDir returns the directory of the composite action the running step is part
+// of, or "" for a step of the job itself
+func (c *JobContext) currentActionDir() string {
+	if c == nil || len(c.actionDirs) == 0 {
+		return ""
+	}
+	return c.actionDirs[len(c.actionDirs)-1]
+}
+
+// commandsStopped reports whether workflow commands are paused; a line equal to
+// ::<token>:: resumes them and is reported as consumed
+func (c *JobContext) commandsStopped(line string) (stopped bool, consumed bool) {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+
+	if c.stopToken == "" {
+		return false, false
+	}
+	if strings.TrimRight(line, "\r") == "::"+c.stopToken+"::" {
+		c.stopToken = ""
+		return true, true
+	}
+	return true, false
+}
+
+// stopCommands pauses workflow command processing until ::<token>:: is printed
+func (c *JobContext) stopCommands(token string) {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	c.stopToken = token
+}
+
+// setLegacyOutput records an output set by the running step with ::set-output::
+func (c *JobContext) setLegacyOutput(name, value string) {
+	c.legacyMu.Lock()
+	defer c.legacyMu.Unlock()
+	if c.legacyOutputs == nil {
+		c.legacyOutputs = make(map[string]string)
+	}
+	c.legacyOutputs[name] = value
+}
+
+// takeLegacyOutputs returns the outputs set with ::set-output:: since the last call and resets them
+func (c *JobContext) takeLegacyOutputs() map[string]string {
+	if c == nil {
+		return nil
+	}
+	c.legacyMu.Lock()
+	defer c.legacyMu.Unlock()
+	outputs := c.legacyOutputs
+	c.legacyOutputs = nil
+	return outputs
+}
+
+// containerRunOptions returns the docker run flags shared by every step container
+func containerRunOptions(config *Config) []string {
+	args := containerLabelArgs(config)
+	if config.Container.User != "" {
+		args = append(args, "--user", config.Container.User)
+	}
+	for _, volume := range config.Container.Volumes {
+		args = append(args, "-v", volume)
+	}
+	for _, mount := range config.Container.Tmpfs {
+		args = append(args, "--tmpfs", mount)
+	}
+	for _, host := range config.Container.ExtraHosts {
+		args = append(args, "--add-host", host)
+	}
+	for _, server := range config.Container.DNS {
+		args = append(args, "--dns", server)
+	}
+	return args
+}
+
+// resolveEnv merges environment layers into one map; a variable in a later layer
+// overrides the same variable in every earlier one
+func resolveEnv(layers ...map[string]string) map[string]string {
+	env := make(map[string]string)
+	for _, layer := range layers {
+		for key, value := range layer {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// envArgs returns docker -e flags for the variables, sorted by name so commands are reproducible
+func envArgs(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", key, env[key]))
+	}
+	return args
+}
+
+// stepEnv returns the environment of a step container. From lowest to highest precedence:
+// config env (including --env), workflow env, job env, variables earlier steps wrote to
+// GITHUB_ENV, then the step's env.
+func (c *JobContext) stepEnv(config *Config, step *Step) map[string]string {
+	var jobEnv, exported map[string]string
+	if c != nil {
+		jobEnv, exported = c.JobEnv, c.Env
+	}
+	return resolveEnv(config.Env, jobEnv, exported, step.Env)
+}
+
+// runStepEntrypoint returns the docker run --entrypoint flag for run steps. Without a
+// configured entrypoint the image's own is cleared, so one that wraps or ignores its
+// arguments can't interfere with the shell command.
+func runStepEntrypoint(config *Config) []string {
+	return []string{"--entrypoint=" + config.Container.StepEntrypoint}
+}
+
+// permissionsEnv returns docker -e flags exposing the job's token permissions to steps as
+// VERMONT_TOKEN_PERMISSIONS, a JSON map of scope to access level, when the workflow declares any
+func (c *JobContext) permissionsEnv() []string {
+	if c == nil || c.Permissions == nil {
+		return nil
+	}
+	data, err := json.Marshal(c.Permissions.Effective())
+	if err != nil {
+		return nil
+	}
+	return []string{"-e", "VERMONT_TOKEN_PERMISSIONS=" + string(data)}
+}
+
+// actionPermissionScopes maps well-known actions to the token scope they need
+var actionPermissionScopes = map[string]string{
+	"actions/checkout":     "contents",
+	"actions/deploy-pages": "pages",
+	"actions/labeler":      "pull-requests",
+	"actions/stale":        "issues",
+}
+
+// warnMissingPermission warns when a step uses an action whose token scope is set to none
+func warnMissingPermission(step *Step, jobCtx *JobContext) {
+	if jobCtx.Permissions == nil || step.Uses == "" {
+		return
+	}
+	action, _, _ := strings.Cut(step.Uses, "@")
+	scope, ok := actionPermissionScopes[action]
+	if !ok {
+		return
+	}
+	if jobCtx.Permissions.Effective()[scope] == "none" {
+		warnf("      Warning: %s needs the %s permission, but the job sets it to none\n", action, scope)
+	}
+}
+
+// dockerCommand creates a docker command that is killed when the current step times out.
+// Killing the docker client doesn't stop the container it started, so step containers are
+// named and force-removed by name when the step is cancelled.
+func (c *JobContext) dockerCommand(args ...string) *exec.Cmd {
+	if c == nil || c.ctx == nil {
+		c.traceDocker(args)
+		return exec.Command("docker", args...)
+	}
+	if len(args) == 0 || args[0] != "run" {
+		c.traceDocker(args)
+		return exec.CommandContext(c.ctx, "docker", args...)
+	}
+
+	name := stepContainerName()
+	args = append([]string{"run", "--name", name}, args[1:]...)
+	c.traceDocker(args)
+	cmd := exec.CommandContext(c.ctx, "docker", args...)
+	cmd.Cancel = func() error {
+		removeContainer(name)
+		return cmd.Process.Kill()
+	}
+	return cmd
+}
+
+// traceDocker prints a docker command a step is about to run when --trace is set, with
+// secrets masked, since -e arguments carry the step's environment
+func (c *JobContext) traceDocker(args []string) {
+	if c == nil || c.Run == nil || c.Run.Options == nil || !c.Run.Options.Trace {
+		return
+	}
+	mask := c.Run.Masker.Mask
+	if c.Run.Config != nil {
+		mask = c.secretMask(c.Run.Config)
+	}
+	// Mask before quoting, which would escape characters of a secret
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = mask(arg)
+		if quoted[i] == "" || strings.ContainsAny(quoted[i], " \t\n'\"\\$`") {
+			quoted[i] = strconv.Quote(quoted[i])
+		}
+	}
+	fmt.Printf("      + docker %s\n", strings.Join(quoted, " "))
+}
+
+// stepContainerCount numbers the step containers started by this process
+var stepContainerCount atomic.Int64
+
+// stepContainerName returns a container name that is unique among concurrent steps and runs
+func stepContainerName() string {
+	return fmt.Sprintf("vermont-step-%d-%d", os.Getpid(), stepContainerCount.Add(1))
+}
+
+// removeCommandRunner runs the docker rm command of removeContainer and returns its combined
+// output; tests replace it to see which containers get removed
+var removeCommandRunner = func(args []string) ([]byte, error) {
+	return exec.Command("docker", args...).CombinedOutput()
+}
+
+// removeContainer force-removes a container, stopping it first if it is still running
+func removeContainer(name string) {
+	// The container may already be gone, e.g. removed by --rm after it exited
+	if output, err := removeCommandRunner([]string{"rm", "--force", name}); err != nil && !strings.Contains(string(output), "No such container") {
+		warnf("      Warning: failed to remove container %s: %v: %s\n", name, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// StepResult records how a step finished. Outcome is the step's own result; Conclusion is
+// the result after continue-on-error, so a tolerated failure concludes as success.
+type StepResult struct {
+	Number     int    `json:"number"`
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name"`
+	Outcome    string `json:"outcome"`
+	Conclusion string `json:"conclusion"`
+}
+
+// Step outcomes and conclusions
+const (
+	StepResultSuccess = "success"
+	StepResultFailure = "failure"
+	StepResultSkipped = "skipped"
+)
+
+// newJobContext builds the job context, overlaying environment-specific secrets and vars
+func newJobContext(jobName string, job *Job, config *Config, run *RunContext, needs map[string]JobResult) *JobContext {
+	ctx := &JobContext{
+		JobName:     jobName,
+		Run:         run,
+		Environment: job.Environment.Name,
+		Secrets:     make(map[string]string),
+		Vars:        make(map[string]string),
+		StepOutputs: make(map[string]map[string]string),
+		StepResults: make(map[string]StepResult),
+		Needs:       needs,
+		Env:         make(map[string]string),
+		Permissions: job.Permissions,
+	}
+
+	for key, value := range config.Secrets {
+		ctx.Secrets[key] = value
+	}
+	for key, value := range config.Vars {
+		ctx.Vars[key] = value
+	}
+
+	// Environment-specific values take precedence over repository-level ones
+	if envDef, ok := config.Environments[ctx.Environment]; ok {
+		for key, value := range envDef.Secrets {
+			ctx.Secrets[key] = value
+		}
+		for key, value := range envDef.Vars {
+			ctx.Vars[key] = value
+		}
+	}
+
+	return ctx
+}
+
+// stepsContext builds the steps expression context from the recorded step outputs and results
+func stepsContext(ctx *JobContext) map[string]interface{} {
+	steps := make(map[string]interface{})
+	for stepID, result := range ctx.StepResults {
+		stepOutputs := make(map[string]interface{})
+		for name, value := range ctx.StepOutputs[stepID] {
+			stepOutputs[name] = value
+		}
+		steps[stepID] = map[string]interface{}{
+			"outputs":    stepOutputs,
+			"outcome":    result.Outcome,
+			"conclusion": result.Conclusion,
+		}
+	}
+	return steps
+}
+
+// recordStepResult stores the outcome and conclusion of a step; steps with an id can be
+// referred to as steps.<id>
+func (c *JobContext) recordStepResult(stepNum int, step *Step, outcome, conclusion string) {
+	result := StepResult{Number: stepNum, ID: step.ID, Name: step.Name, Outcome: outcome, Conclusion: conclusion}
+	c.Steps = append(c.Steps, result)
+	if step.ID != "" {
+		c.StepResults[step.ID] = result
+	}
+}
+
+// stepLabel names a step in messages by its number and, if it has one, its id
+func stepLabel(stepNum int, step *Step) string {
+	if step.ID != "" {
+		return fmt.Sprintf("step %d [id: %s]", stepNum, step.ID)
+	}
+	return fmt.Sprintf("step %d", stepNum)
+}
+
+// checkProtectedEnvironments ensures jobs targeting protected environments were confirmed
+func checkProtectedEnvironments(jobs map[string]*Job, config *Config, confirmed bool) error {
+	if confirmed {
+		return nil
+	}
+
+	for jobName, job := range jobs {
+		envName := job.Environment.Name
+		if envDef, ok := config.Environments[envName]; ok && envDef.Protected {
+			return fmt.Errorf("job %s targets protected environment %s (re-run with --confirm to proceed)", jobName, envName)
+		}
+	}
+	return nil
+}
+
+// secretsContext is the secrets expression context of a job. Secrets the config doesn't define
+// are fetched with the configured secrets command when an expression first reads them, and
+// every secret an expression reads is masked from then on, wherever its value ends up.
+type secretsContext struct {
+	job *JobContext
+}
+
+func (s *secretsContext) Lookup(name string) (interface{}, bool) {
+	value, ok := s.job.secret(name)
+	if !ok {
+		return nil, false
+	}
+	if s.job.Run != nil {
+		s.job.Run.Masker.Add(value)
+	}
+	return value, true
+}
+
+// secret returns the value of a job secret, matching its name case-insensitively like GitHub
+// does, or fetches it with the secrets command and keeps it for the rest of the job
+func (c *JobContext) secret(name string) (string, bool) {
+	if value, ok := c.Secrets[name]; ok {
+		return value, true
+	}
+	for key, value := range c.Secrets {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+
+	if c.Run == nil || c.Run.Secrets == nil || len(c.Run.Secrets.Command) == 0 || !isSecretName(name) {
+		return "", false
+	}
+	value, err := c.Run.Secrets.Fetch(name)
+	if err != nil {
+		// Like an undefined secret it reads as an empty string
+		return "", false
+	}
+	if c.Secrets == nil {
+		c.Secrets = make(map[string]string)
+	}
+	c.Secrets[name] = value
+	return value, true
+}
+
+// isSecretName reports whether name is a valid secret name (letters, digits and underscores)
+func isSecretName(name string) bool {
+	for i, r := range name {
+		if r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return false
+	}
+	return name != ""
+}
+
+// newActionEvaluator creates an expression evaluator for the metadata of an action: the github
+// and env contexts, the action's inputs and the outputs of the composite steps run so far
+func newActionEvaluator(inputs map[string]interface{}, stepOutputs map[string]map[string]string, env map[string]string, config *Config) *expression.Evaluator {
+	evaluator := newWorkflowEvaluator(env, config.Env)
+
+	steps := make(map[string]interface{}, len(stepOutputs))
+	for stepID, outputs := range stepOutputs {
+		steps[stepID] = map[string]interface{}{"outputs": outputs}
+	}
+	evaluator.Contexts["steps"] = steps
+	evaluator.Contexts["inputs"] = inputs
+	return evaluator
+}
+
+// substituteWorkflowTemplates evaluates the ${{ }} expressions in text against the github and env contexts
+func substituteWorkflowTemplates(text string, workflowEnv map[string]string, configEnv map[string]string) string {
+	return interpolateTemplates(newWorkflowEvaluator(workflowEnv, configEnv), text)
+}
+
+// interpolateTemplates evaluates the ${{ }} expressions in text. Like on GitHub an expression
+// that fails to evaluate is a warning rather than an error, and reads as an empty string.
+func interpolateTemplates(evaluator *expression.Evaluator, text string) string {
+	result, err := expression.ReplaceFunc(text, func(expr string) (string, error) {
+		value, err := evaluator.Evaluate(expr)
+		if err != nil {
+			warnf("      Warning: failed to evaluate '${{ %s }}': %v\n", expr, err)
+			return "", nil
+		}
+		return expression.ToString(value), nil
+	})
+	if err != nil {
+		return text
+	}
+
+	return result
+}
+
+// resolveEnvScope evaluates the env values of one scope in dependency order, so a value can
+// reference another variable of the same scope with ${{ env.NAME }}. A value that references
+// its own name reads the outer scope's value; any longer reference cycle is an error.
+func resolveEnvScope(env map[string]string, evaluator *expression.Evaluator) (map[string]string, error) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Env lookups are case-insensitive, so references are matched the same way
+	byName := make(map[string]string, len(keys))
+	for _, key := range keys {
+		byName[strings.ToUpper(key)] = key
+	}
+	deps := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		spans, err := expression.FindExpressions(env[key])
+		if err != nil {
+			continue
+		}
+		for _, span := range spans {
+			names, err := expression.ReferencedProperties(span.Expr, "env")
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				if dep, ok := byName[strings.ToUpper(name)]; ok && dep != key {
+					deps[key] = append(deps[key], dep)
+				}
+			}
+		}
+	}
+
+	// The env context starts from the outer scopes and gains each value once it is resolved
+	scoped, scopeEnv := scopedEvaluator(evaluator, nil)
+
+	resolved := make(map[string]string, len(keys))
+	visiting := make(map[string]bool)
+	var path []string
+	var resolve func(key string) error
+	resolve = func(key string) error {
+		if _, done := resolved[key]; done {
+			return nil
+		}
+		if visiting[key] {
+			start := 0
+			for path[start] != key {
+				start++
+			}
+			return fmt.Errorf("env variables reference each other in a cycle: %s -> %s", strings.Join(path[start:], " -> "), key)
+		}
+
+		visiting[key] = true
+		path = append(path, key)
+		for _, dep := range deps[key] {
+			if err := resolve(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[key] = false
+
+		resolved[key] = interpolateTemplates(scoped, env[key])
+		scopeEnv[key] = resolved[key]
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := resolve(key); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// scopedEvaluator returns a copy of the evaluator whose env context is the outer env plus the
+// given values; the returned env map can be extended as more values resolve
+func scopedEvaluator(evaluator *expression.Evaluator, env map[string]string) (*expression.Evaluator, map[string]interface{}) {
+	scopeEnv := make(map[string]interface{})
+	if outer, ok := evaluator.Contexts["env"].(map[string]interface{}); ok {
+		for key, value := range outer {
+			scopeEnv[key] = value
+		}
+	}
+	for key, value := range env {
+		scopeEnv[key] = value
+	}
+
+	contexts := make(map[string]interface{}, len(evaluator.Contexts))
+	for name, value := range evaluator.Contexts {
+		contexts[name] = value
+	}
+	contexts["env"] = scopeEnv
+	return &expression.Evaluator{Contexts: contexts, Functions: evaluator.Functions}, scopeEnv
+}
+
+// interpolateWith evaluates the ${{ }} expressions in a step's with values, strings nested in
+// lists and maps included
+func interpolateWith(with map[string]interface{}, evaluator *expression.Evaluator) map[string]interface{} {
+	if len(with) == 0 {
+		return with
+	}
+
+	resolved := make(map[string]interface{}, len(with))
+	for key, value := range with {
+		resolved[key] = substituteValueStrings(value, func(text string) string {
+			return interpolateTemplates(evaluator, text)
+		})
+	}
+	return resolved
+}
+
+// newWorkflowEvaluator creates an expression evaluator with the github and env contexts
+func newWorkflowEvaluator(workflowEnv map[string]string, configEnv map[string]string) *expression.Evaluator {
+	env := make(map[string]interface{})
+	for key, value := range workflowEnv {
+		env[key] = value
+	}
+
+	return &expression.Evaluator{
+		Contexts: map[string]interface{}{
+			"github": githubContext(configEnv),
+			"env":    env,
+		},
+	}
+}
+
+// githubContext builds the github context from GITHUB_* variables in the config and shell environment
+func githubContext(configEnv map[string]string) map[string]interface{} {
+	ctx := make(map[string]interface{})
+
+	// Shell environment first, then configuration overrides
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(key, "GITHUB_") && value != "" {
+			ctx[strings.ToLower(strings.TrimPrefix(key, "GITHUB_"))] = value
+		}
+	}
+	for key, value := range configEnv {
+		if strings.HasPrefix(key, "GITHUB_") && value != "" {
+			ctx[strings.ToLower(strings.TrimPrefix(key, "GITHUB_"))] = value
+		}
+	}
+
+	// Fallbacks for commonly referenced values
+	fallbacks := map[string]string{
+		"repository": "owner/repo",
+		"ref":        "refs/heads/main",
+		"sha":        "unknown",
+		"workspace":  "/workspace",
+	}
+	for key, value := range fallbacks {
+		if _, ok := ctx[key]; !ok {
+			ctx[key] = value
+		}
+	}
+
+	return ctx
+}
+
+// parseStepOutputs reads outputs from GITHUB_OUTPUT file
+func parseStepOutputs(githubOutputPath string) (map[string]string, error) {
+	data, err := os.ReadFile(githubOutputPath)
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return make(map[string]string), err
+	}
+
+	return envfile.ParseGitHubOutput(data), nil
+}
+
+// ActionRef represents a parsed action reference
+type ActionRef struct {
+	Owner     string
+	Repo      string
+	Ref       string // version, branch, or commit; empty means the default branch
+	IsLocal   bool
+	LocalPath string
+}
+
+// parseActionRef parses action reference like "actions/checkout@v4" or "./path/to/action".
+// A remote reference without @ref, like "actions/checkout", uses the repository's default branch.
+func parseActionRef(uses string) (*ActionRef, error) {
+	// Handle relative paths (./path/to/action)
+	if strings.HasPrefix(uses, "./") {
+		return &ActionRef{
+			IsLocal:   true,
+			LocalPath: uses,
+		}, nil
+	}
+
+	// Split by @ to get ref
+	parts := strings.Split(uses, "@")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] == "") {
+		return nil, fmt.Errorf("invalid action reference format: %s (expected owner/repo@ref)", uses)
+	}
+	if len(parts) == 1 {
+		parts = append(parts, "")
+	}
+
+	// Split owner/repo
+	ownerRepo := strings.Split(parts[0], "/")
+	if len(ownerRepo) != 2 || ownerRepo[0] == "" || ownerRepo[1] == "" {
+		return nil, fmt.Errorf("invalid action reference format: %s (expected owner/repo@ref)", uses)
+	}
+
+	return &ActionRef{
+		Owner: ownerRepo[0],
+		Repo:  ownerRepo[1],
+		Ref:   parts[1],
+	}, nil
+}
+
+// cloneAction clones an action repository to the steps directory or resolves local path
+func cloneAction(actionRef *ActionRef, stepsDir string, jobDir string, cacheDir string, parentDir string) (string, error) {
+	// Handle local actions
+	if actionRef.IsLocal {
+		actionDir, err := localActionDir(actionRef.LocalPath, parentDir)
+		if err != nil {
+			return "", err
+		}
+		infof("      Using local action: %s\n", actionDir)
+		return actionDir, nil
+	}
+
+	// Cached actions are shared by every job and run, so they are cloned once
+	if cacheDir != "" {
+		actionDir := filepath.Join(cacheDir, fmt.Sprintf("%s_%s_%s", actionRef.Owner, actionRef.Repo, actionRef.dirRef()))
+
+		// Jobs needing the same action wait for the first one's clone and reuse it, while
+		// different actions are cloned in parallel
+		unlock := lockActionClone(actionDir)
+		defer unlock()
+		if _, err := os.Stat(actionDir); err == nil {
+			infof("      Using cached action: %s\n", actionDir)
+			return actionDir, nil
+		}
+		return actionDir, cloneActionToCache(actionRef, actionDir)
+	}
+
+	// Handle remote actions - make unique per job to avoid race conditions
+	jobName := filepath.Base(jobDir)
+	actionDir := filepath.Join(stepsDir, fmt.Sprintf("%s_%s_%s_%s", actionRef.Owner, actionRef.Repo, actionRef.dirRef(), jobName))
+
+	// Check if already cloned
+	if _, err := os.Stat(actionDir); err == nil {
+		return actionDir, nil
+	}
+
+	return actionDir, actionCloner(actionRef, actionDir)
+}
+
+// dirRef returns the ref as used in clone directory names
+func (r *ActionRef) dirRef() string {
+	if r.Ref == "" {
+		return "default"
+	}
+	return r.Ref
+}
+
+// actionCloneLocks holds a mutex per cached action directory, so concurrent jobs don't clone
+// the same action into the cache at once
+var (
+	actionCloneLocksMu sync.Mutex
+	actionCloneLocks   = make(map[string]*sync.Mutex)
+)
+
+// lockActionClone locks the cache directory of one action and returns the unlock function
+func lockActionClone(actionDir string) func() {
+	actionCloneLocksMu.Lock()
+	lock, ok := actionCloneLocks[actionDir]
+	if !ok {
+		lock = &sync.Mutex{}
+		actionCloneLocks[actionDir] = lock
+	}
+	actionCloneLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// cloneActionToCache clones an action next to its cache directory and renames the clone
+// into place once it is complete. An interrupted clone is never mistaken for a cached
+// action, and when another Vermont process sharing the cache finished the same action
+// first, its clone is kept and this one discarded.
+func cloneActionToCache(actionRef *ActionRef, actionDir string) error {
+	if err := os.MkdirAll(filepath.Dir(actionDir), 0755); err != nil {
+		return fmt.Errorf("failed to create actions cache directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(actionDir), filepath.Base(actionDir)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create clone directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// git clone wants to create the directory itself
+	cloneDir := filepath.Join(tmpDir, "action")
+	if err := actionCloner(actionRef, cloneDir); err != nil {
+		return err
+	}
+	if err := os.Rename(cloneDir, actionDir); err != nil {
+		if _, statErr := os.Stat(actionDir); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to move cloned action into the cache: %w", err)
+	}
+	return nil
+}
+
+// localActionDir finds a local action. A step of a composite action (parentDir) names it
+// relative to the composite's own directory, such as ./sub-action next to its action.yml,
+// and falls back to the current directory, the repository root, where every other step's
+// local actions are, when the composite has nothing at that path.
+func localActionDir(path, parentDir string) (string, error) {
+	var nested string
+	if parentDir != "" {
+		nested = filepath.Join(parentDir, path)
+		if _, err := os.Stat(nested); err == nil {
+			return nested, nil
+		}
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	actionDir := filepath.Join(currentDir, path)
+	if _, err := os.Stat(actionDir); err == nil {
+		return actionDir, nil
+	}
+
+	if nested != "" {
+		return "", fmt.Errorf("%w: no local action at %s or %s", errActionNotFound, nested, actionDir)
+	}
+	return "", fmt.Errorf("%w: no local action at %s", errActionNotFound, actionDir)
+}
+
+// actionCloner clones an action repository into a directory; tests replace it to run without git
+var actionCloner = cloneActionRepo
+
+// cloneActionRepo clones an action repository at its ref into actionDir
+func cloneActionRepo(actionRef *ActionRef, actionDir string) error {
+	// Clone repository
+	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", actionRef.Owner, actionRef.Repo)
+
+	// Without a ref the clone checks out the repository's default branch
+	if actionRef.Ref == "" {
+		infof("      Cloning action: %s (default branch)\n", repoURL)
+		cmd := exec.Command("git", quietCommand("clone", "--depth", "1", repoURL, actionDir)...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			os.RemoveAll(actionDir)
+			return fmt.Errorf("failed to clone action repository: %w", err)
+		}
+		return nil
+	}
+
+	infof("      Cloning action: %s@%s\n", repoURL, actionRef.Ref)
+
+	// Clone with specific ref
+	cmd := exec.Command("git", quietCommand("clone", "--depth", "1", "--branch", actionRef.Ref, repoURL, actionDir)...)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		// If branch clone fails, try cloning and checking out the ref
+		infof("      Branch clone failed, trying full clone and checkout...\n")
+
+		// Remove failed directory
+		if removeErr := os.RemoveAll(actionDir); removeErr != nil {
+			warnf("      Warning: failed to remove failed directory: %v\n", removeErr)
+		}
+
+		// Full clone
+		cmd = exec.Command("git", quietCommand("clone", repoURL, actionDir)...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to clone action repository: %w", err)
+		}
+
+		// Checkout specific ref
+		cmd = exec.Command("git", quietCommand("checkout", actionRef.Ref)...)
+		cmd.Dir = actionDir
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			// A half-prepared clone must not be mistaken for a good one later
+			os.RemoveAll(actionDir)
+			return fmt.Errorf("%w: failed to checkout ref %s: %w", errActionNotFound, actionRef.Ref, err)
+		}
+	}
+
+	return nil
+}
+
+// ActionMetadata represents the contents of an action.yml file
+type ActionMetadata struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Runs        struct {
+		Using      string            `yaml:"using"`
+		Main       string            `yaml:"main"`
+		Image      string            `yaml:"image"`
+		Entrypoint string            `yaml:"entrypoint"`
+		Args       []string          `yaml:"args"`
+		Env        map[string]string `yaml:"env"`
+		Steps      []struct {
+			Name  string            `yaml:"name"`
+			Run   string            `yaml:"run"`
+			Uses  string            `yaml:"uses"`
+			With  StepWith          `yaml:"with"`
+			Env   map[string]string `yaml:"env"`
+			ID    string            `yaml:"id"`
+			Shell string            `yaml:"shell"`
+		} `yaml:"steps"`
+	} `yaml:"runs"`
+	Inputs  map[string]ActionInput `yaml:"inputs"`
+	Outputs map[string]struct {
+		Description string `yaml:"description"`
+		Value       string `yaml:"value"`
+	} `yaml:"outputs"`
+	Branding ActionBranding `yaml:"branding"`
+}
+
+// ActionInput is an input an action declares. GitHub only reads description, required and
+// default; type (boolean, choice, number or string) and the options of a choice input are a
+// convention some actions follow, and Vermont checks the values it is given against them.
+type ActionInput struct {
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required"`
+	Default     string   `yaml:"default"`
+	Type        string   `yaml:"type"`
+	Options     []string `yaml:"options"`
+}
+
+// Coerce checks a value against the input's type and options. Booleans are normalized to
+// true or false, so yes/no, on/off or 1/0 style values reach the action in one spelling.
+func (i ActionInput) Coerce(value string) (string, error) {
+	switch i.Type {
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "yes", "on":
+			return "true", nil
+		case "no", "off":
+			return "false", nil
+		}
+		b, err := coerceWorkflowCallInput("boolean", strings.TrimSpace(value))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b.(bool)), nil
+	case "number":
+		if _, err := coerceWorkflowCallInput("number", value); err != nil {
+			return "", err
+		}
+	case "choice":
+		if len(i.Options) > 0 {
+			if err := checkInputOption(value, i.Options); err != nil {
+				return "", err
+			}
+		}
+	}
+	return value, nil
+}
+
+// checkActionInputs validates the with values of an action step against the types the action
+// declares and returns the step with normalized values. Values that still hold expressions are
+// evaluated later and can't be checked here.
+func checkActionInputs(meta *ActionMetadata, step *Step) (*Step, error) {
+	if len(step.With) == 0 {
+		return step, nil
+	}
+
+	with := make(map[string]interface{}, len(step.With))
+	for name, value := range step.With {
+		with[name] = value
+		input, ok := meta.Inputs[name]
+		if !ok || input.Type == "" {
+			continue
+		}
+		text := inputValueString(value)
+		if strings.Contains(text, "${{") {
+			continue
+		}
+		coerced, err := input.Coerce(text)
+		if err != nil {
+			return nil, fmt.Errorf("input %s of %s: %w", name, step.Uses, err)
+		}
+		with[name] = coerced
+	}
+
+	checked := *step
+	checked.With = with
+	return &checked, nil
+}
+
+// ActionBranding is the icon and color an action is shown with on GitHub Marketplace
+type ActionBranding struct {
+	Icon  string `yaml:"icon"`
+	Color string `yaml:"color"`
+}
+
+// actionBrandingColors are the background colors GitHub accepts for action branding
+var actionBrandingColors = []string{"white", "black", "yellow", "blue", "green", "orange", "red", "purple", "gray-dark"}
+
+// actionBrandingIcons are the Feather icons GitHub accepts for action branding
+var actionBrandingIcons = []string{
+	"activity", "airplay", "alert-circle", "alert-octagon", "alert-triangle", "align-center",
+	"align-justify", "align-left", "align-right", "anchor", "aperture", "archive",
+	"arrow-down-circle", "arrow-down-left", "arrow-down-right", "arrow-down", "arrow-left-circle",
+	"arrow-left", "arrow-right-circle", "arrow-right", "arrow-up-circle", "arrow-up-left",
+	"arrow-up-right", "arrow-up", "at-sign", "award", "bar-chart-2", "bar-chart", "battery-charging",
+	"battery", "bell-off", "bell", "bluetooth", "bold", "book-open", "book", "bookmark", "box",
+	"briefcase", "calendar", "camera-off", "camera", "cast", "check-circle", "check-square", "check",
+	"chevron-down", "chevron-left", "chevron-right", "chevron-up", "chevrons-down", "chevrons-left",
+	"chevrons-right", "chevrons-up", "chrome", "circle", "clipboard", "clock", "cloud-drizzle",
+	"cloud-lightning", "cloud-off", "cloud-rain", "cloud-snow", "cloud", "code", "codepen",
+	"codesandbox", "command", "compass", "copy", "corner-down-left", "corner-down-right",
+	"corner-left-down", "corner-left-up", "corner-right-down", "corner-right-up", "corner-up-left",
+	"corner-up-right", "cpu", "credit-card", "crop", "crosshair", "database", "delete", "disc",
+	"dollar-sign", "download-cloud", "download", "dribbble", "droplet", "edit-2", "edit-3", "edit",
+	"external-link", "eye-off", "eye", "facebook", "fast-forward", "feather", "figma", "file-minus",
+	"file-plus", "file-text", "file", "film", "filter", "flag", "folder-minus", "folder-plus",
+	"folder", "framer", "gift", "git-branch", "git-commit", "git-merge", "git-pull-request", "github",
+	"gitlab", "globe", "grid", "hard-drive", "hash", "headphones", "heart", "help-circle", "home",
+	"image", "inbox", "info", "instagram", "italic", "layers", "layout", "life-buoy", "link-2",
+	"link", "linkedin", "list", "loader", "lock", "log-in", "log-out", "mail", "map-pin", "map",
+	"maximize-2", "maximize", "menu", "message-circle", "message-square", "mic-off", "mic",
+	"minimize-2", "minimize", "minus-circle", "minus-square", "minus", "monitor", "moon",
+	"more-horizontal", "more-vertical", "move", "music", "navigation-2", "navigation", "octagon",
+	"package", "paperclip", "pause-circle", "pause", "pen-tool", "percent", "phone-call",
+	"phone-forwarded", "phone-incoming", "phone-missed", "phone-off", "phone-outgoing", "phone",
+	"pie-chart", "play-circle", "play", "plus-circle", "plus-square", "plus", "pocket", "power",
+	"printer", "radio", "refresh-ccw", "refresh-cw", "repeat", "rewind", "rotate-ccw", "rotate-cw",
+	"rss", "save", "scissors", "search", "send", "server", "settings", "share-2", "share",
+	"shield-off", "shield", "shopping-bag", "shopping-cart", "shuffle", "sidebar", "skip-back",
+	"skip-forward", "slack", "slash", "sliders", "smartphone", "speaker", "square", "star",
+	"stop-circle", "sun", "sunrise", "sunset", "tablet", "tag", "target", "terminal", "thermometer",
+	"thumbs-down", "thumbs-up", "toggle-left", "toggle-right", "trash-2", "trash", "trello",
+	"trending-down", "trending-up", "triangle", "truck", "tv", "twitch", "twitter", "type",
+	"umbrella", "underline", "unlock", "upload-cloud", "upload", "user-check", "user-minus",
+	"user-plus", "user-x", "user", "users", "video-off", "video", "voicemail", "volume-1", "volume-2",
+	"volume-x", "volume", "watch", "wifi-off", "wifi", "wind", "x-circle", "x-square", "x", "youtube",
+	"zap-off", "zap", "zoom-in", "zoom-out",
+}
+
+// Problems lists the branding values GitHub would reject; unset values are allowed
+func (b ActionBranding) Problems() []string {
+	var problems []string
+	if b.Icon != "" && !contains(actionBrandingIcons, b.Icon) {
+		problems = append(problems, fmt.Sprintf("icon %q is not one of the Feather icons GitHub supports", b.Icon))
+	}
+	if b.Color != "" && !contains(actionBrandingColors, b.Color) {
+		problems = append(problems, fmt.Sprintf("color %q is not one of %s", b.Color, strings.Join(actionBrandingColors, ", ")))
+	}
+	return problems
+}
+
+// ActionExecutionResult represents the result of a natively handled action
+type ActionExecutionResult struct {
+	Outputs map[string]string
+}
+
+// ActionHandlerFunc handles an action reference with Go code instead of cloning and running it
+type ActionHandlerFunc func(actionRef *ActionRef, inputs map[string]interface{}, jobDir string, config *Config) (*ActionExecutionResult, error)
+
+// actionHandler pairs a uses prefix with its handler
+type actionHandler struct {
+	prefix  string
+	handler ActionHandlerFunc
+}
+
+var (
+	actionHandlersMu sync.RWMutex
+	actionHandlers   []actionHandler
+)
+
+// RegisterActionHandler registers a handler for action references starting with prefix (e.g. "mycorp/")
+func RegisterActionHandler(prefix string, fn ActionHandlerFunc) {
+	actionHandlersMu.Lock()
+	defer actionHandlersMu.Unlock()
+
+	actionHandlers = append(actionHandlers, actionHandler{prefix: prefix, handler: fn})
+}
+
+// isCheckoutAction reports whether uses refers to actions/checkout at any ref
+func isCheckoutAction(uses string) bool {
+	name, _, _ := strings.Cut(uses, "@")
+	// Owner and repository names are case-insensitive on GitHub
+	return strings.EqualFold(strings.TrimSuffix(name, "/"), "actions/checkout")
+}
+
+// findActionHandler returns the handler with the longest prefix matching uses, or nil
+func findActionHandler(uses string) ActionHandlerFunc {
+	actionHandlersMu.RLock()
+	defer actionHandlersMu.RUnlock()
+
+	var match *actionHandler
+	for i, h := range actionHandlers {
+		if strings.HasPrefix(uses, h.prefix) && (match == nil || len(h.prefix) > len(match.prefix)) {
+			match = &actionHandlers[i]
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return match.handler
+}
+
+// executeAction executes a GitHub Action and returns its outputs
+func executeAction(step *Step, jobDir, runnerImage string, config *Config, stepsDir string, jobCtx *JobContext) (map[string]string, error) {
+	// docker:// steps run an image directly, without an action repository
+	if strings.HasPrefix(step.Uses, "docker://") {
+		return executeDockerStep(step, jobDir, config, jobCtx)
+	}
+
+	if jobCtx.Run != nil && jobCtx.Run.Options != nil && jobCtx.Run.Options.SkipCheckout && isCheckoutAction(step.Uses) {
+		infof("      Skipped %s (--skip-checkout): the workspace is already the repository\n", step.Uses)
+		return nil, nil
+	}
+
+	// Parse action reference
+	actionRef, err := parseActionRef(step.Uses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse action reference: %w", err)
+	}
+
+	// Registered handlers take precedence over cloning the action
+	if handler := findActionHandler(step.Uses); handler != nil {
+		infof("      Using registered handler for: %s\n", step.Uses)
+		inputs := make(map[string]interface{})
+		for inputName, value := range step.With {
+			inputs[inputName] = value
+		}
+		result, err := handler(actionRef, inputs, jobDir, config)
+		if err != nil {
+			return nil, fmt.Errorf("action handler failed: %w", err)
+		}
+		if result == nil {
+			return nil, nil
+		}
+		return result.Outputs, nil
+	}
+
+	// Clone action
+	actionDir, err := cloneAction(actionRef, stepsDir, jobDir, config.Storage.ActionsCacheDir, jobCtx.currentActionDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone action: %w", err)
+	}
+
+	actionMeta, err := loadActionMetadata(actionDir)
+	if err != nil {
+		return nil, err
+	}
+
+	infof("      Action type: %s\n", actionMeta.Runs.Using)
+
+	step, err = checkActionInputs(actionMeta, step)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("      Action type: %s\n", actionMeta.Runs.Using)
-
 	// Handle different action types
 	switch actionMeta.Runs.Using {
 	case "composite":
-		return executeCompositeAction(&actionMeta, step, jobDir, runnerImage, config, actionDir, stepsDir)
+		return executeCompositeAction(actionMeta, step, jobDir, runnerImage, config, actionDir, stepsDir, jobCtx)
+	case "node20", "node16", "node12":
+		return executeNodeAction(actionMeta, step, jobDir, runnerImage, config, actionDir, jobCtx)
+	case "docker":
+		return executeDockerAction(actionMeta, step, jobDir, config, actionDir, jobCtx)
+	default:
+		return nil, fmt.Errorf("unsupported action type: %s", actionMeta.Runs.Using)
+	}
+}
+
+// checkRuns reports runs metadata Vermont can't execute: a missing or unsupported
+// runs.using, or the main script, image or steps that kind of action needs
+func (m *ActionMetadata) checkRuns() error {
+	switch m.Runs.Using {
 	case "node20", "node16", "node12":
-		return executeNodeAction(&actionMeta, step, jobDir, runnerImage, config, actionDir)
+		if m.Runs.Main == "" {
+			return fmt.Errorf("invalid action metadata: runs.main is required for %s actions", m.Runs.Using)
+		}
 	case "docker":
-		return fmt.Errorf("docker actions not supported yet")
+		if m.Runs.Image == "" {
+			return fmt.Errorf("invalid action metadata: runs.image is required for docker actions")
+		}
+	case "composite":
+		for i, step := range m.Runs.Steps {
+			if step.Run == "" && step.Uses == "" {
+				return fmt.Errorf("invalid action metadata: runs.steps[%d] has neither run nor uses", i)
+			}
+		}
+	case "":
+		return fmt.Errorf("invalid action metadata: runs.using is missing")
 	default:
-		return fmt.Errorf("unsupported action type: %s", actionMeta.Runs.Using)
-	}
-}
-
-// executeCompositeAction executes a composite action
-func executeCompositeAction(actionMeta interface{}, step *Step, jobDir, runnerImage string, config *Config, actionDir, stepsDir string) error {
-	meta := actionMeta.(*struct {
-		Runs struct {
-			Using string `yaml:"using"`
-			Main  string `yaml:"main"`
-			Steps []struct {
-				Name string                 `yaml:"name"`
-				Run  string                 `yaml:"run"`
-				Uses string                 `yaml:"uses"`
-				With map[string]interface{} `yaml:"with"`
-				Env  map[string]string      `yaml:"env"`
-				ID   string                 `yaml:"id"`
-			} `yaml:"steps"`
-		} `yaml:"runs"`
-		Inputs map[string]struct {
-			Description string `yaml:"description"`
-			Required    bool   `yaml:"required"`
-			Default     string `yaml:"default"`
-		} `yaml:"inputs"`
+		return fmt.Errorf("invalid action metadata: unsupported action type: %s", m.Runs.Using)
+	}
+	return nil
+}
+
+// errActionNotFound is returned when a step uses an action whose directory, metadata or ref doesn't exist
+var errActionNotFound = errors.New("action not found")
+
+// loadActionMetadata reads and parses action.yml or action.yaml from an action directory
+func loadActionMetadata(actionDir string) (*ActionMetadata, error) {
+	actionFile := ""
+	for _, filename := range []string{"action.yml", "action.yaml"} {
+		path := filepath.Join(actionDir, filename)
+		if _, err := os.Stat(path); err == nil {
+			actionFile = path
+			break
+		}
+	}
+
+	if actionFile == "" {
+		return nil, fmt.Errorf("%w: no action.yml or action.yaml in %s", errActionNotFound, actionDir)
+	}
+
+	actionData, err := os.ReadFile(actionFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read action file: %w", err)
+	}
+
+	var actionMeta ActionMetadata
+	if err := yaml.Unmarshal(actionData, &actionMeta); err != nil {
+		return nil, fmt.Errorf("failed to parse action metadata: %w", err)
+	}
+
+	return &actionMeta, nil
+}
+
+// executeCompositeAction executes a composite action and returns its declared outputs
+func executeCompositeAction(meta *ActionMetadata, step *Step, jobDir, runnerImage string, config *Config, actionDir, stepsDir string, jobCtx *JobContext) (map[string]string, error) {
+	// An action that uses itself would otherwise recurse until the process runs out of memory
+	if err := jobCtx.enterAction(step.Uses, actionDir, config); err != nil {
+		return nil, err
+	}
+	defer jobCtx.leaveAction()
+
+	// Prepare environment with input variables
+	actionEnv := make(map[string]string)
+
+	// Set inputs from step.With
+	inputs := make(map[string]interface{})
+	if step.With != nil {
+		for inputName, value := range step.With {
+			// Expand environment variables in the value
+			expandedValue := expandEnvironmentVariables(inputValueString(value))
+			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+			actionEnv[envName] = expandedValue
+			inputs[inputName] = expandedValue
+		}
+	}
+
+	// Set default values for inputs not provided in step.With
+	providedInputs := make(map[string]bool)
+	if step.With != nil {
+		for inputName := range step.With {
+			providedInputs[inputName] = true
+		}
+	}
+
+	// Add defaults from action metadata; ${VAR} defaults see the env of the step using the action
+	callerEnv := jobCtx.stepEnv(config, step)
+	for inputName, inputSpec := range meta.Inputs {
+		if !providedInputs[inputName] {
+			defaultValue := inputSpec.Default
+			// Special handling for common GitHub Actions defaults
+			if inputName == "token" && defaultValue == "" {
+				// Checkout action and many others expect GITHUB_TOKEN as default
+				defaultValue = "${GITHUB_TOKEN}"
+			}
+			if inputName == "github-token" && defaultValue == "" {
+				// GitHub script action and others expect GITHUB_TOKEN as default
+				defaultValue = "${GITHUB_TOKEN}"
+			}
+			if defaultValue != "" {
+				expandedValue := expandStepEnvValue(defaultValue, callerEnv)
+				// Also process workflow templates for default values
+				expandedValue = substituteWorkflowTemplates(expandedValue, make(map[string]string), config.Env)
+				envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+				actionEnv[envName] = expandedValue
+				inputs[inputName] = expandedValue
+			}
+		}
+	}
+
+	// Track step outputs
+	stepOutputs := make(map[string]map[string]string)
+
+	runsEnv := actionRunsEnv(meta, newActionEvaluator(inputs, nil, callerEnv, config))
+
+	// Execute each step in the composite action
+	for i, actionStep := range meta.Runs.Steps {
+		infof("        Action Step %d: %s\n", i+1, stepDisplayName(actionStep.Name, actionStep.Run, actionStep.Uses))
+
+		// Expressions in the step see the action's inputs and the outputs of its earlier steps
+		evaluator := newActionEvaluator(inputs, stepOutputs, callerEnv, config)
+		substitutedRun := interpolateTemplates(evaluator, actionStep.Run)
+		substitutedName := interpolateTemplates(evaluator, actionStep.Name)
+
+		// The env of the step that uses the composite applies to all of its steps, under their own.
+		// A nested action gets its own INPUT_* variables and runs.env, so only run steps see the
+		// composite's; both run in the job's container setup either way.
+		combinedEnv := make(map[string]string)
+		for k, v := range step.Env {
+			combinedEnv[k] = v
+		}
+		for k, v := range actionStep.Env {
+			combinedEnv[k] = interpolateTemplates(evaluator, v)
+		}
+
+		// Nested actions can take inputs and outputs of earlier steps through with
+		substitutedWith := interpolateWith(actionStep.With, evaluator)
+
+		stepToExecute := &Step{
+			ID:    actionStep.ID,
+			Name:  substitutedName,
+			Run:   substitutedRun,
+			Uses:  actionStep.Uses,
+			With:  substitutedWith,
+			Env:   combinedEnv,
+			Shell: actionStep.Shell,
+		}
+
+		if actionStep.Run != "" {
+			// Mount both job directory and action directory
+			env := resolveEnv(runsEnv, jobCtx.stepEnv(config, stepToExecute), actionEnv)
+			if err := executeActionRunStep(stepToExecute, env, jobDir, runnerImage, config, actionDir, jobCtx); err != nil {
+				return nil, fmt.Errorf("action step %d failed: %w", i+1, err)
+			}
+
+			if err := collectStepEnv(jobDir, jobCtx); err != nil {
+				warnf("        Warning: %v\n", err)
+			}
+
+			// Collect outputs after every step so they never leak into the next one
+			outputs, err := collectStepOutputs(jobDir, jobCtx)
+			if err != nil {
+				warnf("        Warning: %v\n", err)
+			} else if actionStep.ID != "" {
+				stepOutputs[actionStep.ID] = outputs
+				infof("        Step outputs: %s\n", jobCtx.Run.Masker.Mask(fmt.Sprintf("%v", outputs)))
+			}
+		} else if actionStep.Uses != "" {
+			// Recursive action call; its outputs are available to later steps like a run step's
+			nestedOutputs, err := executeAction(stepToExecute, jobDir, runnerImage, config, stepsDir, jobCtx)
+			if errors.Is(err, errActionTooDeep) {
+				return nil, err // already names every action involved
+			}
+			if err != nil {
+				return nil, fmt.Errorf("nested action step %d failed: %w", i+1, err)
+			}
+			if actionStep.ID != "" && nestedOutputs != nil {
+				stepOutputs[actionStep.ID] = nestedOutputs
+				infof("        Step outputs: %s\n", jobCtx.Run.Masker.Mask(fmt.Sprintf("%v", nestedOutputs)))
+			}
+		}
+	}
+
+	// Composite actions only have the outputs they declare, resolved from their steps
+	return resolveActionOutputs(meta, newActionEvaluator(inputs, stepOutputs, callerEnv, config), nil), nil
+}
+
+// executeNodeAction executes a Node.js action and returns the outputs it wrote to GITHUB_OUTPUT
+func executeNodeAction(meta *ActionMetadata, step *Step, jobDir, runnerImage string, config *Config, actionDir string, jobCtx *JobContext) (map[string]string, error) {
+	if err := prepareGitHubFiles(jobDir); err != nil {
+		return nil, err
+	}
+
+	// Prepare environment with input variables
+	env := make([]string, 0)
+
+	// First, collect all input names that user explicitly provided
+	userProvidedInputs := make(map[string]bool)
+	if step.With != nil {
+		for inputName := range step.With {
+			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(inputName))
+			userProvidedInputs[envName] = true
+		}
+	}
+
+	// Add the action's runs.env under the step environment (skip variables that user inputs will override)
+	inputs := actionInputs(meta, step, config)
+	evaluator := newActionEvaluator(inputs, nil, jobCtx.stepEnv(config, step), config)
+	stepEnv := resolveEnv(actionRunsEnv(meta, evaluator), jobCtx.stepEnv(config, step))
+	for key := range stepEnv {
+		if userProvidedInputs[key] {
+			debugf("      Skipping %s (will be overridden by user input)\n", key)
+			delete(stepEnv, key)
+		}
+	}
+	env = append(env, envArgs(stepEnv)...)
+	env = append(env, jobCtx.permissionsEnv()...)
+
+	// Set inputs from step.With
+	if step.With != nil {
+		for inputName, value := range step.With {
+			// Expand environment variables in the value; its expressions were evaluated with the step's
+			expandedValue := expandEnvironmentVariables(inputValueString(value))
+			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+			env = append(env, "-e", fmt.Sprintf("%s=%s", envName, expandedValue))
+		}
+	}
+
+	// Set default values for inputs not provided in step.With
+	providedInputs := make(map[string]bool)
+	if step.With != nil {
+		for inputName := range step.With {
+			providedInputs[inputName] = true
+		}
+	}
+
+	// Add defaults from action metadata
+	for inputName, inputSpec := range meta.Inputs {
+		debugf("      Checking input '%s', provided: %v\n", inputName, providedInputs[inputName])
+		if !providedInputs[inputName] {
+			defaultValue := inputSpec.Default
+			debugf("      %s input %s default: '%s'\n", step.Uses, inputName, defaultValue)
+
+			// Special handling for common GitHub Actions defaults
+			if inputName == "token" && defaultValue == "" {
+				// Checkout action and many others expect GITHUB_TOKEN as default
+				defaultValue = "${GITHUB_TOKEN}"
+			}
+			if inputName == "github-token" && defaultValue == "" {
+				// GitHub script action and others expect GITHUB_TOKEN as default
+				defaultValue = "${GITHUB_TOKEN}"
+			}
+
+			// For required inputs, we need to ensure they have a value
+			if inputSpec.Required && defaultValue == "" {
+				// Try to map to a GitHub environment variable
+				switch inputName {
+				case "token", "github-token":
+					if token, exists := stepEnv["GITHUB_TOKEN"]; exists && token != "" {
+						defaultValue = token
+					}
+				case "repository":
+					if repo, exists := stepEnv["GITHUB_REPOSITORY"]; exists && repo != "" {
+						defaultValue = repo
+					}
+				}
+			}
+
+			if defaultValue != "" {
+				expandedValue := expandStepEnvValue(defaultValue, stepEnv)
+				// Also process workflow templates for default values
+				expandedValue = substituteWorkflowTemplates(expandedValue, make(map[string]string), config.Env)
+				envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+				env = append(env, "-e", fmt.Sprintf("%s=%s", envName, expandedValue))
+				providedInputs[inputName] = true
+			}
+		}
+	}
+
+	// Generic GitHub environment variable mapping for action inputs
+	// If action requires an input that maps to a GITHUB_ environment variable, provide it automatically,
+	// from the step's environment so a GITHUB_ variable set in a step, job, workflow or config env wins
+	for inputName := range meta.Inputs {
+		if !providedInputs[inputName] {
+			// Convert input name to potential GITHUB_ environment variable name
+			// Examples: "token" -> "GITHUB_TOKEN", "github-token" -> "GITHUB_TOKEN", "repository" -> "GITHUB_REPOSITORY"
+			var githubEnvName string
+
+			// Handle common mappings
+			switch inputName {
+			case "token", "github-token":
+				githubEnvName = "GITHUB_TOKEN"
+			case "repository":
+				githubEnvName = "GITHUB_REPOSITORY"
+			case "ref":
+				githubEnvName = "GITHUB_REF"
+			case "sha":
+				githubEnvName = "GITHUB_SHA"
+			case "workspace":
+				githubEnvName = "GITHUB_WORKSPACE"
+			case "actor":
+				githubEnvName = "GITHUB_ACTOR"
+			default:
+				// For other inputs, try mapping directly
+				// Convert input-name to GITHUB_INPUT_NAME format
+				candidate := fmt.Sprintf("GITHUB_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+				// Only use if the step's environment has it
+				if _, exists := stepEnv[candidate]; exists {
+					githubEnvName = candidate
+				}
+			}
+
+			// If we found a mapping and the environment variable exists, use it
+			if githubEnvName != "" {
+				if githubValue, exists := stepEnv[githubEnvName]; exists && githubValue != "" {
+					// Check if this input wasn't already processed (avoid duplicates)
+					inputEnvName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
+					alreadySet := false
+					for i := 0; i < len(env); i += 2 {
+						if env[i] == "-e" && i+1 < len(env) && strings.HasPrefix(env[i+1], inputEnvName+"=") {
+							alreadySet = true
+							break
+						}
+					}
+
+					if !alreadySet {
+						env = append(env, "-e", fmt.Sprintf("%s=%s", inputEnvName, githubValue))
+					}
+				}
+			}
+		}
+	}
+
+	// Add GitHub Actions environment files
+	env = append(env, "-e", "GITHUB_OUTPUT=/workspace/github_output.txt")
+	env = append(env, "-e", "GITHUB_ENV=/workspace/github_env.txt")
+
+	args := []string{
+		"run", "--rm",
+		"--network", "host", // Enable network access for GitHub operations
+		"-v", fmt.Sprintf("%s:/workspace", jobDir),
+		"-v", fmt.Sprintf("%s:/action", actionDir),
+		"--workdir", "/workspace",
+	}
+	args = append(args, containerRunOptions(config)...)
+
+	// Add environment variables
+	args = append(args, env...)
+
+	// Add image
+	args = append(args, runnerImage)
+
+	// Run node with the action's main file
+	mainFile := meta.Runs.Main
+	if mainFile == "" {
+		mainFile = "index.js"
+	}
+	args = append(args, "node", filepath.Join("/action", mainFile))
+
+	// Execute command
+	cmd := jobCtx.dockerCommand(args...)
+	stdout := newStepOutputWriter(os.Stdout, jobCtx, step.Name)
+	stderr := newStepOutputWriter(os.Stderr, jobCtx, step.Name)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	written, err := collectStepOutputs(jobDir, jobCtx)
+	if err != nil {
+		return nil, err
+	}
+	return resolveActionOutputs(meta, evaluator, written), nil
+}
+
+// resolveActionOutputs combines the outputs an action wrote to GITHUB_OUTPUT with the outputs its
+// metadata declares. A declared value expression wins over a written value; declared outputs
+// without one keep the written value, and every declared output is present even if empty.
+func resolveActionOutputs(meta *ActionMetadata, evaluator *expression.Evaluator, written map[string]string) map[string]string {
+	outputs := make(map[string]string, len(written)+len(meta.Outputs))
+	for name, value := range written {
+		outputs[name] = value
+	}
+	for name, spec := range meta.Outputs {
+		if spec.Value != "" {
+			outputs[name] = interpolateTemplates(evaluator, spec.Value)
+		} else if _, ok := outputs[name]; !ok {
+			outputs[name] = ""
+		}
+	}
+	return outputs
+}
+
+// actionInputs resolves the inputs of an action step, falling back to the defaults declared in
+// the action metadata
+func actionInputs(meta *ActionMetadata, step *Step, config *Config) map[string]interface{} {
+	inputs := make(map[string]interface{})
+	for inputName, inputSpec := range meta.Inputs {
+		if inputSpec.Default != "" {
+			inputs[inputName] = substituteWorkflowTemplates(expandEnvironmentVariables(inputSpec.Default), make(map[string]string), config.Env)
+		}
+	}
+	for inputName, value := range step.With {
+		inputs[inputName] = expandEnvironmentVariables(inputValueString(value))
+	}
+	return inputs
+}
+
+// actionRunsEnv evaluates the runs.env defaults of an action, which may refer to its inputs
+// and the github context
+func actionRunsEnv(meta *ActionMetadata, evaluator *expression.Evaluator) map[string]string {
+	runsEnv := make(map[string]string, len(meta.Runs.Env))
+	for key, value := range meta.Runs.Env {
+		runsEnv[key] = interpolateTemplates(evaluator, value)
+	}
+	return runsEnv
+}
+
+// executeDockerAction builds or pulls a Docker container action and runs it with the job workspace mounted
+func executeDockerAction(meta *ActionMetadata, step *Step, jobDir string, config *Config, actionDir string, jobCtx *JobContext) (map[string]string, error) {
+	if err := prepareGitHubFiles(jobDir); err != nil {
+		return nil, err
+	}
+
+	image, err := resolveDockerActionImage(meta.Runs.Image, actionDir, config)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := actionInputs(meta, step, config)
+	inputEnv := make(map[string]string)
+	for inputName, value := range inputs {
+		inputEnv[fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))] = inputValueString(value)
+	}
+
+	// The action's runs.env is the base the caller's environment and then the inputs override;
+	// GITHUB_WORKSPACE is only a default, in case no env sets it
+	workspaceEnv := map[string]string{"GITHUB_WORKSPACE": "/workspace"}
+	evaluator := newActionEvaluator(inputs, nil, jobCtx.stepEnv(config, step), config)
+	env := envArgs(resolveEnv(workspaceEnv, actionRunsEnv(meta, evaluator), jobCtx.stepEnv(config, step), inputEnv))
+	env = append(env, jobCtx.permissionsEnv()...)
+
+	// Add GitHub Actions environment files
+	env = append(env, "-e", "GITHUB_OUTPUT=/workspace/github_output.txt")
+	env = append(env, "-e", "GITHUB_ENV=/workspace/github_env.txt")
+
+	// Mount the workspace the same way run steps see it
+	args := []string{
+		"run", "--rm",
+		"--network", "host",
+		"-v", fmt.Sprintf("%s:/workspace", jobDir),
+		"--workdir", "/workspace",
+	}
+	args = append(args, containerRunOptions(config)...)
+	if meta.Runs.Entrypoint != "" {
+		args = append(args, "--entrypoint", meta.Runs.Entrypoint)
+	}
+	args = append(args, env...)
+	args = append(args, image)
+
+	// Action args may reference inputs
+	for _, arg := range meta.Runs.Args {
+		args = append(args, interpolateTemplates(evaluator, arg))
+	}
+
+	cmd := jobCtx.dockerCommand(args...)
+	stdout := newStepOutputWriter(os.Stdout, jobCtx, step.Name)
+	stderr := newStepOutputWriter(os.Stderr, jobCtx, step.Name)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	written, err := collectStepOutputs(jobDir, jobCtx)
+	if err != nil {
+		return nil, err
+	}
+	return resolveActionOutputs(meta, evaluator, written), nil
+}
+
+// executeDockerStep runs a "uses: docker://image" step like a Docker action of that image.
+// As on GitHub, with.entrypoint overrides the image's entrypoint, with.args is split into the
+// container's arguments and every other with key is passed as an INPUT_ variable.
+func executeDockerStep(step *Step, jobDir string, config *Config, jobCtx *JobContext) (map[string]string, error) {
+	meta, dockerStep, err := dockerStepAction(step)
+	if err != nil {
+		return nil, err
+	}
+	return executeDockerAction(meta, dockerStep, jobDir, config, "", jobCtx)
+}
+
+// dockerStepAction returns the Docker action a docker:// step stands for, and the step with
+// only the with keys that become its inputs
+func dockerStepAction(step *Step) (*ActionMetadata, *Step, error) {
+	meta := &ActionMetadata{}
+	meta.Runs.Using = "docker"
+	meta.Runs.Image = step.Uses
+
+	with := make(map[string]interface{}, len(step.With))
+	for key, value := range step.With {
+		switch key {
+		case "entrypoint":
+			meta.Runs.Entrypoint = inputValueString(value)
+		case "args":
+			args, err := splitArgs(inputValueString(value))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid with.args: %w", err)
+			}
+			meta.Runs.Args = args
+		default:
+			with[key] = value
+		}
+	}
+
+	dockerStep := *step
+	dockerStep.With = with
+	return meta, &dockerStep, nil
+}
+
+// splitArgs splits a command line into arguments like a POSIX shell, without expanding
+// anything: single quotes keep their content literally, double quotes allow \" and \\
+// escapes, and a backslash outside quotes escapes the next character
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing backslash in %q", line)
+			}
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// resolveDockerActionImage returns a runnable image for a Docker action's runs.image.
+// "docker://" images are pulled; anything else is a Dockerfile path relative to the action directory.
+func resolveDockerActionImage(image, actionDir string, config *Config) (string, error) {
+	if image == "" {
+		return "", fmt.Errorf("docker action does not declare runs.image")
+	}
+
+	if strings.HasPrefix(image, "docker://") {
+		imageRef := strings.TrimPrefix(image, "docker://")
+		if err := ensureImage(imageRef, config); err != nil {
+			return "", err
+		}
+		return imageRef, nil
+	}
+
+	dockerfilePath := filepath.Join(actionDir, image)
+	if _, err := os.Stat(dockerfilePath); err != nil {
+		return "", fmt.Errorf("docker action Dockerfile not found: %s", dockerfilePath)
+	}
+
+	// Name the image after the action directory so different actions don't share a tag
+	absActionDir, err := filepath.Abs(actionDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve action directory: %w", err)
+	}
+	hash := sha256.Sum256([]byte(absActionDir))
+	imageName := fmt.Sprintf("vermont-action:%x", hash[:6])
+
+	buildFlags, err := prepareBaseImages(dockerfilePath, config)
+	if err != nil {
+		return "", err
+	}
+
+	// Always rebuild; local actions change between runs and Docker's layer cache keeps this cheap
+	infof("      Building action image: %s\n", imageName)
+	buildArgs := append(buildFlags, "-f", dockerfilePath, "-t", imageName, actionDir)
+	buildCmd := exec.Command("docker", quietCommand("build", buildArgs...)...)
+	buildCmd.Stdout = progressOutput()
+	buildCmd.Stderr = os.Stderr
+	if err := buildCmd.Run(); err != nil {
+		return "", fmt.Errorf("docker build failed for action image: %w", err)
+	}
+
+	return imageName, nil
+}
+
+// prepareGitHubFiles creates the GitHub Actions environment files in the job directory
+func prepareGitHubFiles(jobDir string) error {
+	githubOutputPath := filepath.Join(jobDir, "github_output.txt")
+	githubEnvPath := filepath.Join(jobDir, "github_env.txt")
+
+	// Create empty files if they don't exist
+	if _, err := os.Stat(githubOutputPath); os.IsNotExist(err) {
+		if err := os.WriteFile(githubOutputPath, []byte(""), 0644); err != nil {
+			return fmt.Errorf("failed to create GITHUB_OUTPUT file: %w", err)
+		}
+	}
+	if _, err := os.Stat(githubEnvPath); os.IsNotExist(err) {
+		if err := os.WriteFile(githubEnvPath, []byte(""), 0644); err != nil {
+			return fmt.Errorf("failed to create GITHUB_ENV file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// collectStepEnv reads the variables a step wrote to GITHUB_ENV into the job context, where
+// they apply to every later step, and clears the file for the next step
+func collectStepEnv(jobDir string, jobCtx *JobContext) error {
+	githubEnvPath := filepath.Join(jobDir, "github_env.txt")
+	data, err := os.ReadFile(githubEnvPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read GITHUB_ENV file: %w", err)
+	}
+
+	for key, value := range envfile.ParseGitHubOutput(data) {
+		jobCtx.Env[key] = value
+	}
+
+	if err := os.WriteFile(githubEnvPath, []byte(""), 0644); err != nil {
+		return fmt.Errorf("failed to clear GITHUB_ENV file: %w", err)
+	}
+	return nil
+}
+
+// collectStepOutputs reads the outputs written to GITHUB_OUTPUT and clears the file for the next step.
+// Outputs set with the legacy ::set-output:: command are included; GITHUB_OUTPUT wins on conflicts.
+func collectStepOutputs(jobDir string, jobCtx *JobContext) (map[string]string, error) {
+	githubOutputPath := filepath.Join(jobDir, "github_output.txt")
+	fileOutputs, err := parseStepOutputs(githubOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse step outputs: %w", err)
+	}
+
+	if err := os.WriteFile(githubOutputPath, []byte(""), 0644); err != nil {
+		return nil, fmt.Errorf("failed to clear output file: %w", err)
+	}
+
+	outputs := jobCtx.takeLegacyOutputs()
+	if outputs == nil {
+		return fileOutputs, nil
+	}
+	for name, value := range fileOutputs {
+		outputs[name] = value
+	}
+
+	return outputs, nil
+}
+
+// executeActionRunStep executes a run step within an action context
+func executeActionRunStep(step *Step, stepEnv map[string]string, jobDir, runnerImage string, config *Config, actionDir string, jobCtx *JobContext) error {
+	// Create GitHub Actions environment files
+	if err := prepareGitHubFiles(jobDir); err != nil {
+		return err
+	}
+
+	// Prepare environment variables
+	env := envArgs(stepEnv)
+	env = append(env, jobCtx.permissionsEnv()...)
+
+	// Add GitHub Actions environment files
+	env = append(env, "-e", "GITHUB_OUTPUT=/workspace/github_output.txt")
+	env = append(env, "-e", "GITHUB_ENV=/workspace/github_env.txt")
+
+	// Build docker run command with both workspace and action mounted
+	args := []string{
+		"run", "--rm",
+		"--network", "host", // Enable network access for GitHub operations
+		"-v", fmt.Sprintf("%s:/workspace", jobDir),
+		"-v", fmt.Sprintf("%s:/action", actionDir),
+		"--workdir", "/action",
+	}
+	args = append(args, containerRunOptions(config)...)
+	args = append(args, runStepEntrypoint(config)...)
+
+	// Add environment variables
+	args = append(args, env...)
+
+	// Add image
+	args = append(args, runnerImage)
+
+	// Add shell command
+	shellArgs, err := shellCommand(step.Shell, step.Run, jobDir, config)
+	if err != nil {
+		return err
+	}
+	args = append(args, shellArgs...)
+
+	// Execute command
+	cmd := jobCtx.dockerCommand(args...)
+	stdout := newStepOutputWriter(os.Stdout, jobCtx, step.Name)
+	stderr := newStepOutputWriter(os.Stderr, jobCtx, step.Name)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return cmd.Run()
+}
+
+// RunContext holds the state shared by all jobs of a single workflow run
+type RunContext struct {
+	Options     *Options
+	Config      *Config
+	Annotations *AnnotationCollector
+	Results     *ResultsStore
+	Masker      *Masker
+	Tests       *TestCollector
+	Secrets     *SecretFetcher
+
+	// ChangedFiles lists the files changed since --since-ref; nil runs every job
+	ChangedFiles []string
+
+	// Inputs is the inputs context of the run, from --input and the declared defaults
+	Inputs map[string]interface{}
+
+	// ctx is cancelled when a newer run of the same concurrency group cancels this one
+	ctx context.Context
+
+	mu                sync.Mutex
+	cancelledMatrices map[string]bool
+	toleratedFailures []string
+}
+
+// RecordToleratedFailure remembers a job or step failure that continue-on-error let pass
+func (r *RunContext) RecordToleratedFailure(description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.toleratedFailures = append(r.toleratedFailures, description)
+}
+
+// ToleratedFailures returns the failures recorded so far, in the order they happened
+func (r *RunContext) ToleratedFailures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.toleratedFailures...)
+}
+
+// matrixFailFast reports whether a failure of the matrix job cancels its siblings
+func (r *RunContext) matrixFailFast(job *Job) bool {
+	if r.Options != nil && r.Options.MatrixFailFast != nil {
+		return *r.Options.MatrixFailFast
+	}
+	return job.FailFast
+}
+
+// CancelMatrix marks the jobs of a matrix group as cancelled
+func (r *RunContext) CancelMatrix(group string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancelledMatrices[group] = true
+}
+
+// JobAffected reports whether a job runs with --since-ref: jobs without a jobPaths filter
+// always run, others only when a changed file matches the filter
+func (r *RunContext) JobAffected(jobName string, job *Job) bool {
+	if r.ChangedFiles == nil {
+		return true
+	}
+
+	// Matrix jobs share the filter of the job they were expanded from
+	name := jobName
+	if job.MatrixGroup != "" {
+		name = job.MatrixGroup
+	}
+	patterns, ok := r.Config.JobPaths[name]
+	if !ok {
+		return true
+	}
+
+	for _, file := range r.ChangedFiles {
+		if pathsMatch(patterns, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsMatch applies path filter patterns in order, like GitHub's paths filters: a file is
+// included by the last pattern that matches it, where patterns starting with ! exclude
+func pathsMatch(patterns []string, file string) bool {
+	included := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		// Patterns were validated when the config was loaded
+		if matched, _ := utils.MatchGlob(strings.TrimPrefix(pattern, "!"), file); matched {
+			included = !negated
+		}
+	}
+	return included
+}
+
+// gitChangedFiles lists the files changed between the merge base of ref and HEAD and HEAD
+func gitChangedFiles(ref string) ([]string, error) {
+	output, err := exec.Command("git", "diff", "--name-only", ref+"...HEAD", "--").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to list files changed since %s: %s", ref, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to list files changed since %s: %w", ref, err)
+	}
+
+	changed := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			changed = append(changed, line)
+		}
+	}
+	return changed, nil
+}
+
+// MatrixCancelled reports whether the matrix group of a job has been cancelled
+func (r *RunContext) MatrixCancelled(job *Job) bool {
+	if job.MatrixGroup == "" {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cancelledMatrices[job.MatrixGroup]
+}
+
+// secretsCommandTimeout bounds a single run of the secrets command
+const secretsCommandTimeout = time.Minute
+
+// SecretFetcher runs the configured secrets command on first use of a secret and caches the
+// result, including failures, for the rest of the run; it is safe for concurrent use
+type SecretFetcher struct {
+	Command []string
+
+	mu    sync.Mutex
+	cache map[string]fetchedSecret
+}
+
+type fetchedSecret struct {
+	value string
+	err   error
+}
+
+// Fetch returns the value of a secret from the secrets command
+func (f *SecretFetcher) Fetch(name string) (string, error) {
+	// Holding the lock while the command runs keeps concurrent jobs from fetching a secret twice
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cached, ok := f.cache[name]; ok {
+		return cached.value, cached.err
+	}
+	if f.cache == nil {
+		f.cache = make(map[string]fetchedSecret)
+	}
+
+	value, err := f.run(name)
+	if err != nil {
+		warnf("  Warning: failed to fetch secret %s: %v\n", name, err)
+	}
+	f.cache[name] = fetchedSecret{value: value, err: err}
+	return value, err
+}
+
+// run invokes the secrets command for one secret
+func (f *SecretFetcher) run(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretsCommandTimeout)
+	defer cancel()
+
+	debugf("  Fetching secret %s\n", name)
+	cmd := exec.CommandContext(ctx, f.Command[0], append(f.Command[1:], name)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+
+	// Commands usually end their output with a newline that isn't part of the value
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// newRunContext creates the shared state for a workflow run
+func newRunContext(opts *Options, config *Config) *RunContext {
+	return &RunContext{
+		Options:     opts,
+		Config:      config,
+		Annotations: &AnnotationCollector{},
+		Results:     newResultsStore(),
+		Masker:      &Masker{},
+		Tests:       &TestCollector{},
+		Secrets:     &SecretFetcher{Command: config.SecretsCommand},
+
+		ctx:               context.Background(),
+		cancelledMatrices: make(map[string]bool),
+	}
+}
+
+// workflowEvaluator creates an evaluator for expressions evaluated before any job starts,
+// with the github and inputs contexts
+func (r *RunContext) workflowEvaluator() *expression.Evaluator {
+	evaluator := newWorkflowEvaluator(nil, r.Config.Env)
+	evaluator.Contexts["inputs"] = r.Inputs
+	return evaluator
+}
+
+// Interrupted reports whether the run was cancelled, e.g. by a newer run of its concurrency group
+func (r *RunContext) Interrupted() bool {
+	return r.ctx.Err() != nil
+}
+
+func executeWorkflow(workflow *Workflow, config *Config, opts *Options) (err error) {
+	infof("Executing workflow: %s\n", workflow.Name)
+	started := time.Now()
+
+	// Every job in this run sees the same run identifiers
+	config = withRunIdentifiers(config, workflow)
+	infof("Run: #%s (id %s)\n", config.Env["GITHUB_RUN_NUMBER"], config.Env["GITHUB_RUN_ID"])
+
+	run := newRunContext(opts, config)
+	inputs, err := workflowInputs(workflow, opts.Inputs)
+	if err != nil {
+		return err
+	}
+	run.Inputs = inputs
+	defer func() {
+		// Persist annotations even when the workflow fails
+		if opts.AnnotationsFile == "" {
+			return
+		}
+		if err := writeAnnotations(run.Annotations.All(), opts.AnnotationsFile, opts.AnnotationsFormat); err != nil {
+			warnf("Warning: failed to write annotations: %v\n", err)
+		}
+	}()
+	defer func() {
+		// Like annotations, the reports are written when the workflow fails too
+		if opts.JUnitOut == "" && opts.ReportFile == "" {
+			return
+		}
+		writeReports(buildReport(workflow, run, started, err), opts)
+	}()
+
+	// Only one run of a concurrency group runs at a time, across Vermont processes
+	if workflow.Concurrency != nil {
+		group, cancelInProgress, err := workflow.Concurrency.Resolve(run.workflowEvaluator())
+		if err != nil {
+			return err
+		}
+		release, err := acquireConcurrencyGroup(group, cancelInProgress)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		// A newer run with cancel-in-progress stops this one with SIGTERM
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		run.ctx = ctx
+	}
+
+	// Create pipeline temp directory
+	pipelineDir, err := createPipelineDir(workflow.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create pipeline directory: %w", err)
+	}
+	defer func() {
+		// Keep job workspaces and cloned actions around for post-mortem debugging
+		if opts.NoCleanup {
+			infof("Pipeline directory preserved: %s\n", pipelineDir)
+			return
+		}
+		if removeErr := os.RemoveAll(pipelineDir); removeErr != nil {
+			warnf("Warning: failed to cleanup pipeline directory %s: %v\n", pipelineDir, removeErr)
+		}
+	}()
+
+	// Expand matrix jobs
+	expandedJobs := expandMatrixJobs(workflow.Jobs)
+
+	// Protected environments require explicit confirmation
+	if err := checkProtectedEnvironments(expandedJobs, config, opts.Confirm); err != nil {
+		return err
+	}
+
+	if opts.SinceRef != "" {
+		changed, err := gitChangedFiles(opts.SinceRef)
+		if err != nil {
+			return err
+		}
+		infof("Changed since %s: %d file(s)\n", opts.SinceRef, len(changed))
+		run.ChangedFiles = changed
+	}
+
+	// Workflow env values may use expressions such as ${{ github.ref_name }}
+	workflowEnv, err := resolveEnvScope(workflow.Env, run.workflowEvaluator())
+	if err != nil {
+		return fmt.Errorf("workflow env: %w", err)
+	}
+
+	// Build dependency graph and execute jobs
+	err = executeJobs(expandedJobs, config, pipelineDir, workflowEnv, run)
+
+	// Tolerated failures don't fail the run, so list them where they can't be missed
+	failures := run.ToleratedFailures()
+	if len(failures) > 0 {
+		warnf("Tolerated failures (continue-on-error): %d\n", len(failures))
+		for _, failure := range failures {
+			warnf("  - %s\n", run.Masker.Mask(failure))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if run.Interrupted() {
+		return errRunCancelled
+	}
+	if len(failures) > 0 && opts.StrictExit {
+		return fmt.Errorf("--strict-exit: %d %w", len(failures), errToleratedFailures)
+	}
+	return nil
+}
+
+// withRunIdentifiers returns a copy of the config whose env carries GITHUB_RUN_ID,
+// GITHUB_RUN_NUMBER, GITHUB_RUN_ATTEMPT, GITHUB_EVENT_NAME and the ref variables for a new
+// run; values already set in the config or with --event win
+func withRunIdentifiers(config *Config, workflow *Workflow) *Config {
+	runConfig := *config
+	runConfig.Env = make(map[string]string, len(config.Env)+3)
+	for key, value := range config.Env {
+		runConfig.Env[key] = value
+	}
+
+	identifiers := map[string]string{
+		"GITHUB_RUN_ID":      strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"GITHUB_RUN_NUMBER":  strconv.Itoa(nextRunNumber(workflow.Name)),
+		"GITHUB_RUN_ATTEMPT": "1",
+	}
+
+	// Without an event the run looks like a push, or like the workflow's first trigger if push isn't one
+	if triggers := workflowTriggers(workflow.On); contains(triggers, "push") {
+		identifiers["GITHUB_EVENT_NAME"] = "push"
+	} else if len(triggers) > 0 {
+		identifiers["GITHUB_EVENT_NAME"] = triggers[0]
+	}
+	for key, value := range identifiers {
+		if _, exists := runConfig.Env[key]; !exists {
+			runConfig.Env[key] = value
+		}
+	}
+
+	for key, value := range refEnvironment(runConfig.Env) {
+		if _, exists := runConfig.Env[key]; !exists {
+			runConfig.Env[key] = value
+		}
+	}
+
+	return &runConfig
+}
+
+// refEnvironment derives GITHUB_REF, GITHUB_REF_NAME, GITHUB_REF_TYPE and GITHUB_BASE_REF.
+// GITHUB_REF comes from the config when set, otherwise from the local git checkout.
+func refEnvironment(env map[string]string) map[string]string {
+	ref := env["GITHUB_REF"]
+	if ref == "" {
+		ref = gitCurrentRef()
+	}
+	if ref == "" {
+		return nil
+	}
+
+	refName, refType := splitRef(ref)
+	result := map[string]string{
+		"GITHUB_REF":      ref,
+		"GITHUB_REF_NAME": refName,
+		"GITHUB_REF_TYPE": refType,
+	}
+
+	// Like GitHub, base_ref is only set for pull request events and targets the default branch by default
+	result["GITHUB_BASE_REF"] = ""
+	switch env["GITHUB_EVENT_NAME"] {
+	case "pull_request", "pull_request_target":
+		result["GITHUB_BASE_REF"] = gitDefaultBranch()
+	}
+
+	return result
+}
+
+// splitRef returns the short name and type (branch or tag) of a fully-qualified ref
+func splitRef(ref string) (string, string) {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return strings.TrimPrefix(ref, "refs/heads/"), "branch"
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return strings.TrimPrefix(ref, "refs/tags/"), "tag"
+	case strings.HasPrefix(ref, "refs/pull/"):
+		// GitHub reports pull request merge refs as "<number>/merge" branches
+		return strings.TrimPrefix(ref, "refs/pull/"), "branch"
+	}
+	return ref, "branch"
+}
+
+// gitCurrentRef returns the ref checked out in the current directory: the branch, or a tag at a detached HEAD
+func gitCurrentRef() string {
+	if output, err := exec.Command("git", "symbolic-ref", "-q", "HEAD").Output(); err == nil {
+		return strings.TrimSpace(string(output))
+	}
+	if output, err := exec.Command("git", "describe", "--tags", "--exact-match", "HEAD").Output(); err == nil {
+		return "refs/tags/" + strings.TrimSpace(string(output))
+	}
+	return ""
+}
+
+// gitDefaultBranch returns the branch origin's HEAD points to, falling back to main
+func gitDefaultBranch() string {
+	output, err := exec.Command("git", "symbolic-ref", "-q", "--short", "refs/remotes/origin/HEAD").Output()
+	if err != nil {
+		return "main"
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(output)), "origin/")
+}
+
+// runNumbersFile stores the last run number of each workflow, keyed by workflow name
+func runNumbersFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".vermont", "run-numbers.json"), nil
+}
+
+// nextRunNumber increments and persists the run number of a workflow.
+// Run numbers start at 1; if the counter can't be persisted the run still proceeds.
+func nextRunNumber(workflowName string) int {
+	path, err := runNumbersFile()
+	if err != nil {
+		warnf("Warning: failed to locate run number file: %v\n", err)
+		return 1
+	}
+
+	runNumbers := make(map[string]int)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &runNumbers); err != nil {
+			warnf("Warning: ignoring unreadable run number file %s: %v\n", path, err)
+		}
+	}
+
+	runNumbers[workflowName]++
+	runNumber := runNumbers[workflowName]
+
+	data, err := json.MarshalIndent(runNumbers, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		warnf("Warning: failed to persist run number: %v\n", err)
+	}
+
+	return runNumber
+}
+
+// concurrencyPollInterval is how often a run waiting for its concurrency group checks the lock
+const concurrencyPollInterval = time.Second
+
+// concurrencyLockFile returns the lock file of a concurrency group, keyed by the resolved group name
+func concurrencyLockFile(group string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(group))
+	return filepath.Join(home, ".vermont", "concurrency", fmt.Sprintf("%x.lock", hash[:8])), nil
+}
+
+// acquireConcurrencyGroup waits until no other Vermont process runs a workflow in the group and
+// takes the group's lock. With cancelInProgress the run holding it is sent SIGTERM instead of
+// waiting for it to finish. The returned function releases the lock.
+func acquireConcurrencyGroup(group string, cancelInProgress bool) (func(), error) {
+	path, err := concurrencyLockFile(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate concurrency lock: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create concurrency lock directory: %w", err)
+	}
+
+	// The lock is written under a temporary name and linked into place, so other processes
+	// never see it without the pid of its holder. The holder's start time tells it apart
+	// from an unrelated process that got the same pid after a crash.
+	started, err := processStartTime(os.Getpid())
+	if err != nil {
+		return nil, fmt.Errorf("failed to write concurrency lock: %w", err)
+	}
+	pending := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(pending, []byte(fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), started, group)), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write concurrency lock: %w", err)
+	}
+	defer os.Remove(pending)
+
+	infof("Concurrency group: %s\n", group)
+	notified := 0
+	for {
+		err := os.Link(pending, path)
+		if err == nil {
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create concurrency lock: %w", err)
+		}
+
+		// A lock left behind by a process that no longer runs is stale
+		holder := concurrencyLockHolder(path)
+		if holder == nil {
+			os.Remove(path)
+			continue
+		}
+
+		if notified != holder.Pid {
+			notified = holder.Pid
+			if cancelInProgress {
+				infof("  Cancelling the run in progress (pid %d)\n", holder.Pid)
+				if err := holder.Signal(syscall.SIGTERM); err != nil {
+					warnf("  Warning: failed to cancel pid %d: %v\n", holder.Pid, err)
+				}
+			} else {
+				infof("  Waiting for the run in progress (pid %d) to finish\n", holder.Pid)
+			}
+		}
+		time.Sleep(concurrencyPollInterval)
+	}
+}
+
+// concurrencyLockHolder returns the running process holding a lock, or nil if the lock is
+// stale: its process is gone, or its pid now belongs to a process started at another time
+func concurrencyLockHolder(path string) *os.Process {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || pid <= 0 {
+		return nil
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil || process.Signal(syscall.Signal(0)) != nil {
+		return nil
+	}
+	if started, err := processStartTime(pid); err != nil || started != strings.TrimSpace(lines[1]) {
+		return nil
+	}
+	return process
+}
+
+// processStartTime returns when a process started, as ps reports it
+func processStartTime(pid int) (string, error) {
+	output, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the start time of pid %d: %w", pid, err)
+	}
+	started := strings.TrimSpace(string(output))
+	if started == "" {
+		return "", fmt.Errorf("failed to get the start time of pid %d", pid)
+	}
+	return started, nil
+}
+
+// pipelineBaseDir is where each run's pipeline directory is created
+const pipelineBaseDir = "/tmp"
+
+func createPipelineDir(workflowName string) (string, error) {
+	// Generate random suffix
+	suffix := fmt.Sprintf("%06d", rand.Intn(1000000))
+
+	// Clean workflow name for directory
+	cleanName := strings.ReplaceAll(strings.ToLower(workflowName), " ", "-")
+	dirName := fmt.Sprintf("%s-%s", cleanName, suffix)
+
+	pipelineDir := filepath.Join(pipelineBaseDir, dirName)
+	return pipelineDir, os.MkdirAll(pipelineDir, 0755)
+}
+
+func executeJobs(jobs map[string]*Job, config *Config, pipelineDir string, workflowEnv map[string]string, run *RunContext) error {
+	// Create steps directory for actions
+	stepsDir := filepath.Join(pipelineDir, "steps")
+	if err := os.MkdirAll(stepsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create steps directory: %w", err)
+	}
+
+	// Build dependency graph and execute jobs with proper dependency resolution
+	return executeJobsWithDependencies(jobs, config, pipelineDir, stepsDir, workflowEnv, run)
+}
+
+func executeJobsWithDependencies(jobs map[string]*Job, config *Config, pipelineDir, stepsDir string, workflowEnv map[string]string, run *RunContext) error {
+	// Validate dependencies; needs may name a matrix job that was expanded into several
+	groups := matrixGroups(jobs)
+	if err := validateJobDependencies(jobs, groups); err != nil {
+		return fmt.Errorf("dependency validation failed: %w", err)
+	}
+	// Jobs in a cycle could never start, so the run fails before any job does
+	if _, err := executionWaves(jobs, groups); err != nil {
+		return err
+	}
+
+	// Track job completion status
+	completed := make(map[string]bool)
+	inProgress := make(map[string]bool)
+	results := make(chan JobResult, len(jobs))
+
+	// A failed job doesn't stop independent jobs; dependents decide via their if condition
+	var firstErr error
+	record := func(result JobResult) {
+		delete(inProgress, result.JobName)
+		completed[result.JobName] = true
+		if result.Error != nil && firstErr == nil {
+			firstErr = fmt.Errorf("job %s failed: %w", result.JobName, result.Error)
+		}
+	}
+
+	// Start executing jobs
+	for len(completed) < len(jobs) {
+		// Find jobs that can be executed (all dependencies completed)
+		readyJobs := findReadyJobs(jobs, groups, completed, inProgress)
+
+		if len(readyJobs) == 0 {
+			if len(inProgress) == 0 {
+				return errCircularDependency
+			}
+			// Wait for a job to complete
+			record(<-results)
+			continue
+		}
+
+		// Execute ready jobs in parallel
+		for _, jobName := range readyJobs {
+			inProgress[jobName] = true
+
+			go func(jobName string, job *Job) {
+				// Dependencies have completed, so their results are already in the store
+				needs := run.Results.SnapshotNeeds(job.Needs, groups)
+				started := time.Now()
+				result := executeJobSync(jobName, job, config, pipelineDir, stepsDir, workflowEnv, run, needs)
+				result.Duration = time.Since(started)
+				run.Results.Set(result)
+
+				// A failed matrix job stops the rest of its matrix when fail-fast applies
+				if result.Result == JobResultFailure && job.MatrixGroup != "" && run.matrixFailFast(job) {
+					infof("Cancelling remaining %s matrix jobs (fail-fast)\n", job.MatrixGroup)
+					run.CancelMatrix(job.MatrixGroup)
+				}
+
+				results <- result
+			}(jobName, jobs[jobName])
+		}
+
+		// Wait for at least one job to complete before checking for more ready jobs
+		if len(readyJobs) > 0 {
+			record(<-results)
+		}
+	}
+
+	return firstErr
+}
+
+// Job results as exposed through needs.<job>.result
+const (
+	JobResultSuccess   = "success"
+	JobResultFailure   = "failure"
+	JobResultSkipped   = "skipped"
+	JobResultCancelled = "cancelled"
+)
+
+// errCircularDependency is returned when no remaining job can start because the jobs' needs form a cycle
+var errCircularDependency = errors.New("circular dependency detected or no executable jobs remaining")
+
+// errStepTimeout is returned when a step is stopped because it ran longer than its timeout-minutes
+var errStepTimeout = errors.New("step exceeded its timeout")
+
+// errJobCancelled is returned when a job stops early because its matrix was cancelled
+var errJobCancelled = errors.New("job cancelled")
+
+// errRunCancelled is returned when a run was cancelled before all of its jobs finished
+var errRunCancelled = errors.New("run cancelled")
+
+type JobResult struct {
+	JobName string
+	Result  string
+	Outputs map[string]string
+	Error   error
+	// Steps holds the results of the job's steps in order; empty when the job didn't run
+	Steps []StepResult
+	// Duration is how long the job took, including skipping it
+	Duration time.Duration
+}
+
+// ResultsStore holds the results of completed jobs; it is safe for concurrent use
+type ResultsStore struct {
+	mu      sync.RWMutex
+	results map[string]JobResult
+}
+
+// newResultsStore creates an empty results store
+func newResultsStore() *ResultsStore {
+	return &ResultsStore{results: make(map[string]JobResult)}
+}
+
+// Set records the result of a completed job
+func (s *ResultsStore) Set(result JobResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy outputs so later changes by the caller don't leak into readers
+	outputs := make(map[string]string, len(result.Outputs))
+	for name, value := range result.Outputs {
+		outputs[name] = value
+	}
+	result.Outputs = outputs
+	s.results[result.JobName] = result
+}
+
+// All returns the results of every completed job in name order
+func (s *ResultsStore) All() []JobResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]JobResult, 0, len(s.results))
+	for _, result := range s.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].JobName < results[j].JobName })
+	return results
+}
+
+// Get returns the result of a completed job
+func (s *ResultsStore) Get(jobName string) (JobResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.results[jobName]
+	return result, ok
+}
+
+// Snapshot returns the results of the given jobs, e.g. a job's dependencies
+func (s *ResultsStore) Snapshot(jobNames []string) map[string]JobResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := make(map[string]JobResult, len(jobNames))
+	for _, jobName := range jobNames {
+		if result, ok := s.results[jobName]; ok {
+			snapshot[jobName] = result
+		}
+	}
+	return snapshot
+}
+
+// SnapshotNeeds returns the results of a job's dependencies by the names it declared them
+// with; a matrix job's result combines the results of every job of its matrix
+func (s *ResultsStore) SnapshotNeeds(needs []string, groups map[string][]string) map[string]JobResult {
+	snapshot := s.Snapshot(needs)
+	for _, dep := range needs {
+		if members, ok := groups[dep]; ok {
+			snapshot[dep] = combineMatrixResults(dep, s.Snapshot(members), members)
+		}
+	}
+	return snapshot
+}
+
+// combineMatrixResults reports a matrix as failed or cancelled if any of its jobs was,
+// skipped if all were skipped and successful otherwise. Outputs are merged in job name
+// order, so when several jobs set the same output the last one wins.
+func combineMatrixResults(name string, results map[string]JobResult, members []string) JobResult {
+	combined := JobResult{JobName: name, Result: JobResultSuccess, Outputs: make(map[string]string)}
+	failed, cancelled, skipped := false, false, 0
+	for _, member := range members {
+		result := results[member]
+		switch result.Result {
+		case JobResultFailure:
+			failed = true
+		case JobResultCancelled:
+			cancelled = true
+		case JobResultSkipped:
+			skipped++
+		}
+		for key, value := range result.Outputs {
+			combined.Outputs[key] = value
+		}
+	}
+
+	switch {
+	case failed:
+		combined.Result = JobResultFailure
+	case cancelled:
+		combined.Result = JobResultCancelled
+	case len(members) > 0 && skipped == len(members):
+		combined.Result = JobResultSkipped
+	}
+	return combined
+}
+
+// tolerateJobError returns nil when the failed job has continue-on-error enabled
+func tolerateJobError(jobName string, job *Job, jobCtx *JobContext, config *Config, workflowEnv map[string]string, jobErr error) error {
+	continueOnError, err := job.ContinueOnError.Evaluate(newJobEvaluator(job, jobCtx, config, workflowEnv))
+	if err != nil {
+		return fmt.Errorf("%w (%v)", jobErr, err)
+	}
+	if !continueOnError {
+		return jobErr
+	}
+
+	warnf("Warning: job %s failed but continue-on-error is set: %v\n", jobName, jobErr)
+	jobCtx.Run.RecordToleratedFailure(fmt.Sprintf("job %s: %v", jobName, jobErr))
+	return nil
+}
+
+func validateJobDependencies(jobs map[string]*Job, groups map[string][]string) error {
+	for jobName, job := range jobs {
+		for _, dep := range expandNeeds(job.Needs, groups) {
+			if _, exists := jobs[dep]; !exists {
+				return fmt.Errorf("job %s depends on non-existent job %s", jobName, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// executionWaves orders jobs into waves with Kahn's algorithm: every job of a wave only
+// needs jobs of earlier waves, so a wave's jobs can run in parallel. Each wave is in name
+// order; max-parallel may still split a wave's matrix jobs when they run.
+func executionWaves(jobs map[string]*Job, groups map[string][]string) ([][]string, error) {
+	pending := make(map[string]int, len(jobs))
+	dependents := make(map[string][]string)
+	for jobName, job := range jobs {
+		deps := make(map[string]bool)
+		for _, dep := range expandNeeds(job.Needs, groups) {
+			deps[dep] = true
+		}
+		pending[jobName] = len(deps)
+		for dep := range deps {
+			dependents[dep] = append(dependents[dep], jobName)
+		}
+	}
+
+	var wave []string
+	for jobName, count := range pending {
+		if count == 0 {
+			wave = append(wave, jobName)
+		}
+	}
+
+	var waves [][]string
+	placed := 0
+	for len(wave) > 0 {
+		sort.Strings(wave)
+		waves = append(waves, wave)
+		placed += len(wave)
+		var next []string
+		for _, jobName := range wave {
+			for _, dependent := range dependents[jobName] {
+				pending[dependent]--
+				if pending[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		wave = next
+	}
+
+	if placed < len(jobs) {
+		var stuck []string
+		for jobName, count := range pending {
+			if count > 0 {
+				stuck = append(stuck, jobName)
+			}
+		}
+		sort.Strings(stuck)
+		return nil, fmt.Errorf("%w: %s", errCircularDependency, strings.Join(stuck, ", "))
+	}
+	return waves, nil
+}
+
+func findReadyJobs(jobs map[string]*Job, groups map[string][]string, completed, inProgress map[string]bool) []string {
+	var ready []string
+
+	// Count the running jobs of each matrix group so max-parallel can be honored
+	running := make(map[string]int)
+	for jobName, job := range jobs {
+		if inProgress[jobName] && !completed[jobName] && job.MatrixGroup != "" {
+			running[job.MatrixGroup]++
+		}
+	}
+
+	for jobName, job := range jobs {
+		// Skip if already completed or in progress
+		if completed[jobName] || inProgress[jobName] {
+			continue
+		}
+
+		// Check if all dependencies are completed
+		allDepsCompleted := true
+		for _, dep := range expandNeeds(job.Needs, groups) {
+			if !completed[dep] {
+				allDepsCompleted = false
+				break
+			}
+		}
+
+		if allDepsCompleted {
+			ready = append(ready, jobName)
+		}
+	}
+
+	// Start jobs in a stable order, holding back matrix jobs beyond their group's max-parallel
+	sort.Strings(ready)
+	started := ready[:0]
+	for _, jobName := range ready {
+		job := jobs[jobName]
+		if job.MatrixGroup != "" && job.MaxParallel > 0 {
+			if running[job.MatrixGroup] >= job.MaxParallel {
+				continue
+			}
+			running[job.MatrixGroup]++
+		}
+		started = append(started, jobName)
+	}
+	return started
+}
+
+// executeJobSync runs a job and returns its result and resolved outputs
+func executeJobSync(jobName string, job *Job, config *Config, pipelineDir, stepsDir string, workflowEnv map[string]string, run *RunContext, needs map[string]JobResult) JobResult {
+	infof("Job: %s\n", jobName)
+	infof("  Runs on: %v\n", job.RunsOn)
+	infof("  Steps: %d\n", len(job.Steps))
+
+	// Resolve environment-scoped secrets and vars
+	jobCtx := newJobContext(jobName, job, config, run, needs)
+	if jobCtx.Environment != "" {
+		infof("  Environment: %s\n", jobCtx.Environment)
+	}
+
+	if run.MatrixCancelled(job) {
+		infof("  Cancelled: another %s matrix job failed\n", job.MatrixGroup)
+		return JobResult{JobName: jobName, Result: JobResultCancelled}
+	}
+	if run.Interrupted() {
+		infof("  Cancelled: the run was cancelled\n")
+		return JobResult{JobName: jobName, Result: JobResultCancelled}
+	}
+
+	if !run.JobAffected(jobName, job) {
+		infof("  Skipped: no file changed since %s matches its paths\n", run.Options.SinceRef)
+		return JobResult{JobName: jobName, Result: JobResultSkipped}
+	}
+
+	// Evaluate the job condition; without one the job only runs when its dependencies succeeded
+	shouldRun, err := evaluateJobCondition(job, jobCtx, config, workflowEnv)
+	if err != nil {
+		return JobResult{JobName: jobName, Result: JobResultFailure, Error: fmt.Errorf("failed to evaluate if condition: %w", err)}
+	}
+	if !shouldRun {
+		if job.If != "" {
+			infof("  Skipped: condition '%s' is false\n", job.If)
+		} else {
+			infof("  Skipped: a dependency did not succeed\n")
+		}
+		return JobResult{JobName: jobName, Result: JobResultSkipped}
+	}
+
+	if err := runJob(jobName, job, config, pipelineDir, stepsDir, workflowEnv, jobCtx); err != nil {
+		if errors.Is(err, errJobCancelled) {
+			infof("  Cancelled: another %s matrix job failed\n", job.MatrixGroup)
+			return JobResult{JobName: jobName, Result: JobResultCancelled, Steps: jobCtx.Steps}
+		}
+		if run.Interrupted() {
+			infof("  Cancelled: the run was cancelled\n")
+			return JobResult{JobName: jobName, Result: JobResultCancelled, Steps: jobCtx.Steps}
+		}
+		if err := tolerateJobError(jobName, job, jobCtx, config, workflowEnv, err); err != nil {
+			return JobResult{JobName: jobName, Result: JobResultFailure, Error: err, Steps: jobCtx.Steps}
+		}
+	}
+
+	return JobResult{
+		JobName: jobName,
+		Result:  JobResultSuccess,
+		Outputs: evaluateJobOutputs(job, jobCtx, config, workflowEnv),
+		Steps:   jobCtx.Steps,
+	}
+}
+
+// runJob prepares the job directory and runner image and executes the job's steps
+func runJob(jobName string, job *Job, config *Config, pipelineDir, stepsDir string, workflowEnv map[string]string, jobCtx *JobContext) error {
+	// Create job directory
+	jobDir := filepath.Join(pipelineDir, jobName)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	jobCtx.Workspace = jobDir
+
+	// Get runner image; a job container takes its place, but runs-on still has to match
+	var runnerImage string
+	var err error
+	if job.Container != nil {
+		if _, err := runnerLabel(job.RunsOn, config); err != nil {
+			return fmt.Errorf("failed to get runner image: %w", err)
+		}
+		runnerImage, err = prepareJobContainer(job, jobCtx, config, workflowEnv)
+		if err != nil {
+			return fmt.Errorf("job container: %w", err)
+		}
+	} else {
+		runnerImage, err = getRunnerImage(job.RunsOn, config)
+		if err != nil {
+			return fmt.Errorf("failed to get runner image: %w", err)
+		}
+	}
+
+	// Job env sees the workflow env, github, matrix and needs, but not any step's env
+	jobEnv, err := resolveEnvScope(job.Env, newJobEvaluator(job, jobCtx, config, workflowEnv))
+	if err != nil {
+		return fmt.Errorf("job env: %w", err)
+	}
+	jobCtx.JobEnv = resolveEnv(workflowEnv, jobEnv)
+
+	// The dump shows what a step would see after every step exported its variables
+	if jobCtx.Run != nil && jobCtx.Run.Options != nil && jobCtx.Run.Options.DumpEnvDir != "" {
+		defer func() {
+			if err := dumpJobEnv(jobName, jobCtx, config); err != nil {
+				warnf("  Warning: %v\n", err)
+			}
+		}()
+	}
+
+	// Bound the job's steps by its timeout; cancelling the run stops them too
+	jobDeadline := context.Background()
+	if jobCtx.Run != nil {
+		jobDeadline = jobCtx.Run.ctx
+	}
+	if timeout := jobTimeout(job, config); timeout > 0 {
+		var cancel context.CancelFunc
+		jobDeadline, cancel = context.WithTimeout(jobDeadline, timeout)
+		defer cancel()
+		infof("  Timeout: %s\n", timeout)
+	}
+
+	// Execute steps in container
+	err = executeJobSteps(job, jobDir, runnerImage, config, stepsDir, workflowEnv, jobCtx, jobDeadline)
+	if jobDeadline.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("job exceeded its timeout of %s: %w", jobTimeout(job, config), err)
+	}
+	return err
+}
+
+// prepareJobContainer makes the image of a job's container available according to the pull
+// policy and returns it. The image and credentials may use expressions such as secrets.
+func prepareJobContainer(job *Job, jobCtx *JobContext, config *Config, workflowEnv map[string]string) (string, error) {
+	evaluator := newJobEvaluator(job, jobCtx, config, workflowEnv)
+	resolve := func(field, value string) (string, error) {
+		resolved, err := evaluator.Interpolate(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate %s: %w", field, err)
+		}
+		return resolved, nil
+	}
+
+	image, err := resolve("image", job.Container.Image)
+	if err != nil {
+		return "", err
+	}
+	if image == "" {
+		return "", fmt.Errorf("image %q is empty", job.Container.Image)
+	}
+	infof("  Container: %s\n", image)
+
+	creds := job.Container.Credentials
+	if creds == nil {
+		return image, ensureImage(image, config)
+	}
+	username, err := resolve("credentials.username", creds.Username)
+	if err != nil {
+		return "", err
+	}
+	password, err := resolve("credentials.password", creds.Password)
+	if err != nil {
+		return "", err
+	}
+	// The password is masked even when the workflow spells it out instead of using a secret
+	if jobCtx.Run != nil {
+		jobCtx.Run.Masker.Add(password)
+	}
+	if username == "" || password == "" {
+		return "", fmt.Errorf("credentials for %s need both a username and a password", image)
+	}
+
+	if config.Container.PullPolicy == pullNever {
+		return image, ensureImage(image, config)
+	}
+	if config.Container.PullPolicy != pullAlways && imageExists(image) {
+		return image, nil
+	}
+	return image, pullPrivateImage(image, username, password, config)
+}
+
+// jobTimeout returns the job's timeout: timeout-minutes, else the config default, else none
+func jobTimeout(job *Job, config *Config) time.Duration {
+	if job.TimeoutMinutes > 0 {
+		return time.Duration(job.TimeoutMinutes * float64(time.Minute))
+	}
+	return time.Duration(config.Runner.DefaultJobTimeout) * time.Second
+}
+
+// stepTimeout returns the step's timeout: timeout-minutes, else the config default, else none
+func stepTimeout(step *Step, config *Config) time.Duration {
+	if step.TimeoutMinutes > 0 {
+		return time.Duration(step.TimeoutMinutes * float64(time.Minute))
+	}
+	return time.Duration(config.Runner.DefaultStepTimeout) * time.Second
+}
+
+// evaluateJobCondition evaluates a job's if condition against the workflow, matrix and needs contexts
+func evaluateJobCondition(job *Job, jobCtx *JobContext, config *Config, workflowEnv map[string]string) (bool, error) {
+	return newJobEvaluator(job, jobCtx, config, workflowEnv).EvaluateCondition(job.If)
+}
+
+// evaluateJobOutputs resolves the job's declared outputs against its final context
+func evaluateJobOutputs(job *Job, jobCtx *JobContext, config *Config, workflowEnv map[string]string) map[string]string {
+	if len(job.Outputs) == 0 {
+		return nil
+	}
+
+	evaluator := newJobEvaluator(job, jobCtx, config, workflowEnv)
+	outputs := make(map[string]string)
+	for name, value := range job.Outputs {
+		// Outputs referencing steps that didn't set them resolve to an empty string
+		resolved, err := evaluator.Interpolate(value)
+		if err != nil {
+			warnf("  Warning: failed to evaluate output %s: %v\n", name, err)
+			resolved = ""
+		}
+		outputs[name] = resolved
+	}
+
+	infof("  Job outputs: %s\n", jobCtx.Run.Masker.Mask(fmt.Sprintf("%v", outputs)))
+	return outputs
+}
+
+// newJobEvaluator creates an expression evaluator with the workflow, matrix, needs, steps, inputs,
+// secrets and vars contexts of a job
+func newJobEvaluator(job *Job, jobCtx *JobContext, config *Config, workflowEnv map[string]string) *expression.Evaluator {
+	// Once the job runs, env also holds its own env and what steps exported through GITHUB_ENV
+	evaluator := newWorkflowEvaluator(resolveEnv(workflowEnv, jobCtx.JobEnv, jobCtx.Env), config.Env)
+
+	matrix := make(map[string]interface{})
+	for key, value := range job.Matrix {
+		matrix[key] = value
+	}
+	evaluator.Contexts["matrix"] = matrix
+
+	// Status functions reflect the results of the job's dependencies
+	needs := make(map[string]interface{})
+	allSucceeded, anyFailed := true, false
+	for _, dep := range job.Needs {
+		result := jobCtx.Needs[dep]
+		outputs := make(map[string]interface{})
+		for name, value := range result.Outputs {
+			outputs[name] = value
+		}
+		needs[dep] = map[string]interface{}{
+			"result":  result.Result,
+			"outputs": outputs,
+		}
+		if result.Result != JobResultSuccess {
+			allSucceeded = false
+		}
+		if result.Result == JobResultFailure {
+			anyFailed = true
+		}
+	}
+	evaluator.Contexts["needs"] = needs
+	evaluator.Contexts["steps"] = stepsContext(jobCtx)
+	if jobCtx.Run != nil {
+		evaluator.Contexts["inputs"] = jobCtx.Run.Inputs
+	}
+	evaluator.Contexts["secrets"] = &secretsContext{job: jobCtx}
+	evaluator.Contexts["vars"] = jobCtx.Vars
+
+	// A cancelled job is no longer successful, and conditions see it as soon as it happens
+	evaluator.Functions = map[string]expression.Function{
+		"success":   func(args ...interface{}) (interface{}, error) { return allSucceeded && !jobCtx.cancelled(job), nil },
+		"always":    func(args ...interface{}) (interface{}, error) { return true, nil },
+		"failure":   func(args ...interface{}) (interface{}, error) { return anyFailed, nil },
+		"cancelled": func(args ...interface{}) (interface{}, error) { return jobCtx.cancelled(job), nil },
+		"hashFiles": func(args ...interface{}) (interface{}, error) {
+			if jobCtx.Workspace == "" {
+				return nil, fmt.Errorf("hashFiles() is only available once the job's workspace exists")
+			}
+			return hashFiles(jobCtx.Workspace, args...)
+		},
+	}
+
+	return evaluator
+}
+
+// cancelled reports whether the job was cancelled: fail-fast cancelled its matrix, the run was
+// interrupted, or the job or step timeout of the running step expired
+func (c *JobContext) cancelled(job *Job) bool {
+	if c.Run != nil && (c.Run.MatrixCancelled(job) || c.Run.Interrupted()) {
+		return true
+	}
+	return c.ctx != nil && c.ctx.Err() != nil
+}
+
+// hashFiles returns the SHA-256 hash of the workspace files matching the patterns, or an empty
+// string if none does. Like on GitHub every file is hashed on its own and the result hashes
+// those hashes in path order; patterns starting with ! exclude files an earlier one included.
+func hashFiles(workspace string, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("hashFiles() expects at least 1 argument")
+	}
+	patterns := make([]string, len(args))
+	for i, arg := range args {
+		pattern := strings.TrimPrefix(expression.ToString(arg), "./")
+		if err := utils.ValidateGlob(strings.TrimPrefix(pattern, "!")); err != nil {
+			return nil, fmt.Errorf("hashFiles() pattern %q: %w", pattern, err)
+		}
+		patterns[i] = pattern
+	}
+
+	// WalkDir visits files in lexical order, so the hash doesn't depend on the file system
+	combined := sha256.New()
+	matched := false
+	err := filepath.WalkDir(workspace, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, path)
+		if err != nil || !pathsMatch(patterns, filepath.ToSlash(rel)) {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+		combined.Write(hash.Sum(nil))
+		matched = true
+		return nil
 	})
+	if err != nil {
+		return nil, fmt.Errorf("hashFiles() failed: %w", err)
+	}
+	if !matched {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", combined.Sum(nil)), nil
+}
 
-	// Prepare environment with input variables
-	actionEnv := make(map[string]string)
+// secretMask returns a function replacing the job's secrets, GITHUB_TOKEN and the run's masked
+// values with ***, including secrets no step has used yet
+func (c *JobContext) secretMask(config *Config) func(string) string {
+	secrets := &Masker{}
+	for _, value := range c.Secrets {
+		secrets.Add(value)
+	}
+	if token := config.Env["GITHUB_TOKEN"]; token != "" {
+		secrets.Add(token)
+	}
+	return func(value string) string { return secrets.Mask(c.Run.Masker.Mask(value)) }
+}
 
-	// Set inputs from step.With
-	inputs := make(map[string]interface{})
-	if step.With != nil {
-		for inputName, value := range step.With {
-			// Expand environment variables in the value
-			expandedValue := expandEnvironmentVariables(fmt.Sprintf("%v", value))
-			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-			actionEnv[envName] = expandedValue
-			inputs[inputName] = expandedValue
+// dumpJobEnv writes the environment a further step of the job would get to <dir>/<job>.env,
+// one NAME=value per line in name order; multiline values use the GITHUB_ENV delimiter form.
+// Secrets and masked values are replaced with *** unless --dump-env-unsafe is set.
+func dumpJobEnv(jobName string, jobCtx *JobContext, config *Config) error {
+	opts := jobCtx.Run.Options
+	env := resolveEnv(jobCtx.stepEnv(config, &Step{}), map[string]string{
+		"GITHUB_OUTPUT": "/workspace/github_output.txt",
+		"GITHUB_ENV":    "/workspace/github_env.txt",
+	})
+
+	mask := func(value string) string { return value }
+	if !opts.DumpEnvUnsafe {
+		mask = jobCtx.secretMask(config)
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for _, key := range keys {
+		value := mask(env[key])
+		if strings.Contains(value, "\n") {
+			fmt.Fprintf(&buf, "%s<<VERMONT_EOF\n%s\nVERMONT_EOF\n", key, value)
+			continue
 		}
+		fmt.Fprintf(&buf, "%s=%s\n", key, value)
 	}
 
-	// Set default values for inputs not provided in step.With
-	providedInputs := make(map[string]bool)
-	if step.With != nil {
-		for inputName := range step.With {
-			providedInputs[inputName] = true
+	if err := os.MkdirAll(opts.DumpEnvDir, 0755); err != nil {
+		return fmt.Errorf("failed to create env dump directory: %w", err)
+	}
+	path := filepath.Join(opts.DumpEnvDir, strings.ReplaceAll(jobName, string(os.PathSeparator), "_")+".env")
+	if err := os.WriteFile(path, []byte(buf.String()), 0600); err != nil {
+		return fmt.Errorf("failed to dump job env: %w", err)
+	}
+	debugf("  Environment written to %s\n", path)
+	return nil
+}
+
+func getRunnerImage(runsOn interface{}, config *Config) (string, error) {
+	label, err := runnerLabel(runsOn, config)
+	if err != nil {
+		return "", err
+	}
+	return runnerImageForLabel(label, config)
+}
+
+// runnerLabel picks the runner label whose Dockerfile a job's runs-on maps to
+func runnerLabel(runsOn interface{}, config *Config) (string, error) {
+	var runners []string
+
+	switch v := runsOn.(type) {
+	case string:
+		runners = []string{v}
+	case []string:
+		runners = v
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				runners = append(runners, str)
+			}
 		}
+	default:
+		return "", fmt.Errorf("invalid runs-on type: %T", runsOn)
 	}
 
-	// Add defaults from action metadata
-	for inputName, inputSpec := range meta.Inputs {
-		if !providedInputs[inputName] {
-			defaultValue := inputSpec.Default
-			// Special handling for common GitHub Actions defaults
-			if inputName == "token" && defaultValue == "" {
-				// Checkout action and many others expect GITHUB_TOKEN as default
-				defaultValue = "${GITHUB_TOKEN}"
+	if len(runners) == 0 {
+		return "", fmt.Errorf("no runs-on specified")
+	}
+
+	// Self-hosted jobs run only when this runner advertises every label they ask for
+	if contains(runners, "self-hosted") {
+		if err := matchRunnerLabels(runners, config); err != nil {
+			return "", err
+		}
+
+		// The first label with a runner Dockerfile picks the image
+		for _, label := range runners {
+			if _, err := os.Stat(runnerDockerfilePath(label, config)); err == nil {
+				return label, nil
 			}
-			if inputName == "github-token" && defaultValue == "" {
-				// GitHub script action and others expect GITHUB_TOKEN as default
-				defaultValue = "${GITHUB_TOKEN}"
+		}
+		return "ubuntu-latest", nil
+	}
+
+	// A label maps to a runner image when the runners directory has a Dockerfile for it
+	runner := runners[0] // Use first runner
+	if _, err := os.Stat(runnerDockerfilePath(runner, config)); err == nil {
+		return runner, nil
+	}
+
+	// Fall back to ubuntu-latest for unsupported runners
+	warnf("  Warning: unsupported runner '%s', falling back to ubuntu-latest\n", runner)
+	return "ubuntu-latest", nil
+}
+
+// runnerImageForLabel builds the runner image for a label if it doesn't exist yet
+func runnerImageForLabel(label string, config *Config) (string, error) {
+	imageName := fmt.Sprintf("vermont-runner:%s", label)
+
+	// Build the image if it doesn't exist
+	if err := buildRunnerImage(label, imageName, config); err != nil {
+		return "", fmt.Errorf("failed to build runner image: %w", err)
+	}
+
+	return imageName, nil
+}
+
+// matchRunnerLabels checks that the configured runner labels cover a self-hosted runs-on.
+// Without configured labels any self-hosted job is accepted, as before labels existed.
+func matchRunnerLabels(labels []string, config *Config) error {
+	if len(config.Runner.Labels) == 0 {
+		return nil
+	}
+
+	advertised := append([]string{"self-hosted", "linux", runnerArchLabel()}, config.Runner.Labels...)
+	var missing []string
+	for _, label := range labels {
+		matched := false
+		for _, candidate := range advertised {
+			// Runner labels are case-insensitive on GitHub
+			if strings.EqualFold(label, candidate) {
+				matched = true
+				break
 			}
-			if defaultValue != "" {
-				expandedValue := expandEnvironmentVariables(defaultValue)
-				// Also process workflow templates for default values
-				expandedValue = substituteWorkflowTemplates(expandedValue, make(map[string]string), config.Env)
-				envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-				actionEnv[envName] = expandedValue
-				inputs[inputName] = expandedValue
+		}
+		if !matched {
+			missing = append(missing, label)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("this runner doesn't have the label(s) %s required by runs-on (runner labels: %s)",
+			strings.Join(missing, ", "), strings.Join(advertised, ", "))
+	}
+	return nil
+}
+
+// runnerArchLabel returns GitHub's architecture label for the host
+func runnerArchLabel() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x64"
+	case "386":
+		return "x86"
+	case "arm":
+		return "arm"
+	}
+	return runtime.GOARCH
+}
+
+func runnerDockerfilePath(label string, config *Config) string {
+	return filepath.Join(config.Container.RunnersDir, fmt.Sprintf("Dockerfile.%s", label))
+}
+
+// runnerBuildMu serializes runner image builds so parallel jobs don't build the same image twice
+var runnerBuildMu sync.Mutex
+
+// refreshedRunnerImages holds the runner images rebuilt by this process under the always pull policy
+var refreshedRunnerImages = make(map[string]bool)
+
+func buildRunnerImage(dockerfileName, imageName string, config *Config) error {
+	runnerBuildMu.Lock()
+	defer runnerBuildMu.Unlock()
+
+	// Check if image exists; the always policy rebuilds it on fresh base images once per run
+	refresh := config.Container.PullPolicy == pullAlways && !refreshedRunnerImages[imageName]
+	if !refresh && imageExists(imageName) {
+		infof("  Container: %s (exists)\n", imageName)
+		return nil // Image already exists
+	}
+
+	infof("  Building container: %s\n", imageName)
+
+	// Build the image; without the Dockerfile docker build would fail with a less helpful message
+	dockerfilePath := runnerDockerfilePath(dockerfileName, config)
+	if _, err := os.Stat(dockerfilePath); err != nil {
+		if abs, absErr := filepath.Abs(dockerfilePath); absErr == nil {
+			dockerfilePath = abs
+		}
+		return fmt.Errorf("runner Dockerfile not found at %s: run Vermont from its repository, keep runners/ next to the vermont binary or set container.runnersDir in config.json to the directory with the Dockerfile.<label> files", dockerfilePath)
+	}
+
+	buildFlags, err := prepareBaseImages(dockerfilePath, config)
+	if err != nil {
+		return err
+	}
+
+	buildArgs := append(buildFlags, "-f", dockerfilePath, "-t", imageName, config.Container.RunnersDir)
+	buildCmd := exec.Command("docker", quietCommand("build", buildArgs...)...)
+	buildCmd.Stdout = progressOutput()
+	buildCmd.Stderr = os.Stderr
+
+	if err := buildCmd.Run(); err != nil {
+		return fmt.Errorf("docker build failed: %w", err)
+	}
+	refreshedRunnerImages[imageName] = true
+
+	return nil
+}
+
+func executeJobSteps(job *Job, jobDir, runnerImage string, config *Config, stepsDir string, workflowEnv map[string]string, jobCtx *JobContext, jobDeadline context.Context) error {
+	jobCtx.startTestSuite()
+	for i, step := range job.Steps {
+		stepNum := i + 1
+
+		// Running steps can't be interrupted, but a cancelled job doesn't start new ones
+		if jobCtx.Run != nil && jobCtx.Run.MatrixCancelled(job) {
+			return errJobCancelled
+		}
+
+		// Expressions see the job's contexts as they are when the step starts, plus the step's env
+		evaluator := newJobEvaluator(job, jobCtx, config, workflowEnv)
+		env, err := resolveEnvScope(step.Env, evaluator)
+		if err != nil {
+			return fmt.Errorf("step %d: %w", stepNum, err)
+		}
+		scoped, _ := scopedEvaluator(evaluator, env)
+		resolved := *step
+		resolved.Env = env
+		resolved.Name = interpolateTemplates(scoped, step.Name)
+		resolved.Run = interpolateTemplates(scoped, step.Run)
+		resolved.With = interpolateWith(step.With, scoped)
+		step = &resolved
+
+		// Names derived from the script can contain secrets substituted into it
+		step.Name = jobCtx.Run.Masker.Mask(stepDisplayName(step.Name, step.Run, step.Uses))
+		if step.Name != "" {
+			infof("    Step %d: %s\n", stepNum, step.Name)
+		} else {
+			infof("    Step %d\n", stepNum)
+		}
+
+		// The step condition sees the outcomes and conclusions of earlier steps
+		if step.If != "" {
+			shouldRun, err := newJobEvaluator(job, jobCtx, config, workflowEnv).EvaluateCondition(step.If)
+			if err != nil {
+				return fmt.Errorf("step %d: failed to evaluate if condition: %w", stepNum, err)
+			}
+			if !shouldRun {
+				infof("      Skipped: condition '%s' is false\n", step.If)
+				jobCtx.recordStepResult(stepNum, step, StepResultSkipped, StepResultSkipped)
+				jobCtx.recordTestCase(stepNum, step, 0, StepResultSkipped, fmt.Sprintf("condition '%s' is false", step.If))
+				continue
+			}
+		}
+
+		// Each step runs under the job deadline and its own timeout
+		var stepCtx context.Context
+		var cancel context.CancelFunc
+		timeout := stepTimeout(step, config)
+		if timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(jobDeadline, timeout)
+		} else {
+			stepCtx, cancel = context.WithCancel(jobDeadline)
+		}
+		jobCtx.ctx = stepCtx
+		jobCtx.startStepLog()
+		jobCtx.startHeldOutput()
+		started := time.Now()
+
+		var outputs map[string]string
+		var stepErr error
+		if step.Run != "" {
+			// Execute shell command in container
+			step.Shell = resolveStepShell(step, job, runnerImage)
+			stepErr = executeRunStep(step, jobDir, runnerImage, config, workflowEnv, jobCtx)
+			if stepErr == nil {
+				runOutputs, err := collectStepOutputs(jobDir, jobCtx)
+				if err != nil {
+					warnf("      Warning: %v\n", err)
+				}
+				outputs = runOutputs
+			}
+		} else if step.Uses != "" {
+			// Execute GitHub Action
+			warnMissingPermission(step, jobCtx)
+			outputs, stepErr = executeAction(step, jobDir, runnerImage, config, stepsDir, jobCtx)
+		}
+
+		timedOut := stepCtx.Err() == context.DeadlineExceeded
+		cancel()
+		jobCtx.ctx = nil
+		elapsed := time.Since(started)
+		jobCtx.releaseHeldOutput(stepErr != nil)
+
+		// Files the step created as root would otherwise stay unreadable or undeletable on the host
+		if jobCtx.Run != nil && jobCtx.Run.Options != nil && jobCtx.Run.Options.FixPermissions {
+			if err := fixWorkspacePermissions(jobDir, runnerImage, config); err != nil {
+				warnf("      Warning: %v\n", err)
+			}
+		}
+
+		// Variables a step exports apply to later steps even when it failed
+		if err := collectStepEnv(jobDir, jobCtx); err != nil {
+			warnf("      Warning: %v\n", err)
+		}
+
+		// A job timeout ends the job even when the step may continue on error
+		if jobDeadline.Err() != nil {
+			err := fmt.Errorf("step %d interrupted: %w", stepNum, jobDeadline.Err())
+			jobCtx.recordStepResult(stepNum, step, StepResultFailure, StepResultFailure)
+			jobCtx.recordTestCase(stepNum, step, elapsed, StepResultFailure, err.Error())
+			return err
+		}
+		if timedOut && stepErr != nil {
+			stepErr = fmt.Errorf("%w of %s: %w", errStepTimeout, timeout, stepErr)
+		}
+
+		// The report follows the exit code, so a failure continue-on-error tolerates still fails its test case
+		if stepErr != nil {
+			jobCtx.recordTestCase(stepNum, step, elapsed, StepResultFailure, stepErr.Error())
+		} else {
+			jobCtx.recordTestCase(stepNum, step, elapsed, StepResultSuccess, "")
+		}
+
+		if stepErr != nil {
+			continueOnError, err := step.ContinueOnError.Evaluate(newJobEvaluator(job, jobCtx, config, workflowEnv))
+			if err != nil || !continueOnError {
+				jobCtx.recordStepResult(stepNum, step, StepResultFailure, StepResultFailure)
+			}
+			if err != nil {
+				return fmt.Errorf("step %d failed: %w (%v)", stepNum, stepErr, err)
 			}
+			if !continueOnError {
+				return fmt.Errorf("step %d failed: %w", stepNum, stepErr)
+			}
+			jobCtx.recordStepResult(stepNum, step, StepResultFailure, StepResultSuccess)
+			warnf("      Warning: %s failed but continue-on-error is set: %v\n", stepLabel(stepNum, step), stepErr)
+			jobCtx.Run.RecordToleratedFailure(fmt.Sprintf("job %s, %s (%s): %v", jobCtx.JobName, stepLabel(stepNum, step), step.Name, stepErr))
+			continue
+		}
+
+		jobCtx.recordStepResult(stepNum, step, StepResultSuccess, StepResultSuccess)
+
+		// Make outputs available to later steps as ${{ steps.<id>.outputs.<name> }}
+		if step.ID != "" && outputs != nil {
+			jobCtx.StepOutputs[step.ID] = outputs
+			infof("      Step outputs: %s\n", jobCtx.Run.Masker.Mask(fmt.Sprintf("%v", outputs)))
 		}
 	}
 
-	// Track step outputs
-	stepOutputs := make(map[string]map[string]string)
+	return nil
+}
 
-	// Execute each step in the composite action
-	for i, actionStep := range meta.Runs.Steps {
-		fmt.Printf("        Action Step %d: %s\n", i+1, actionStep.Name)
+func executeRunStep(step *Step, jobDir, runnerImage string, config *Config, workflowEnv map[string]string, jobCtx *JobContext) error {
+	// Create GitHub Actions environment files
+	if err := prepareGitHubFiles(jobDir); err != nil {
+		return err
+	}
+
+	// Prepare environment variables
+	env := envArgs(jobCtx.stepEnv(config, step))
+	env = append(env, jobCtx.permissionsEnv()...)
+
+	// Add GitHub Actions environment files
+	env = append(env, "-e", "GITHUB_OUTPUT=/workspace/github_output.txt")
+	env = append(env, "-e", "GITHUB_ENV=/workspace/github_env.txt")
+
+	// Build docker run command
+	args := []string{
+		"run", "--rm",
+		"--network", "host", // Enable network access for GitHub operations
+		"-v", fmt.Sprintf("%s:/workspace", jobDir),
+		"--workdir", "/workspace",
+	}
+	args = append(args, containerRunOptions(config)...)
+	args = append(args, runStepEntrypoint(config)...)
+
+	// Add environment variables
+	args = append(args, env...)
+
+	// Add image
+	args = append(args, runnerImage)
+
+	// Add shell command
+	shellArgs, err := shellCommand(step.Shell, step.Run, jobDir, config)
+	if err != nil {
+		return err
+	}
+	args = append(args, shellArgs...)
+
+	// Execute command
+	cmd := jobCtx.dockerCommand(args...)
+	stdout := newStepOutputWriter(os.Stdout, jobCtx, step.Name)
+	stderr := newStepOutputWriter(os.Stderr, jobCtx, step.Name)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return cmd.Run()
+}
+
+// vermontLabel marks every container Vermont starts, so they can be found with
+// docker ps --filter label=vermont=true
+const vermontLabel = "vermont=true"
+
+// containerLabelArgs returns the --label arguments for vermontLabel and the configured labels
+func containerLabelArgs(config *Config) []string {
+	args := []string{"--label", vermontLabel}
+	for _, label := range config.Container.Labels {
+		args = append(args, "--label", label)
+	}
+	return args
+}
+
+// fixWorkspacePermissions changes the owner of everything in the job workspace to the user
+// running Vermont. It runs chown as root in a throwaway container of the runner image, since
+// the host user can't change the owner of files a container created as root.
+func fixWorkspacePermissions(jobDir, runnerImage string, config *Config) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 {
+		return nil // no numeric owners on this platform (Windows)
+	}
+
+	owner := fmt.Sprintf("%d:%d", uid, gid)
+	debugf("      Fixing workspace ownership: chown -R %s\n", owner)
+	args := []string{"run", "--rm"}
+	args = append(args, containerLabelArgs(config)...)
+	args = append(args,
+		"--user", "0:0",
+		"--entrypoint", "",
+		"-v", fmt.Sprintf("%s:/workspace", jobDir),
+		runnerImage, "chown", "-R", owner, "/workspace")
+	cmd := exec.Command("docker", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to fix workspace permissions: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// maxStepNameLength caps names derived from run commands so log lines stay readable
+const maxStepNameLength = 80
+
+// stepDisplayName returns the step's name, or like GitHub "Run <first line of the script>"
+// or "Run <action reference>" for steps without one
+func stepDisplayName(name, run, uses string) string {
+	if name != "" {
+		return name
+	}
+
+	var subject string
+	if run != "" {
+		for _, line := range strings.Split(run, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				subject = line
+				break
+			}
+		}
+		if runes := []rune(subject); len(runes) > maxStepNameLength {
+			subject = string(runes[:maxStepNameLength-3]) + "..."
+		}
+	} else {
+		subject = uses
+	}
+
+	if subject == "" {
+		return ""
+	}
+	return "Run " + subject
+}
+
+// resolveStepShell picks the shell for a run step: the step's shell, then the job's
+// defaults.run.shell (which includes the workflow default), then a guess based on the image
+func resolveStepShell(step *Step, job *Job, image string) string {
+	if step.Shell != "" {
+		return step.Shell
+	}
+	if job.Defaults.Run.Shell != "" {
+		return job.Defaults.Run.Shell
+	}
+	return defaultShellForImage(image)
+}
+
+// defaultShellForImage returns bash unless the image is a minimal distribution that usually lacks it
+// or a Windows image
+func defaultShellForImage(image string) string {
+	// All runner images install bash, including the alpine one
+	if strings.HasPrefix(image, "vermont-runner:") {
+		return "bash"
+	}
 
-		// Substitute templates in run command and name
-		substitutedRun := substituteActionTemplates(actionStep.Run, inputs, stepOutputs)
-		substitutedName := substituteActionTemplates(actionStep.Name, inputs, stepOutputs)
+	name := strings.ToLower(image)
+	if strings.Contains(name, "alpine") || strings.Contains(name, "busybox") {
+		return "sh"
+	}
+	// Like GitHub's Windows runners, Windows images default to PowerShell
+	if strings.Contains(name, "windows") || strings.Contains(name, "nanoserver") || strings.Contains(name, "servercore") {
+		return "pwsh"
+	}
+	return "bash"
+}
 
-		// Create step with combined environment
-		combinedEnv := make(map[string]string)
-		for k, v := range actionEnv {
-			combinedEnv[k] = v
-		}
-		for k, v := range actionStep.Env {
-			combinedEnv[k] = substituteActionTemplates(v, inputs, stepOutputs)
-		}
+// shellCommand builds the container command that runs a script with the step's shell.
+// Like GitHub, bash fails on the first failing command or pipeline stage by default; a custom
+// shell template such as "bash {0}" runs the script file exactly as given and opts out of that.
+func shellCommand(shell, script, jobDir string, config *Config) ([]string, error) {
+	shell = strings.TrimSpace(shell)
+
+	switch shell {
+	case "", "bash":
+		args := []string{"bash", "--noprofile", "--norc"}
+		args = append(args, strings.Fields(config.Runner.BashOptions)...)
+		return append(args, "-c", script), nil
+	case "sh":
+		return []string{"sh", "-e", "-c", script}, nil
+	case "pwsh", "powershell":
+		// Like GitHub, stop on the first error and fail with the exit code of the last native command
+		script = "$ErrorActionPreference = 'stop'\n" + script + "\nif ((Test-Path -LiteralPath variable:\\LASTEXITCODE)) { exit $LASTEXITCODE }"
+		return []string{shell, "-Command", script}, nil
+	case "cmd":
+		return []string{"cmd", "/D", "/E:ON", "/V:OFF", "/S", "/C", script}, nil
+	case "python":
+		return []string{"python", "-c", script}, nil
+	}
 
-		stepToExecute := &Step{
-			Name: substitutedName,
-			Run:  substitutedRun,
-			Uses: actionStep.Uses,
-			With: actionStep.With,
-			Env:  combinedEnv,
+	// Custom shells receive the path of a file holding the script in place of {0}
+	if strings.Contains(shell, "{0}") {
+		scriptPath := filepath.Join(jobDir, "vermont_step_script")
+		if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+			return nil, fmt.Errorf("failed to write step script: %w", err)
 		}
+		return strings.Fields(strings.ReplaceAll(shell, "{0}", "/workspace/vermont_step_script")), nil
+	}
 
-		if actionStep.Run != "" {
-			// Mount both job directory and action directory
-			if err := executeActionRunStep(stepToExecute, jobDir, runnerImage, config, actionDir); err != nil {
-				return fmt.Errorf("action step %d failed: %w", i+1, err)
-			}
+	return []string{shell, "-c", script}, nil
+}
 
-			// If step has an ID, capture its outputs
-			if actionStep.ID != "" {
-				githubOutputPath := filepath.Join(jobDir, "github_output.txt")
-				outputs, err := parseStepOutputs(githubOutputPath)
-				if err != nil {
-					fmt.Printf("        Warning: failed to parse step outputs: %v\n", err)
-				} else {
-					stepOutputs[actionStep.ID] = outputs
-					fmt.Printf("        Step outputs: %v\n", outputs)
-				}
+// mirrorImageRef rewrites an image reference without a registry host to use the registry mirror
+func mirrorImageRef(image, mirror string) string {
+	if mirror == "" {
+		return image
+	}
 
-				// Clear the output file for next step
-				if err := os.WriteFile(githubOutputPath, []byte(""), 0644); err != nil {
-					fmt.Printf("        Warning: failed to clear output file: %v\n", err)
-				}
-			}
-		} else if actionStep.Uses != "" {
-			// Recursive action call
-			if err := executeAction(stepToExecute, jobDir, runnerImage, config, stepsDir); err != nil {
-				return fmt.Errorf("nested action step %d failed: %w", i+1, err)
-			}
-		}
+	// Fully-qualified images already name a registry host (e.g. ghcr.io/..., localhost:5000/...)
+	if imageRegistry(image) != "" {
+		return image
+	}
+	if !strings.Contains(image, "/") {
+		// Official images live under the library namespace
+		image = "library/" + image
 	}
 
-	return nil
+	return strings.TrimSuffix(mirror, "/") + "/" + image
 }
 
-// executeNodeAction executes a Node.js action
-func executeNodeAction(actionMeta interface{}, step *Step, jobDir, runnerImage string, config *Config, actionDir string) error {
-	meta := actionMeta.(*struct {
-		Runs struct {
-			Using string `yaml:"using"`
-			Main  string `yaml:"main"`
-			Steps []struct {
-				Name string                 `yaml:"name"`
-				Run  string                 `yaml:"run"`
-				Uses string                 `yaml:"uses"`
-				With map[string]interface{} `yaml:"with"`
-				Env  map[string]string      `yaml:"env"`
-				ID   string                 `yaml:"id"`
-			} `yaml:"steps"`
-		} `yaml:"runs"`
-		Inputs map[string]struct {
-			Description string `yaml:"description"`
-			Required    bool   `yaml:"required"`
-			Default     string `yaml:"default"`
-		} `yaml:"inputs"`
-	})
+// imageRegistry returns the registry host an image names, such as ghcr.io or
+// localhost:5000, or nothing for Docker Hub images
+func imageRegistry(image string) string {
+	host, _, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return host
+	}
+	return ""
+}
 
-	// Prepare environment with input variables
-	env := make([]string, 0)
+// imageExists reports whether an image is present locally
+func imageExists(image string) bool {
+	output, err := exec.Command("docker", "images", "-q", image).Output()
+	return err == nil && len(strings.TrimSpace(string(output))) > 0
+}
 
-	// First, collect all input names that user explicitly provided
-	userProvidedInputs := make(map[string]bool)
-	if step.With != nil {
-		for inputName := range step.With {
-			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(inputName))
-			userProvidedInputs[envName] = true
+// ensureImage makes an image available locally according to the pull policy: never only
+// accepts local images, missing pulls absent ones and always pulls every time
+func ensureImage(image string, config *Config) error {
+	switch config.Container.PullPolicy {
+	case pullAlways:
+		return pullImage(image, config)
+	case pullNever:
+		if !imageExists(image) {
+			return fmt.Errorf("image %s is not available locally and the pull policy is never", image)
+		}
+		return nil
+	default:
+		if imageExists(image) {
+			return nil
 		}
+		return pullImage(image, config)
 	}
+}
 
-	// Add config environment variables (skip ones that user will override)
-	configKeys := make([]string, 0, len(config.Env))
-	for key := range config.Env {
-		if !userProvidedInputs[key] {
-			configKeys = append(configKeys, key)
+// prepareBaseImages applies the pull policy to the base images of a Dockerfile before it is
+// built and returns the docker build flags the policy needs
+func prepareBaseImages(dockerfilePath string, config *Config) ([]string, error) {
+	// Without a mirror docker build pulls missing base images itself, or all of them with --pull
+	if config.Container.RegistryMirror == "" && config.Container.PullPolicy != pullNever {
+		if config.Container.PullPolicy == pullAlways {
+			return []string{"--pull"}, nil
 		}
+		return nil, nil
 	}
-	fmt.Printf("DEBUG Config env keys (after filtering user inputs): %v\n", configKeys)
-	for key, value := range config.Env {
-		if !userProvidedInputs[key] {
-			env = append(env, "-e", fmt.Sprintf("%s=%s", key, value))
-		} else {
-			fmt.Printf("DEBUG Config: Skipping %s (will be overridden by user input)\n", key)
+
+	// Otherwise pull base images through the registry mirror so the build doesn't reach
+	// Docker Hub, or make sure they are already present
+	baseImages, err := dockerfileBaseImages(dockerfilePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, baseImage := range baseImages {
+		if err := ensureImage(baseImage, config); err != nil {
+			return nil, err
 		}
 	}
+	return nil, nil
+}
 
-	// Set inputs from step.With
-	if step.With != nil {
-		for inputName, value := range step.With {
-			// Expand environment variables in the value
-			expandedValue := expandEnvironmentVariables(fmt.Sprintf("%v", value))
-			// Also expand workflow templates like ${{ github.token }}
-			expandedValue = substituteWorkflowTemplates(expandedValue, make(map[string]string), config.Env)
-			envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-			env = append(env, "-e", fmt.Sprintf("%s=%s", envName, expandedValue))
-		}
+// pullImage pulls an image, going through the registry mirror when one is configured
+func pullImage(image string, config *Config) error {
+	return pullImageRef(mirrorImageRef(image, config.Container.RegistryMirror), image, config, nil)
+}
+
+// pullPrivateImage logs in to the image's registry and pulls it from there, bypassing the
+// registry mirror. The login goes to a throwaway docker config, so it is only used for this
+// pull: it doesn't touch ~/.docker and the credentials never reach a step. The password is
+// passed on stdin, so it doesn't show up in the process list.
+func pullPrivateImage(image, username, password string, config *Config) error {
+	dockerConfig, err := os.MkdirTemp("", "vermont-docker-config-")
+	if err != nil {
+		return fmt.Errorf("failed to create docker config directory: %w", err)
+	}
+	defer os.RemoveAll(dockerConfig)
+
+	registry := imageRegistry(image)
+	loginArgs := []string{"--config", dockerConfig, "login", "--username", username, "--password-stdin"}
+	if registry != "" {
+		loginArgs = append(loginArgs, registry)
+	} else {
+		registry = "Docker Hub"
+	}
+	infof("  Logging in to %s as %s\n", registry, username)
+
+	var output bytes.Buffer
+	loginCmd := exec.Command("docker", loginArgs...)
+	loginCmd.Stdin = strings.NewReader(password)
+	loginCmd.Stdout = &output
+	loginCmd.Stderr = &output
+	if err := loginCmd.Run(); err != nil {
+		return fmt.Errorf("docker login to %s failed: %w: %s", registry, err, strings.TrimSpace(output.String()))
 	}
 
-	// Set default values for inputs not provided in step.With
-	providedInputs := make(map[string]bool)
-	if step.With != nil {
-		for inputName := range step.With {
-			providedInputs[inputName] = true
+	return pullImageRef(image, image, config, []string{"--config", dockerConfig})
+}
+
+// pullCommandRunner runs the docker pull and tag commands of pullImageRef; tests replace it to
+// stand in for a registry
+var pullCommandRunner = func(args []string, stdout, stderr io.Writer) error {
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// pullImageRef pulls pullRef and tags it as image when the two differ. dockerArgs are
+// global docker options, such as --config.
+func pullImageRef(pullRef, image string, config *Config, dockerArgs []string) error {
+	// Transient registry and network errors are retried with exponential backoff
+	retries := 0
+	if config.Container.PullRetries != nil {
+		retries = *config.Container.PullRetries
+	}
+	backoff := time.Duration(config.Container.PullRetryBackoff) * time.Second
+	for attempt := 0; ; attempt++ {
+		infof("  Pulling image: %s\n", pullRef)
+		var stderr bytes.Buffer
+		err := pullCommandRunner(append(dockerArgs, quietCommand("pull", pullRef)...), progressOutput(), io.MultiWriter(os.Stderr, &stderr))
+		if err == nil {
+			break
 		}
+		if attempt >= retries || !isTransientPullError(stderr.String()) {
+			return fmt.Errorf("docker pull %s failed: %w", pullRef, err)
+		}
+		delay := backoff << attempt
+		warnf("  Warning: pulling %s failed, retrying in %s (%d of %d)\n", pullRef, delay, attempt+1, retries)
+		time.Sleep(delay)
 	}
 
-	// Add defaults from action metadata
-	for inputName, inputSpec := range meta.Inputs {
-		fmt.Printf("DEBUG Defaults: checking input '%s', providedInputs[%s] = %v\n", inputName, inputName, providedInputs[inputName])
-		if !providedInputs[inputName] {
-			defaultValue := inputSpec.Default
-			fmt.Printf("DEBUG Action: %s input %s default: '%s'\n", step.Uses, inputName, defaultValue)
+	// Tag mirrored images with their original name so Dockerfiles resolve them locally
+	if pullRef != image {
+		if err := pullCommandRunner([]string{"tag", pullRef, image}, nil, os.Stderr); err != nil {
+			return fmt.Errorf("docker tag %s failed: %w", pullRef, err)
+		}
+	}
 
-			// Special handling for common GitHub Actions defaults
-			if inputName == "token" && defaultValue == "" {
-				// Checkout action and many others expect GITHUB_TOKEN as default
-				defaultValue = "${GITHUB_TOKEN}"
-			}
-			if inputName == "github-token" && defaultValue == "" {
-				// GitHub script action and others expect GITHUB_TOKEN as default
-				defaultValue = "${GITHUB_TOKEN}"
-			}
+	return nil
+}
 
-			// For required inputs, we need to ensure they have a value
-			if inputSpec.Required && defaultValue == "" {
-				// Try to map to a GitHub environment variable
-				switch inputName {
-				case "token", "github-token":
-					if token, exists := config.Env["GITHUB_TOKEN"]; exists && token != "" {
-						defaultValue = token
-					}
-				case "repository":
-					if repo, exists := config.Env["GITHUB_REPOSITORY"]; exists && repo != "" {
-						defaultValue = repo
-					}
-				}
-			}
+// permanentPullErrors are parts of docker pull errors that retrying can't fix: the tag doesn't
+// exist, or the repository doesn't or isn't accessible. They are specific enough not to match
+// network errors, such as a registry host that was "not found" by DNS.
+var permanentPullErrors = []string{
+	"manifest unknown",
+	"repository does not exist",
+	"pull access denied",
+}
 
-			if defaultValue != "" {
-				expandedValue := expandEnvironmentVariables(defaultValue)
-				// Also process workflow templates for default values
-				expandedValue = substituteWorkflowTemplates(expandedValue, make(map[string]string), config.Env)
-				envName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-				env = append(env, "-e", fmt.Sprintf("%s=%s", envName, expandedValue))
-				providedInputs[inputName] = true
-			}
+// isTransientPullError reports whether a failed pull is worth retrying, judging by docker's
+// error output. Anything that doesn't say the image is missing or inaccessible, such as a
+// timeout, a reset connection or a 5xx from the registry, is considered transient.
+func isTransientPullError(output string) bool {
+	output = strings.ToLower(output)
+	for _, marker := range permanentPullErrors {
+		if strings.Contains(output, marker) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Generic GitHub environment variable mapping for action inputs
-	// If action requires an input that maps to a GITHUB_ environment variable, provide it automatically
-	for inputName := range meta.Inputs {
-		if !providedInputs[inputName] {
-			// Convert input name to potential GITHUB_ environment variable name
-			// Examples: "token" -> "GITHUB_TOKEN", "github-token" -> "GITHUB_TOKEN", "repository" -> "GITHUB_REPOSITORY"
-			var githubEnvName string
+// dockerfileBaseImages returns the images referenced by FROM instructions in a Dockerfile
+func dockerfileBaseImages(dockerfilePath string) ([]string, error) {
+	data, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Dockerfile: %w", err)
+	}
 
-			// Handle common mappings
-			switch inputName {
-			case "token", "github-token":
-				githubEnvName = "GITHUB_TOKEN"
-			case "repository":
-				githubEnvName = "GITHUB_REPOSITORY"
-			case "ref":
-				githubEnvName = "GITHUB_REF"
-			case "sha":
-				githubEnvName = "GITHUB_SHA"
-			case "workspace":
-				githubEnvName = "GITHUB_WORKSPACE"
-			case "actor":
-				githubEnvName = "GITHUB_ACTOR"
-			default:
-				// For other inputs, try mapping directly
-				// Convert input-name to GITHUB_INPUT_NAME format
-				candidate := fmt.Sprintf("GITHUB_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-				// Only use if it exists in our config
-				if _, exists := config.Env[candidate]; exists {
-					githubEnvName = candidate
-				}
-			}
+	var images []string
+	stages := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
 
-			// If we found a mapping and the environment variable exists, use it
-			if githubEnvName != "" {
-				if githubValue, exists := config.Env[githubEnvName]; exists && githubValue != "" {
-					// Check if this input wasn't already processed (avoid duplicates)
-					inputEnvName := fmt.Sprintf("INPUT_%s", strings.ToUpper(strings.ReplaceAll(inputName, "-", "_")))
-					alreadySet := false
-					for i := 0; i < len(env); i += 2 {
-						if env[i] == "-e" && i+1 < len(env) && strings.HasPrefix(env[i+1], inputEnvName+"=") {
-							alreadySet = true
-							break
-						}
-					}
+		// Skip flags like --platform
+		args := fields[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
 
-					if !alreadySet {
-						env = append(env, "-e", fmt.Sprintf("%s=%s", inputEnvName, githubValue))
-					}
-				}
-			}
+		// References to earlier build stages and scratch are not pullable
+		image := args[0]
+		if image != "scratch" && !stages[strings.ToLower(image)] {
+			images = append(images, image)
+		}
+		if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
 		}
 	}
 
-	args := []string{
-		"run", "--rm",
-		"--network", "host", // Enable network access for GitHub operations
-		"-v", fmt.Sprintf("%s:/workspace", jobDir),
-		"-v", fmt.Sprintf("%s:/action", actionDir),
-		"--workdir", "/workspace",
-	}
+	return images, nil
+}
 
-	// Add environment variables
-	args = append(args, env...)
+// Annotation represents an error, warning or notice emitted via a workflow command
+type Annotation struct {
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Title     string `json:"title,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	Column    int    `json:"col,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Job       string `json:"job"`
+	Step      string `json:"step,omitempty"`
+}
 
-	// Add image
-	args = append(args, runnerImage)
+// AnnotationCollector gathers annotations from concurrently running jobs
+type AnnotationCollector struct {
+	mu          sync.Mutex
+	annotations []Annotation
+}
 
-	// Run node with the action's main file
-	mainFile := meta.Runs.Main
-	if mainFile == "" {
-		mainFile = "index.js"
-	}
-	args = append(args, "node", filepath.Join("/action", mainFile))
+// Add records an annotation
+func (c *AnnotationCollector) Add(annotation Annotation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Execute command
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	c.annotations = append(c.annotations, annotation)
+}
 
-	return cmd.Run()
+// All returns a copy of the recorded annotations
+func (c *AnnotationCollector) All() []Annotation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Annotation(nil), c.annotations...)
 }
 
-// executeActionRunStep executes a run step within an action context
-func executeActionRunStep(step *Step, jobDir, runnerImage string, config *Config, actionDir string) error {
-	// Create GitHub Actions environment files
-	githubOutputPath := filepath.Join(jobDir, "github_output.txt")
-	githubEnvPath := filepath.Join(jobDir, "github_env.txt")
+// Masker hides registered secret values in output for the rest of the run.
+// It is shared by all jobs and steps, so values registered by one step are masked everywhere after.
+type Masker struct {
+	mu     sync.RWMutex
+	values []string
+}
 
-	// Create empty files if they don't exist
-	if _, err := os.Stat(githubOutputPath); os.IsNotExist(err) {
-		if err := os.WriteFile(githubOutputPath, []byte(""), 0644); err != nil {
-			return fmt.Errorf("failed to create GITHUB_OUTPUT file: %w", err)
+// Add registers a value to mask; each line of a multiline value is masked on its own
+// because output is processed line by line
+func (m *Masker) Add(value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, line := range strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
 		}
-	}
-	if _, err := os.Stat(githubEnvPath); os.IsNotExist(err) {
-		if err := os.WriteFile(githubEnvPath, []byte(""), 0644); err != nil {
-			return fmt.Errorf("failed to create GITHUB_ENV file: %w", err)
+
+		exists := false
+		for _, existing := range m.values {
+			if existing == line {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			m.values = append(m.values, line)
 		}
 	}
+}
 
-	// Prepare environment variables
-	env := make([]string, 0)
-
-	// Add config environment variables
-	for key, value := range config.Env {
-		env = append(env, "-e", fmt.Sprintf("%s=%s", key, value))
+// Mask replaces every registered value in text with ***. Values are found in the original
+// text and each run of masked characters is replaced once, so values that contain or overlap
+// each other are hidden whole instead of one leaving part of another behind.
+func (m *Masker) Mask(text string) string {
+	if m == nil {
+		return text
 	}
 
-	// Add GitHub Actions environment files
-	env = append(env, "-e", "GITHUB_OUTPUT=/workspace/github_output.txt")
-	env = append(env, "-e", "GITHUB_ENV=/workspace/github_env.txt")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	// Add step-specific environment variables
-	for key, value := range step.Env {
-		env = append(env, "-e", fmt.Sprintf("%s=%s", key, value))
+	masked := m.coverage(text, 0)
+	if masked == nil {
+		return text
 	}
+	return replaceMasked(text, masked, false)
+}
 
-	// Build docker run command with both workspace and action mounted
-	args := []string{
-		"run", "--rm",
-		"--network", "host", // Enable network access for GitHub operations
-		"-v", fmt.Sprintf("%s:/workspace", jobDir),
-		"-v", fmt.Sprintf("%s:/action", actionDir),
-		"--workdir", "/action",
+// MaskChunk masks text that arrives in pieces, such as a line too long to buffer whole. It
+// returns the part that is safe to write and the rest to pass back with the next piece: the
+// end that could be the start of a value split across pieces. covered counts the leading
+// bytes of text that belong to a value already written as ***. A final chunk is masked whole.
+func (m *Masker) MaskChunk(text string, covered int, final bool) (masked, rest string, restCovered int) {
+	if m == nil {
+		return text, "", 0
 	}
 
-	// Add environment variables
-	args = append(args, env...)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	// Add image
-	args = append(args, runnerImage)
+	coverage := m.coverage(text, covered)
+	cut := len(text)
+	if !final {
+		longest := 0
+		for _, value := range m.values {
+			longest = max(longest, len(value))
+		}
+		cut = max(len(text)-max(longest-1, 0), 0)
+	}
 
-	// Add shell command
-	args = append(args, "bash", "-c", step.Run)
+	// Bytes after the cut that continue a value being masked are already hidden
+	if cut > 0 && cut < len(text) && coverage != nil && coverage[cut-1] {
+		for restCovered < len(text)-cut && coverage[cut+restCovered] {
+			restCovered++
+		}
+	}
+	if coverage == nil {
+		return text[:cut], text[cut:], 0
+	}
+	return replaceMasked(text[:cut], coverage[:cut], covered > 0), text[cut:], restCovered
+}
 
-	// Execute command
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// coverage marks the bytes of text that belong to a registered value, counting the first
+// covered bytes as masked already; it returns nil when nothing is masked
+func (m *Masker) coverage(text string, covered int) []bool {
+	var masked []bool
+	mark := func(from, to int) {
+		if masked == nil {
+			masked = make([]bool, len(text))
+		}
+		for i := from; i < to; i++ {
+			masked[i] = true
+		}
+	}
+	if covered > 0 {
+		mark(0, min(covered, len(text)))
+	}
+
+	for _, value := range m.values {
+		for start := 0; ; start++ {
+			i := strings.Index(text[start:], value)
+			if i < 0 {
+				break
+			}
+			start += i
+			mark(start, start+len(value))
+		}
+	}
+	return masked
+}
+
+// replaceMasked replaces each run of masked bytes with ***; continued leaves out the *** of a
+// leading run that was already written as part of an earlier piece
+func replaceMasked(text string, masked []bool, continued bool) string {
+	var result strings.Builder
+	for i := 0; i < len(text); i++ {
+		if !masked[i] {
+			result.WriteByte(text[i])
+		} else if (i == 0 && !continued) || (i > 0 && !masked[i-1]) {
+			result.WriteString("***")
+		}
+	}
+	return result.String()
+}
 
-	return cmd.Run()
+// WorkflowCommand represents a parsed ::name key=value,...::message line
+type WorkflowCommand struct {
+	Name       string
+	Properties map[string]string
+	Message    string
 }
 
-func executeWorkflow(workflow *Workflow, config *Config) error {
-	fmt.Printf("Executing workflow: %s\n", workflow.Name)
+// parseWorkflowCommand parses a workflow command line, returning nil for ordinary output
+func parseWorkflowCommand(line string) *WorkflowCommand {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasPrefix(line, "::") {
+		return nil
+	}
 
-	// Create pipeline temp directory
-	pipelineDir, err := createPipelineDir(workflow.Name)
-	if err != nil {
-		return fmt.Errorf("failed to create pipeline directory: %w", err)
+	header, message, ok := strings.Cut(line[2:], "::")
+	if !ok || header == "" {
+		return nil
 	}
-	defer func() {
-		if removeErr := os.RemoveAll(pipelineDir); removeErr != nil {
-			fmt.Printf("Warning: failed to cleanup pipeline directory %s: %v\n", pipelineDir, removeErr)
-		}
-	}()
 
-	// Expand matrix jobs
-	expandedJobs := expandMatrixJobs(workflow.Jobs)
+	cmd := &WorkflowCommand{
+		Properties: make(map[string]string),
+		Message:    unescapeCommandData(message),
+	}
 
-	// Build dependency graph and execute jobs
-	return executeJobs(expandedJobs, config, pipelineDir, workflow.Env)
+	name, properties, _ := strings.Cut(header, " ")
+	cmd.Name = name
+	for _, property := range strings.Split(properties, ",") {
+		if key, value, ok := strings.Cut(property, "="); ok && key != "" {
+			cmd.Properties[strings.TrimSpace(key)] = unescapeCommandProperty(value)
+		}
+	}
+
+	return cmd
 }
 
-func createPipelineDir(workflowName string) (string, error) {
-	// Generate random suffix
-	suffix := fmt.Sprintf("%06d", rand.Intn(1000000))
+// unescapeCommandData reverses the escaping applied to workflow command messages
+func unescapeCommandData(value string) string {
+	return strings.NewReplacer("%0D", "\r", "%0A", "\n", "%25", "%").Replace(value)
+}
 
-	// Clean workflow name for directory
-	cleanName := strings.ReplaceAll(strings.ToLower(workflowName), " ", "-")
-	dirName := fmt.Sprintf("%s-%s", cleanName, suffix)
+// unescapeCommandProperty reverses the escaping applied to workflow command properties
+func unescapeCommandProperty(value string) string {
+	return strings.NewReplacer("%0D", "\r", "%0A", "\n", "%3A", ":", "%2C", ",", "%25", "%").Replace(value)
+}
 
-	pipelineDir := filepath.Join("/tmp", dirName)
-	return pipelineDir, os.MkdirAll(pipelineDir, 0755)
+// stepOutputWriter passes step output through line by line while processing workflow commands
+type stepOutputWriter struct {
+	out    io.Writer
+	jobCtx *JobContext
+	step   string
+	stream string
+	buf    []byte
+
+	// limit caps the buffered partial line; longer lines are streamed through unparsed,
+	// holding back only the end that may be part of a masked value split across writes
+	limit          int
+	passthrough    bool
+	pending        string
+	pendingCovered int
 }
 
-func executeJobs(jobs map[string]*Job, config *Config, pipelineDir string, workflowEnv map[string]string) error {
-	// Create steps directory for actions
-	stepsDir := filepath.Join(pipelineDir, "steps")
-	if err := os.MkdirAll(stepsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create steps directory: %w", err)
+// newStepOutputWriter creates an output writer for a step of the given job
+func newStepOutputWriter(out io.Writer, jobCtx *JobContext, step string) *stepOutputWriter {
+	stream := "stdout"
+	if out == os.Stderr {
+		stream = "stderr"
 	}
+	return &stepOutputWriter{out: out, jobCtx: jobCtx, step: step, stream: stream, limit: jobCtx.maxOutputBytes()}
+}
 
-	// Build dependency graph and execute jobs with proper dependency resolution
-	return executeJobsWithDependencies(jobs, config, pipelineDir, stepsDir, workflowEnv)
+// stepLogEvent is a line of step output written by --json-logs
+type stepLogEvent struct {
+	Time   string `json:"time"`
+	Job    string `json:"job"`
+	Step   string `json:"step"`
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
 }
 
-func executeJobsWithDependencies(jobs map[string]*Job, config *Config, pipelineDir, stepsDir string, workflowEnv map[string]string) error {
-	// Validate dependencies
-	if err := validateJobDependencies(jobs); err != nil {
-		return fmt.Errorf("dependency validation failed: %w", err)
+// jsonLogs reports whether output is written as JSON events
+func (w *stepOutputWriter) jsonLogs() bool {
+	return w.jobCtx != nil && w.jobCtx.Run != nil && w.jobCtx.Run.Options != nil && w.jobCtx.Run.Options.JSONLogs
+}
+
+// writeLine masks a line of output and writes it as raw text or as a JSON event
+func (w *stepOutputWriter) writeLine(line string) error {
+	return w.emitLine(w.masker().Mask(line))
+}
+
+// emitLine writes a masked line of output as raw text or as a JSON event
+func (w *stepOutputWriter) emitLine(line string) error {
+	if w.jobCtx != nil {
+		w.jobCtx.stepLog.WriteString(line + "\n")
+	}
+	if !w.jsonLogs() {
+		if w.jobCtx != nil && w.jobCtx.heldOutput != nil {
+			w.jobCtx.heldOutput.Write(w.out, line+"\n")
+			return nil
+		}
+		_, err := fmt.Fprintln(w.out, line)
+		return err
 	}
 
-	// Track job completion status
-	completed := make(map[string]bool)
-	inProgress := make(map[string]bool)
-	results := make(chan JobResult, len(jobs))
+	data, err := json.Marshal(stepLogEvent{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Job:    w.jobCtx.JobName,
+		Step:   w.step,
+		Stream: w.stream,
+		Line:   line,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w.out, string(data))
+	return err
+}
 
-	// Start executing jobs
-	for len(completed) < len(jobs) {
-		// Find jobs that can be executed (all dependencies completed)
-		readyJobs := findReadyJobs(jobs, completed, inProgress)
+// writeChunk writes part of an oversized line; final is set for the part that ends it. The
+// end of a chunk that may begin a masked value is held back until the next chunk shows
+// whether it does. As JSON each chunk becomes its own event.
+func (w *stepOutputWriter) writeChunk(chunk string, final bool) error {
+	chunk, w.pending, w.pendingCovered = w.masker().MaskChunk(w.pending+chunk, w.pendingCovered, final)
+	if w.jsonLogs() {
+		// The newline ending an oversized line carries no output of its own
+		if chunk = strings.TrimSuffix(chunk, "\n"); chunk == "" {
+			return nil
+		}
+		return w.emitLine(chunk)
+	}
+	if w.jobCtx != nil {
+		w.jobCtx.stepLog.WriteString(chunk)
+		if w.jobCtx.heldOutput != nil {
+			w.jobCtx.heldOutput.Write(w.out, chunk)
+			return nil
+		}
+	}
+	_, err := io.WriteString(w.out, chunk)
+	return err
+}
 
-		if len(readyJobs) == 0 {
-			if len(inProgress) == 0 {
-				return fmt.Errorf("circular dependency detected or no executable jobs remaining")
+func (w *stepOutputWriter) Write(p []byte) (int, error) {
+	for data := p; len(data) > 0; {
+		newline := bytes.IndexByte(data, '\n')
+
+		// Stream the remainder of an oversized line without buffering it
+		if w.passthrough {
+			end := len(data)
+			if newline != -1 {
+				end = newline + 1
+				w.passthrough = false
 			}
-			// Wait for a job to complete
-			result := <-results
-			inProgress[result.JobName] = false
-			completed[result.JobName] = true
-			if result.Error != nil {
-				return fmt.Errorf("job %s failed: %w", result.JobName, result.Error)
+			if err := w.writeChunk(string(data[:end]), newline != -1); err != nil {
+				return len(p), err
 			}
+			data = data[end:]
 			continue
 		}
 
-		// Execute ready jobs in parallel
-		for _, jobName := range readyJobs {
-			inProgress[jobName] = true
-			go func(jobName string, job *Job) {
-				result := JobResult{JobName: jobName}
-				result.Error = executeJobSync(jobName, job, config, pipelineDir, stepsDir, workflowEnv)
-				results <- result
-			}(jobName, jobs[jobName])
+		if newline == -1 {
+			w.buf = append(w.buf, data...)
+			if w.limit > 0 && len(w.buf) > w.limit {
+				// A line this long can't be a workflow command, so stop holding it in memory
+				err := w.writeChunk(string(w.buf), false)
+				w.buf = nil
+				w.passthrough = true
+				if err != nil {
+					return len(p), err
+				}
+			}
+			break
 		}
 
-		// Wait for at least one job to complete before checking for more ready jobs
-		if len(readyJobs) > 0 {
-			result := <-results
-			inProgress[result.JobName] = false
-			completed[result.JobName] = true
-			if result.Error != nil {
-				return fmt.Errorf("job %s failed: %w", result.JobName, result.Error)
-			}
+		w.buf = append(w.buf, data[:newline]...)
+		line := string(w.buf)
+		w.buf = nil
+		data = data[newline+1:]
+		if err := w.processLine(line); err != nil {
+			return len(p), err
 		}
 	}
-
-	return nil
+	return len(p), nil
 }
 
-type JobResult struct {
-	JobName string
-	Error   error
+// Flush processes any trailing output that didn't end with a newline
+func (w *stepOutputWriter) Flush() {
+	if w.passthrough {
+		w.passthrough = false
+		_ = w.writeChunk("\n", true)
+	}
+	if len(w.buf) > 0 {
+		line := string(w.buf)
+		w.buf = nil
+		_ = w.processLine(line)
+	}
 }
 
-func validateJobDependencies(jobs map[string]*Job) error {
-	for jobName, job := range jobs {
-		for _, dep := range job.Needs {
-			if _, exists := jobs[dep]; !exists {
-				return fmt.Errorf("job %s depends on non-existent job %s", jobName, dep)
+// processLine handles workflow commands in a single line of output and writes it through
+func (w *stepOutputWriter) processLine(line string) error {
+	// While commands are stopped, command-like text is ordinary output
+	if w.jobCtx != nil {
+		if stopped, consumed := w.jobCtx.commandsStopped(line); stopped {
+			if consumed {
+				return nil
 			}
+			return w.writeLine(line)
 		}
 	}
-	return nil
-}
-
-func findReadyJobs(jobs map[string]*Job, completed, inProgress map[string]bool) []string {
-	var ready []string
-
-	for jobName, job := range jobs {
-		// Skip if already completed or in progress
-		if completed[jobName] || inProgress[jobName] {
-			continue
-		}
 
-		// Check if all dependencies are completed
-		allDepsCompleted := true
-		for _, dep := range job.Needs {
-			if !completed[dep] {
-				allDepsCompleted = false
-				break
+	if cmd := parseWorkflowCommand(line); cmd != nil {
+		switch cmd.Name {
+		case "stop-commands":
+			if w.jobCtx != nil && cmd.Message != "" {
+				w.jobCtx.stopCommands(cmd.Message)
+				return nil
 			}
-		}
-
-		if allDepsCompleted {
-			ready = append(ready, jobName)
+		case "error", "warning", "notice":
+			w.recordAnnotation(cmd)
+		case "set-output":
+			// Deprecated in favour of GITHUB_OUTPUT but still emitted by older actions
+			if w.jobCtx != nil && cmd.Properties["name"] != "" {
+				w.jobCtx.setLegacyOutput(cmd.Properties["name"], cmd.Message)
+				return nil
+			}
+		case "add-mask":
+			// The command line itself would reveal the value, so it isn't echoed
+			if masker := w.masker(); masker != nil {
+				masker.Add(cmd.Message)
+			}
+			return nil
 		}
 	}
 
-	return ready
+	return w.writeLine(line)
 }
 
-func executeJobSync(jobName string, job *Job, config *Config, pipelineDir, stepsDir string, workflowEnv map[string]string) error {
-	fmt.Printf("Job: %s\n", jobName)
-	fmt.Printf("  Runs on: %v\n", job.RunsOn)
-	fmt.Printf("  Steps: %d\n", len(job.Steps))
+// masker returns the run's masker, or nil when the writer isn't attached to a run
+func (w *stepOutputWriter) masker() *Masker {
+	if w.jobCtx == nil || w.jobCtx.Run == nil {
+		return nil
+	}
+	return w.jobCtx.Run.Masker
+}
 
-	// Create job directory
-	jobDir := filepath.Join(pipelineDir, jobName)
-	if err := os.MkdirAll(jobDir, 0755); err != nil {
-		return fmt.Errorf("failed to create job directory: %w", err)
+// recordAnnotation adds an annotation for an error, warning or notice command
+func (w *stepOutputWriter) recordAnnotation(cmd *WorkflowCommand) {
+	if w.jobCtx == nil || w.jobCtx.Run == nil {
+		return
+	}
+
+	atoi := func(key string) int {
+		value, _ := strconv.Atoi(cmd.Properties[key])
+		return value
+	}
+
+	w.jobCtx.Run.Annotations.Add(Annotation{
+		Level:     cmd.Name,
+		Message:   w.masker().Mask(cmd.Message),
+		Title:     w.masker().Mask(cmd.Properties["title"]),
+		File:      cmd.Properties["file"],
+		Line:      atoi("line"),
+		EndLine:   atoi("endLine"),
+		Column:    atoi("col"),
+		EndColumn: atoi("endColumn"),
+		Job:       w.jobCtx.JobName,
+		Step:      w.step,
+	})
+}
+
+// writeAnnotations writes the collected annotations as JSON or SARIF
+func writeAnnotations(annotations []Annotation, path, format string) error {
+	var report interface{} = annotations
+	if annotations == nil {
+		report = []Annotation{}
+	}
+	if format == "sarif" {
+		report = sarifReport(annotations)
 	}
 
-	// Get runner image
-	runnerImage, err := getRunnerImage(job.RunsOn)
+	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to get runner image: %w", err)
+		return fmt.Errorf("failed to marshal annotations: %w", err)
 	}
 
-	// Execute steps in container
-	return executeJobSteps(job, jobDir, runnerImage, config, stepsDir, workflowEnv)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write annotations file: %w", err)
+	}
+
+	infof("Annotations written to: %s (%d)\n", path, len(annotations))
+	return nil
 }
 
-func getRunnerImage(runsOn interface{}) (string, error) {
-	var runners []string
+// sarifReport converts annotations to a SARIF 2.1.0 log for code scanning tools
+func sarifReport(annotations []Annotation) map[string]interface{} {
+	levels := map[string]string{"error": "error", "warning": "warning", "notice": "note"}
 
-	switch v := runsOn.(type) {
-	case string:
-		runners = []string{v}
-	case []string:
-		runners = v
-	case []interface{}:
-		for _, item := range v {
-			if str, ok := item.(string); ok {
-				runners = append(runners, str)
+	results := make([]map[string]interface{}, 0, len(annotations))
+	for _, annotation := range annotations {
+		message := annotation.Message
+		if annotation.Title != "" {
+			message = annotation.Title + ": " + message
+		}
+
+		result := map[string]interface{}{
+			"ruleId":  "vermont/" + annotation.Level,
+			"level":   levels[annotation.Level],
+			"message": map[string]interface{}{"text": message},
+			"properties": map[string]interface{}{
+				"job":  annotation.Job,
+				"step": annotation.Step,
+			},
+		}
+
+		if annotation.File != "" {
+			region := map[string]interface{}{}
+			if annotation.Line > 0 {
+				region["startLine"] = annotation.Line
+			}
+			if annotation.EndLine > 0 {
+				region["endLine"] = annotation.EndLine
+			}
+			if annotation.Column > 0 {
+				region["startColumn"] = annotation.Column
+			}
+			if annotation.EndColumn > 0 {
+				region["endColumn"] = annotation.EndColumn
+			}
+
+			location := map[string]interface{}{
+				"artifactLocation": map[string]interface{}{"uri": annotation.File},
+			}
+			if len(region) > 0 {
+				location["region"] = region
+			}
+			result["locations"] = []interface{}{
+				map[string]interface{}{"physicalLocation": location},
 			}
 		}
-	default:
-		return "", fmt.Errorf("invalid runs-on type: %T", runsOn)
-	}
 
-	if len(runners) == 0 {
-		return "", fmt.Errorf("no runs-on specified")
+		results = append(results, result)
 	}
 
-	// Map GitHub runner names to our runner images
-	runnerMap := map[string]string{
-		"ubuntu-latest": "ubuntu-latest",
-		"ubuntu-22.04":  "ubuntu-22.04",
-		"ubuntu-20.04":  "ubuntu-20.04",
-		"debian-latest": "debian-latest",
-		"debian-12":     "debian-12",
-		"debian-11":     "debian-11",
-		"alpine-latest": "alpine-latest",
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "vermont",
+						"informationUri": "https://github.com/polatengin/vermont",
+					},
+				},
+				"results": results,
+			},
+		},
 	}
+}
 
-	runner := runners[0] // Use first runner
-	if dockerfileName, ok := runnerMap[runner]; ok {
-		imageName := fmt.Sprintf("vermont-runner:%s", dockerfileName)
+// maxTestOutputBytes caps the step output kept for a JUnit failure message
+const maxTestOutputBytes = 64 * 1024
 
-		// Build the image if it doesn't exist
-		if err := buildRunnerImage(dockerfileName, imageName); err != nil {
-			return "", fmt.Errorf("failed to build runner image: %w", err)
-		}
+// outputTruncated marks captured output that lost its beginning to the size limit
+const outputTruncated = "[output truncated]\n"
+
+// outputTail keeps the last limit bytes written to it; a nil tail discards everything
+type outputTail struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+// newOutputTail creates a tail that keeps at most limit bytes
+func newOutputTail(limit int) *outputTail {
+	return &outputTail{limit: limit}
+}
 
-		return imageName, nil
+// WriteString appends output, dropping the oldest bytes beyond the limit
+func (t *outputTail) WriteString(s string) {
+	if t == nil {
+		return
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	// Fall back to ubuntu-latest for unsupported runners
-	fmt.Printf("  Warning: unsupported runner '%s', falling back to ubuntu-latest\n", runner)
-	imageName := fmt.Sprintf("vermont-runner:%s", "ubuntu-latest")
+	t.buf = append(t.buf, s...)
+	if excess := len(t.buf) - t.limit; excess > 0 {
+		t.buf = append(t.buf[:0], t.buf[excess:]...)
+		t.truncated = true
+	}
+}
 
-	// Build the image if it doesn't exist
-	if err := buildRunnerImage("ubuntu-latest", imageName); err != nil {
-		return "", fmt.Errorf("failed to build fallback runner image: %w", err)
+// String returns the kept output, preceded by a marker when some of it was dropped
+func (t *outputTail) String() string {
+	if t == nil {
+		return ""
 	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	return imageName, nil
+	if t.truncated {
+		return outputTruncated + string(t.buf)
+	}
+	return string(t.buf)
 }
 
-func buildRunnerImage(dockerfileName, imageName string) error {
-	// Check if image exists
-	checkCmd := exec.Command("docker", "images", "-q", imageName)
-	output, _ := checkCmd.Output()
-	if len(strings.TrimSpace(string(output))) > 0 {
-		fmt.Printf("  Container: %s (exists)\n", imageName)
-		return nil // Image already exists
+// heldOutput collects a step's output lines, with the writer each belongs to, so that only
+// the end of a successful step's output needs to be shown. Once more than limit bytes are
+// held, the output so far is written and the rest of the step's output streams through.
+type heldOutput struct {
+	mu        sync.Mutex
+	lines     []heldLine
+	limit     int
+	size      int
+	streaming bool
+}
+
+// heldLine is a line of held output; text lacks the newline while the line is incomplete
+type heldLine struct {
+	out  io.Writer
+	text string
+}
+
+// Write appends output; text without a trailing newline continues on the next write
+func (h *heldOutput) Write(out io.Writer, text string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.streaming && h.limit > 0 && h.size+len(text) > h.limit {
+		infof("      ... step output passed runner.maxOutputBytes (%d bytes), showing it as it arrives\n", h.limit)
+		h.streaming = true
+		h.writeLines(h.lines)
+		h.lines = nil
+	}
+	if h.streaming {
+		io.WriteString(out, text)
+		return
 	}
 
-	fmt.Printf("  Building container: %s\n", imageName)
+	h.size += len(text)
+	if n := len(h.lines); n > 0 && h.lines[n-1].out == out && !strings.HasSuffix(h.lines[n-1].text, "\n") {
+		h.lines[n-1].text += text
+		return
+	}
+	h.lines = append(h.lines, heldLine{out: out, text: text})
+}
 
-	// Build the image
-	dockerfilePath := filepath.Join("runners", fmt.Sprintf("Dockerfile.%s", dockerfileName))
-	buildCmd := exec.Command("docker", "build", "-f", dockerfilePath, "-t", imageName, ".")
-	buildCmd.Stdout = os.Stdout
-	buildCmd.Stderr = os.Stderr
+// Release writes the held output, only the last tail lines unless all is set
+func (h *heldOutput) Release(tail int, all bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	if err := buildCmd.Run(); err != nil {
-		return fmt.Errorf("docker build failed: %w", err)
+	lines := h.lines
+	if !all && tail >= 0 && len(lines) > tail {
+		hidden := len(lines) - tail
+		lines = lines[hidden:]
+		infof("      ... %d earlier line(s) of output hidden (--step-output-tail %d)\n", hidden, tail)
 	}
+	h.writeLines(lines)
+	h.lines = nil
+}
 
-	return nil
+// writeLines writes held lines to the writers they came from
+func (h *heldOutput) writeLines(lines []heldLine) {
+	for _, line := range lines {
+		io.WriteString(line.out, line.text)
+	}
 }
 
-func executeJobSteps(job *Job, jobDir, runnerImage string, config *Config, stepsDir string, workflowEnv map[string]string) error {
-	for i, step := range job.Steps {
-		stepNum := i + 1
-		if step.Name != "" {
-			fmt.Printf("    Step %d: %s\n", stepNum, step.Name)
-		} else {
-			fmt.Printf("    Step %d\n", stepNum)
-		}
+// maxOutputBytes is the most output of a step Vermont keeps in memory (runner.maxOutputBytes)
+func (c *JobContext) maxOutputBytes() int {
+	if c == nil || c.Run == nil || c.Run.Config == nil || c.Run.Config.Runner.MaxOutputBytes <= 0 {
+		return defaultMaxOutputBytes
+	}
+	return c.Run.Config.Runner.MaxOutputBytes
+}
 
-		if step.Run != "" {
-			// Execute shell command in container
-			if err := executeRunStep(step, jobDir, runnerImage, config, workflowEnv); err != nil {
-				return fmt.Errorf("step %d failed: %w", stepNum, err)
-			}
-		} else if step.Uses != "" {
-			// Execute GitHub Action
-			if err := executeAction(step, jobDir, runnerImage, config, stepsDir); err != nil {
-				return fmt.Errorf("step %d failed: %w", stepNum, err)
-			}
-		}
+// startHeldOutput holds the output of the next step when --step-output-tail is set
+func (c *JobContext) startHeldOutput() {
+	c.heldOutput = nil
+	if c.Run != nil && c.Run.Options != nil && c.Run.Options.StepOutputTail > 0 {
+		c.heldOutput = &heldOutput{limit: c.maxOutputBytes()}
 	}
+}
 
-	return nil
+// releaseHeldOutput shows the output of the step that just finished: all of it when the
+// step failed, else its last lines
+func (c *JobContext) releaseHeldOutput(failed bool) {
+	if c.heldOutput == nil {
+		return
+	}
+	c.heldOutput.Release(c.Run.Options.StepOutputTail, failed)
+	c.heldOutput = nil
+}
+
+// TestCase is a step as reported by --junit-out and --report-file
+type TestCase struct {
+	Number   int
+	Name     string
+	ID       string
+	Duration time.Duration
+	Result   string
+	Message  string
+	Output   string
 }
 
-func executeRunStep(step *Step, jobDir, runnerImage string, config *Config, workflowEnv map[string]string) error {
-	// Process workflow templates in the run command
-	processedRun := substituteWorkflowTemplates(step.Run, workflowEnv, config.Env)
+// TestSuite holds the test cases of a job in step order
+type TestSuite struct {
+	Name  string
+	Cases []TestCase
+}
 
-	// Prepare environment variables
-	env := make([]string, 0)
+// TestCollector gathers test cases from concurrently running jobs
+type TestCollector struct {
+	mu     sync.Mutex
+	suites map[string]*TestSuite
+}
 
-	// Add config environment variables
-	for key, value := range config.Env {
-		env = append(env, "-e", fmt.Sprintf("%s=%s", key, value))
+// Start registers the suite of a job, so jobs without steps still get one
+func (c *TestCollector) Start(job string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.suites == nil {
+		c.suites = make(map[string]*TestSuite)
+	}
+	if c.suites[job] == nil {
+		c.suites[job] = &TestSuite{Name: job}
 	}
+}
+
+// Add records a test case for a job
+func (c *TestCollector) Add(job string, testCase TestCase) {
+	c.Start(job)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suites[job].Cases = append(c.suites[job].Cases, testCase)
+}
 
-	// Add step-specific environment variables
-	for key, value := range step.Env {
-		env = append(env, "-e", fmt.Sprintf("%s=%s", key, value))
+// Suites returns a copy of the recorded suites in job name order
+func (c *TestCollector) Suites() []TestSuite {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	suites := make([]TestSuite, 0, len(c.suites))
+	for _, suite := range c.suites {
+		suites = append(suites, TestSuite{Name: suite.Name, Cases: append([]TestCase(nil), suite.Cases...)})
 	}
+	sort.Slice(suites, func(i, j int) bool { return suites[i].Name < suites[j].Name })
+	return suites
+}
 
-	// Build docker run command
-	args := []string{
-		"run", "--rm",
-		"--network", "host", // Enable network access for GitHub operations
-		"-v", fmt.Sprintf("%s:/workspace", jobDir),
-		"--workdir", "/workspace",
+// testsEnabled reports whether the run writes a JUnit report or a --report-file
+func (c *JobContext) testsEnabled() bool {
+	return c.Run != nil && c.Run.Options != nil && (c.Run.Options.JUnitOut != "" || c.Run.Options.ReportFile != "")
+}
+
+// startTestSuite registers the job's test suite when the run writes a JUnit report
+func (c *JobContext) startTestSuite() {
+	if c.testsEnabled() {
+		c.Run.Tests.Start(c.JobName)
 	}
+}
 
-	// Add environment variables
-	args = append(args, env...)
+// startStepLog starts capturing the output of the next step for the JUnit report
+func (c *JobContext) startStepLog() {
+	c.stepLog = nil
+	if c.testsEnabled() {
+		c.stepLog = newOutputTail(min(maxTestOutputBytes, c.maxOutputBytes()))
+	}
+}
 
-	// Add image
-	args = append(args, runnerImage)
+// recordTestCase adds a finished or skipped step to the JUnit report
+func (c *JobContext) recordTestCase(stepNum int, step *Step, duration time.Duration, result, message string) {
+	if !c.testsEnabled() {
+		return
+	}
+	c.Run.Tests.Add(c.JobName, TestCase{
+		Number:   stepNum,
+		Name:     step.Name,
+		ID:       step.ID,
+		Duration: duration,
+		Result:   result,
+		Message:  c.Run.Masker.Mask(message),
+		Output:   c.stepLog.String(),
+	})
+	c.stepLog = nil
+}
 
-	// Add shell command
-	args = append(args, "bash", "-c", processedRun)
+// writeReports writes the run report to the --junit-out and --report-file files that are set
+func writeReports(report *reporting.Report, opts *Options) {
+	if opts.JUnitOut != "" {
+		if err := reporting.Write(opts.JUnitOut, reporting.JUnit, report); err != nil {
+			warnf("Warning: failed to write JUnit report: %v\n", err)
+		} else {
+			infof("JUnit report written to: %s (%d test cases)\n", opts.JUnitOut, reporting.JUnitTests(report))
+		}
+	}
+	if opts.ReportFile != "" {
+		if err := reporting.WriteFile(opts.ReportFile, report); err != nil {
+			warnf("Warning: failed to write report: %v\n", err)
+		} else {
+			infof("Report written to: %s\n", opts.ReportFile)
+		}
+	}
+}
 
-	// Execute command
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// buildReport collects the results of a finished run: every job in name order with the
+// steps recorded for it, and the failures continue-on-error tolerated
+func buildReport(workflow *Workflow, run *RunContext, started time.Time, runErr error) *reporting.Report {
+	report := &reporting.Report{
+		Workflow:          workflow.Name,
+		RunID:             run.Config.Env["GITHUB_RUN_ID"],
+		RunNumber:         run.Config.Env["GITHUB_RUN_NUMBER"],
+		Event:             run.Config.Env["GITHUB_EVENT_NAME"],
+		Result:            JobResultSuccess,
+		Started:           started,
+		Duration:          time.Since(started),
+		Jobs:              []reporting.Job{},
+		ToleratedFailures: run.ToleratedFailures(),
+	}
+	switch {
+	case errors.Is(runErr, errRunCancelled):
+		report.Result = JobResultCancelled
+	case runErr != nil:
+		report.Result = JobResultFailure
+		report.Error = run.Masker.Mask(runErr.Error())
+	}
+	for i, failure := range report.ToleratedFailures {
+		report.ToleratedFailures[i] = run.Masker.Mask(failure)
+	}
 
-	return cmd.Run()
+	suites := make(map[string]TestSuite)
+	for _, suite := range run.Tests.Suites() {
+		suites[suite.Name] = suite
+	}
+	for _, result := range run.Results.All() {
+		job := reporting.Job{
+			Name:     result.JobName,
+			Result:   result.Result,
+			Duration: result.Duration,
+			Outputs:  result.Outputs,
+			Steps:    []reporting.Step{},
+		}
+		if result.Error != nil {
+			job.Error = run.Masker.Mask(result.Error.Error())
+		}
+
+		conclusions := make(map[int]string)
+		for _, step := range result.Steps {
+			conclusions[step.Number] = step.Conclusion
+		}
+		suite, ran := suites[result.JobName]
+		job.Ran = ran
+		for _, testCase := range suite.Cases {
+			conclusion, ok := conclusions[testCase.Number]
+			if !ok {
+				conclusion = testCase.Result
+			}
+			job.Steps = append(job.Steps, reporting.Step{
+				Number:     testCase.Number,
+				ID:         testCase.ID,
+				Name:       testCase.Name,
+				Outcome:    testCase.Result,
+				Conclusion: conclusion,
+				Duration:   testCase.Duration,
+				Message:    testCase.Message,
+				Output:     testCase.Output,
+			})
+		}
+		report.Jobs = append(report.Jobs, job)
+	}
+	return report
 }
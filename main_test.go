@@ -0,0 +1,1830 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"vermont/pkg/expression"
+)
+
+func TestConcurrencyLockHolder(t *testing.T) {
+	started, err := processStartTime(os.Getpid())
+	if err != nil {
+		t.Skipf("ps is not available: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		held    bool
+	}{
+		{"running holder", fmt.Sprintf("%d\n%s\ngroup\n", os.Getpid(), started), true},
+		{"reused pid", fmt.Sprintf("%d\nMon Jan  1 00:00:00 2001\ngroup\n", os.Getpid()), false},
+		{"lock without start time", fmt.Sprintf("%d\ngroup\n", os.Getpid()), false},
+		{"invalid pid", "abc\nstarted\ngroup\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "group.lock")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if held := concurrencyLockHolder(path) != nil; held != tt.held {
+				t.Errorf("concurrencyLockHolder() held = %v, want %v", held, tt.held)
+			}
+		})
+	}
+}
+
+func TestExecuteJobsWithDependenciesRejectsCycle(t *testing.T) {
+	// An independent job must not hide the cycle and leave the run waiting forever
+	jobs := map[string]*Job{
+		"a": {},
+		"b": {Needs: JobNeeds{"c"}},
+		"c": {Needs: JobNeeds{"b"}},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- executeJobsWithDependencies(jobs, &Config{}, t.TempDir(), t.TempDir(), nil, nil)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errCircularDependency) {
+			t.Fatalf("executeJobsWithDependencies() error = %v, want %v", err, errCircularDependency)
+		}
+		if code := exitCode(err); code != exitInvalidWorkflow {
+			t.Errorf("exitCode() = %d, want %d", code, exitInvalidWorkflow)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("executeJobsWithDependencies() did not return for a dependency cycle")
+	}
+}
+
+func TestPathsMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		file     string
+		want     bool
+	}{
+		{[]string{"src/**"}, "src/a/b.go", true},
+		{[]string{"src/**", "!src/**/*.md"}, "src/docs/readme.md", false},
+		{[]string{"src/**", "!src/**/*.md"}, "src/main.go", true},
+		{[]string{"!src/**/*.md", "src/**"}, "src/docs/readme.md", true},
+		{[]string{"!*.md"}, "main.go", false},
+		{nil, "main.go", false},
+	}
+	for _, tt := range tests {
+		if got := pathsMatch(tt.patterns, tt.file); got != tt.want {
+			t.Errorf("pathsMatch(%q, %q) = %v, want %v", tt.patterns, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"go.sum":            "root",
+		"pkg/a/go.sum":      "a",
+		"vendor/x/go.sum":   "vendored",
+		"docs/readme.md":    "docs",
+		"pkg/a/main.go":     "package a",
+		"pkg/b/nested/go.m": "unrelated",
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash := func(patterns ...interface{}) string {
+		t.Helper()
+		value, err := hashFiles(workspace, patterns...)
+		if err != nil {
+			t.Fatalf("hashFiles(%v) error = %v", patterns, err)
+		}
+		return value.(string)
+	}
+
+	all := hash("**/go.sum")
+	if len(all) != 64 {
+		t.Fatalf("hashFiles(**/go.sum) = %q, want a SHA-256 hex digest", all)
+	}
+	if again := hash("./**/go.sum"); again != all {
+		t.Errorf("hashFiles(./**/go.sum) = %q, want the same hash as **/go.sum %q", again, all)
+	}
+	if excluded := hash("**/go.sum", "!vendor/**"); excluded == all {
+		t.Error("hashFiles() with !vendor/** ignored the exclusion")
+	}
+	if braces := hash("{go.sum,pkg/a/go.sum}"); braces != hash("go.sum", "pkg/a/go.sum") {
+		t.Error("hashFiles() with braces differs from listing the files")
+	}
+	if empty := hash("**/*.none"); empty != "" {
+		t.Errorf("hashFiles() without a match = %q, want an empty string", empty)
+	}
+	if _, err := hashFiles(workspace, "[a-"); err == nil {
+		t.Error("hashFiles() with an invalid pattern succeeded")
+	}
+
+	// The hash follows file contents
+	if err := os.WriteFile(filepath.Join(workspace, "go.sum"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := hash("**/go.sum"); changed == all {
+		t.Error("hashFiles() didn't change with the content of a matching file")
+	}
+}
+
+func TestCloneActionCache(t *testing.T) {
+	// Each action's clone waits until the other action's clone started, which only happens
+	// when different actions are cloned in parallel
+	started := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	var mu sync.Mutex
+	clones := make(map[string]int)
+	active := make(map[string]int)
+	maxActive := make(map[string]int)
+
+	defer func(clone func(*ActionRef, string) error) { actionCloner = clone }(actionCloner)
+	actionCloner = func(actionRef *ActionRef, actionDir string) error {
+		name := actionRef.Repo
+		mu.Lock()
+		clones[name]++
+		active[name]++
+		if active[name] > maxActive[name] {
+			maxActive[name] = active[name]
+		}
+		first := clones[name] == 1
+		mu.Unlock()
+
+		if first {
+			close(started[name])
+		}
+		other := map[string]string{"a": "b", "b": "a"}[name]
+		select {
+		case <-started[other]:
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("clone of %s never ran alongside %s", name, other)
+		}
+		// Give a serialization bug time to let a second clone of the same action in
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		active[name]--
+		mu.Unlock()
+		return os.MkdirAll(actionDir, 0755)
+	}
+
+	cacheDir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 3; i++ {
+		for _, repo := range []string{"a", "b"} {
+			wg.Add(1)
+			go func(repo string) {
+				defer wg.Done()
+				ref := &ActionRef{Owner: "owner", Repo: repo, Ref: "v1"}
+				dir, err := cloneAction(ref, t.TempDir(), t.TempDir(), cacheDir, "")
+				if err == nil {
+					_, err = os.Stat(dir)
+				}
+				errs <- err
+			}(repo)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, repo := range []string{"a", "b"} {
+		if clones[repo] != 1 {
+			t.Errorf("action %s was cloned %d times, want 1", repo, clones[repo])
+		}
+		if maxActive[repo] != 1 {
+			t.Errorf("action %s had %d clones running at once, want 1", repo, maxActive[repo])
+		}
+	}
+}
+
+func TestJobEvaluatorCancelled(t *testing.T) {
+	job := &Job{MatrixGroup: "build"}
+	needs := map[string]JobResult{}
+
+	tests := []struct {
+		name      string
+		setup     func(run *RunContext, jobCtx *JobContext)
+		cancelled bool
+	}{
+		{"running", func(run *RunContext, jobCtx *JobContext) {}, false},
+		{"matrix cancelled", func(run *RunContext, jobCtx *JobContext) { run.CancelMatrix("build") }, true},
+		{"other matrix cancelled", func(run *RunContext, jobCtx *JobContext) { run.CancelMatrix("test") }, false},
+		{"run interrupted", func(run *RunContext, jobCtx *JobContext) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			run.ctx = ctx
+		}, true},
+		{"step timed out", func(run *RunContext, jobCtx *JobContext) {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			t.Cleanup(cancel)
+			jobCtx.ctx = ctx
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			run := newRunContext(&Options{}, config)
+			jobCtx := newJobContext("build-1", job, config, run, needs)
+			tt.setup(run, jobCtx)
+
+			evaluator := newJobEvaluator(job, jobCtx, config, nil)
+			for expr, want := range map[string]bool{"cancelled()": tt.cancelled, "success()": !tt.cancelled} {
+				got, err := evaluator.Evaluate(expr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s = %v, want %v", expr, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResultsStoreConcurrent(t *testing.T) {
+	store := newResultsStore()
+	run := newRunContext(&Options{}, &Config{})
+	groups := map[string][]string{"matrix": {"matrix-0", "matrix-1", "matrix-2", "matrix-3"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("matrix-%d", i)
+			outputs := map[string]string{"index": fmt.Sprint(i)}
+			store.Set(JobResult{JobName: name, Result: JobResultSuccess, Outputs: outputs})
+			// Changing the caller's map afterwards doesn't reach the store
+			outputs["index"] = "changed"
+			run.RecordToleratedFailure(name)
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				needs := store.SnapshotNeeds([]string{"matrix"}, groups)
+				if result, ok := needs["matrix"]; ok && result.Outputs["index"] == "changed" {
+					t.Error("SnapshotNeeds() returned an output changed after Set()")
+				}
+				run.ToleratedFailures()
+			}
+		}()
+	}
+	wg.Wait()
+
+	needs := store.SnapshotNeeds([]string{"matrix"}, groups)
+	if result := needs["matrix"]; result.Result != JobResultSuccess || result.Outputs["index"] != "3" {
+		t.Errorf("SnapshotNeeds()[matrix] = %+v, want success with index 3 from the last matrix job", result)
+	}
+	if failures := run.ToleratedFailures(); len(failures) != 4 {
+		t.Errorf("ToleratedFailures() = %q, want 4 failures", failures)
+	}
+	if all := store.All(); len(all) != 4 {
+		t.Errorf("All() returned %d results, want 4", len(all))
+	}
+}
+
+func TestIsTransientPullError(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		transient bool
+	}{
+		{"missing tag", "Error response from daemon: manifest for alpine:nope not found: manifest unknown: manifest unknown", false},
+		{"missing repository", "Error response from daemon: pull access denied for nope/nope, repository does not exist or may require 'docker login'", false},
+		{"case-insensitive", "MANIFEST UNKNOWN", false},
+		{"dns failure", "Error response from daemon: Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com: no such host", true},
+		{"dns not found", "dial tcp: lookup registry.example.com on 127.0.0.53:53: server misbehaving: not found", true},
+		{"timeout", "Error response from daemon: Get \"https://registry-1.docker.io/v2/\": net/http: request canceled while waiting for connection (Client.Timeout exceeded while awaiting headers)", true},
+		{"connection reset", "read tcp 10.0.0.2:41234->104.18.1.1:443: read: connection reset by peer", true},
+		{"server error", "received unexpected HTTP status: 503 Service Unavailable", true},
+		{"empty output", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientPullError(tt.output); got != tt.transient {
+				t.Errorf("isTransientPullError(%q) = %v, want %v", tt.output, got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestPullImageRefRetries(t *testing.T) {
+	const transient = "dial tcp: lookup registry.example.com: no such host"
+	const permanent = "manifest unknown"
+
+	tests := []struct {
+		name     string
+		retries  int
+		failures []string // stderr of each failing pull before one succeeds
+		wantErr  bool
+		wantRuns int
+	}{
+		{"succeeds at once", 3, nil, false, 1},
+		{"retries transient failures", 3, []string{transient, transient}, false, 3},
+		{"gives up after the retries", 2, []string{transient, transient, transient}, true, 3},
+		{"permanent failure isn't retried", 3, []string{permanent}, true, 1},
+		{"retries disabled", 0, []string{transient}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pulls int
+			var tags [][]string
+			defer func(run func([]string, io.Writer, io.Writer) error) { pullCommandRunner = run }(pullCommandRunner)
+			pullCommandRunner = func(args []string, stdout, stderr io.Writer) error {
+				if args[0] == "tag" {
+					tags = append(tags, args)
+					return nil
+				}
+				pulls++
+				if pulls <= len(tt.failures) {
+					fmt.Fprintln(stderr, tt.failures[pulls-1])
+					return errors.New("exit status 1")
+				}
+				return nil
+			}
+
+			config := &Config{}
+			config.Container.PullRetries = &tt.retries
+			err := pullImageRef("mirror.example.com/library/alpine:3", "alpine:3", config, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pullImageRef() error = %v, want error %v", err, tt.wantErr)
+			}
+			if pulls != tt.wantRuns {
+				t.Errorf("pullImageRef() pulled %d times, want %d", pulls, tt.wantRuns)
+			}
+			wantTags := 0
+			if !tt.wantErr {
+				wantTags = 1
+			}
+			if len(tags) != wantTags {
+				t.Errorf("pullImageRef() tagged %d times, want %d", len(tags), wantTags)
+			}
+		})
+	}
+}
+
+func TestDockerCommandTimeoutRemovesContainer(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("sleep is not available: %v", err)
+	}
+	var mu sync.Mutex
+	var removed [][]string
+	defer func(run func([]string) ([]byte, error)) { removeCommandRunner = run }(removeCommandRunner)
+	removeCommandRunner = func(args []string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		removed = append(removed, args)
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	jobCtx := &JobContext{ctx: ctx}
+	cmd := jobCtx.dockerCommand("run", "--rm", "alpine", "sleep", "10")
+	if len(cmd.Args) < 4 || cmd.Args[2] != "--name" || !strings.HasPrefix(cmd.Args[3], fmt.Sprintf("vermont-step-%d-", os.Getpid())) {
+		t.Fatalf("dockerCommand() args = %q, want a named step container", cmd.Args)
+	}
+	name := cmd.Args[3]
+
+	// A local sleep stands in for the docker client the step timeout kills
+	cmd.Path, cmd.Args, cmd.Err = sleep, []string{"sleep", "10"}, nil
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("the command finished although the step timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the command ran for %v after the step timed out", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := [][]string{{"rm", "--force", name}}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed containers with %q, want %q", removed, want)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("job build failed"), exitFailure},
+		{fmt.Errorf("workflow: %w", errInvalidWorkflow), exitInvalidWorkflow},
+		{fmt.Errorf("run: %w", errCircularDependency), exitInvalidWorkflow},
+		{fmt.Errorf("runner: %w", errDockerUnavailable), exitDockerUnavailable},
+		{fmt.Errorf("step 1: %w", errActionNotFound), exitActionNotFound},
+		{fmt.Errorf("step 1: %w of 1m0s: exit status 1", errStepTimeout), exitStepTimeout},
+		{fmt.Errorf("--strict-exit: 2 %w", errToleratedFailures), exitToleratedFailures},
+		{fmt.Errorf("%w: bad flag", errFlagsReported), exitFailure},
+		{errJobCancelled, exitFailure},
+		{errRunCancelled, exitFailure},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRunValidateCommandExitCode(t *testing.T) {
+	defer func(level LogLevel) { logLevel = level }(logLevel)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"valid", []string{"examples/dependency-tests.yml"}, 0},
+		{"cycle", []string{"examples/circular-dependency-test.yml"}, exitInvalidWorkflow},
+		{"duplicate step id", []string{"examples/duplicate-step-id-test.yml"}, exitInvalidWorkflow},
+		{"missing dependency", []string{"examples/missing-dependency-test.yml"}, exitFailure},
+		{"invalid and missing dependency", []string{"examples/circular-dependency-test.yml", "examples/missing-dependency-test.yml"}, exitFailure},
+		{"no workflow", nil, exitFailure},
+		{"missing file", []string{"examples/does-not-exist.yml"}, exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			if err := runValidateCommand(append([]string{"--quiet"}, tt.args...)); err != nil {
+				got = exitCode(err)
+			}
+			if got != tt.want {
+				t.Errorf("runValidateCommand(%q) exit code = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRCArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"one per line", "--no-cleanup\n--event push\n", []string{"--no-cleanup", "--event", "push"}},
+		{"several per line", "--env CI=false --env A=b", []string{"--env", "CI=false", "--env", "A=b"}},
+		{"comments and blank lines", "# shared defaults\n\n  --no-cleanup  \n\t# --confirm\n", []string{"--no-cleanup"}},
+		{"windows line endings", "--no-cleanup\r\n--json-logs\r\n", []string{"--no-cleanup", "--json-logs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadRCArgs(writeTempFile(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("loadRCArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if args, err := loadRCArgs(filepath.Join(t.TempDir(), "missing")); err != nil || args != nil {
+		t.Errorf("loadRCArgs() of a missing file = %q, %v, want no arguments", args, err)
+	}
+
+	// The arguments parse like command line flags, which come after them and win
+	rc, err := loadRCArgs(writeTempFile(t, "--no-cleanup\n--event pull_request\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseOptions(append(rc, "--event", "push", "examples/basic-tests.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.NoCleanup || opts.Event != "push" || opts.WorkflowFile != "examples/basic-tests.yml" {
+		t.Errorf("parseOptions() = no-cleanup %v, event %q, workflow %q", opts.NoCleanup, opts.Event, opts.WorkflowFile)
+	}
+}
+
+// writeTempFile writes content to a file in a temporary directory and returns its path
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestContainerRunOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		container ContainerConfig
+		want      []string
+	}{
+		{"defaults", ContainerConfig{}, []string{"--label", "vermont=true"}},
+		{"user", ContainerConfig{User: "1000:1000"}, []string{"--label", "vermont=true", "--user", "1000:1000"}},
+		{"volumes", ContainerConfig{Volumes: []string{"/cache:/cache", "/data:/data:ro"}}, []string{"--label", "vermont=true", "-v", "/cache:/cache", "-v", "/data:/data:ro"}},
+		{"hosts and dns", ContainerConfig{ExtraHosts: []string{"db.local:10.0.0.5"}, DNS: []string{"1.1.1.1", "8.8.8.8"}}, []string{"--label", "vermont=true", "--add-host", "db.local:10.0.0.5", "--dns", "1.1.1.1", "--dns", "8.8.8.8"}},
+		{"tmpfs", ContainerConfig{Tmpfs: []string{"/tmp", "/run:size=64m"}}, []string{"--label", "vermont=true", "--tmpfs", "/tmp", "--tmpfs", "/run:size=64m"}},
+		{"all in order", ContainerConfig{User: "runner", Volumes: []string{"/a:/a"}, Tmpfs: []string{"/tmp"}, ExtraHosts: []string{"h:1.2.3.4"}, DNS: []string{"9.9.9.9"}}, []string{"--label", "vermont=true", "--user", "runner", "-v", "/a:/a", "--tmpfs", "/tmp", "--add-host", "h:1.2.3.4", "--dns", "9.9.9.9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := containerRunOptions(&Config{Container: tt.container})
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("containerRunOptions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStepEntrypoint(t *testing.T) {
+	tests := []struct {
+		entrypoint string
+		want       string
+	}{
+		// An empty entrypoint clears the image's own
+		{"", "--entrypoint="},
+		{"/usr/bin/env", "--entrypoint=/usr/bin/env"},
+	}
+	for _, tt := range tests {
+		config := &Config{Container: ContainerConfig{StepEntrypoint: tt.entrypoint}}
+		if got := runStepEntrypoint(config); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("runStepEntrypoint(%q) = %q, want [%q]", tt.entrypoint, got, tt.want)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	config := &Config{Runner: RunnerConfig{BashOptions: "-eo pipefail"}}
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail", "-c", "echo hi"}},
+		{"bash", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail", "-c", "echo hi"}},
+		{" sh ", []string{"sh", "-e", "-c", "echo hi"}},
+		{"pwsh", []string{"pwsh", "-Command", "$ErrorActionPreference = 'stop'\necho hi\nif ((Test-Path -LiteralPath variable:\\LASTEXITCODE)) { exit $LASTEXITCODE }"}},
+		{"powershell", []string{"powershell", "-Command", "$ErrorActionPreference = 'stop'\necho hi\nif ((Test-Path -LiteralPath variable:\\LASTEXITCODE)) { exit $LASTEXITCODE }"}},
+		{"cmd", []string{"cmd", "/D", "/E:ON", "/V:OFF", "/S", "/C", "echo hi"}},
+		{"python", []string{"python", "-c", "echo hi"}},
+		{"zsh", []string{"zsh", "-c", "echo hi"}},
+		{"bash -x {0}", []string{"bash", "-x", "/workspace/vermont_step_script"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			jobDir := t.TempDir()
+			got, err := shellCommand(tt.shell, "echo hi", jobDir, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("shellCommand(%q) = %q, want %q", tt.shell, got, tt.want)
+			}
+		})
+	}
+
+	// A custom shell template gets the script as a file in the workspace
+	jobDir := t.TempDir()
+	if _, err := shellCommand("python {0}", "print('hi')", jobDir, config); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(jobDir, "vermont_step_script"))
+	if err != nil || string(data) != "print('hi')" {
+		t.Errorf("script file = %q, %v, want the step script", data, err)
+	}
+}
+
+func TestContainerLabelArgs(t *testing.T) {
+	tests := []struct {
+		labels []string
+		want   []string
+	}{
+		{nil, []string{"--label", "vermont=true"}},
+		{[]string{"team=ci", "run=42"}, []string{"--label", "vermont=true", "--label", "team=ci", "--label", "run=42"}},
+	}
+	for _, tt := range tests {
+		got := containerLabelArgs(&Config{Container: ContainerConfig{Labels: tt.labels}})
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("containerLabelArgs(%q) = %q, want %q", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestMirrorImageRef(t *testing.T) {
+	tests := []struct {
+		image  string
+		mirror string
+		want   string
+	}{
+		{"alpine:3.19", "", "alpine:3.19"},
+		{"alpine:3.19", "mirror.example.com", "mirror.example.com/library/alpine:3.19"},
+		{"alpine:3.19", "mirror.example.com/", "mirror.example.com/library/alpine:3.19"},
+		{"bitnami/redis:7", "mirror.example.com", "mirror.example.com/bitnami/redis:7"},
+		{"ghcr.io/owner/image:1", "mirror.example.com", "ghcr.io/owner/image:1"},
+		{"localhost:5000/image", "mirror.example.com", "localhost:5000/image"},
+		{"localhost/image", "mirror.example.com", "localhost/image"},
+	}
+	for _, tt := range tests {
+		if got := mirrorImageRef(tt.image, tt.mirror); got != tt.want {
+			t.Errorf("mirrorImageRef(%q, %q) = %q, want %q", tt.image, tt.mirror, got, tt.want)
+		}
+	}
+}
+
+func TestDockerfileBaseImages(t *testing.T) {
+	dockerfile := `# syntax=docker/dockerfile:1
+FROM --platform=linux/amd64 golang:1.21 AS build
+RUN go build ./...
+
+from Build as test
+FROM scratch
+FROM ubuntu:22.04
+COPY --from=build /app /app
+FROM
+`
+	got, err := dockerfileBaseImages(writeTempFile(t, dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"golang:1.21", "ubuntu:22.04"}; fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("dockerfileBaseImages() = %q, want %q", got, want)
+	}
+
+	if _, err := dockerfileBaseImages(filepath.Join(t.TempDir(), "Dockerfile")); err == nil {
+		t.Error("dockerfileBaseImages() of a missing file succeeded")
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	tests := map[string]string{
+		"alpine":                         "",
+		"library/alpine:3":               "",
+		"bitnami/redis":                  "",
+		"ghcr.io/owner/image:1":          "ghcr.io",
+		"registry.example.com/a/b/c":     "registry.example.com",
+		"localhost:5000/image":           "localhost:5000",
+		"localhost/image":                "localhost",
+		"myregistry:443/team/app@sha256": "myregistry:443",
+	}
+	for image, want := range tests {
+		if got := imageRegistry(image); got != want {
+			t.Errorf("imageRegistry(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestStepEnv(t *testing.T) {
+	config := &Config{Env: map[string]string{"A": "config", "B": "config", "C": "config", "D": "config"}}
+	jobCtx := &JobContext{
+		// JobEnv already holds the workflow env overlaid by the job's
+		JobEnv: map[string]string{"B": "job", "C": "job", "D": "job"},
+		Env:    map[string]string{"C": "github_env", "D": "github_env"},
+	}
+	step := &Step{Env: map[string]string{"D": "step"}}
+
+	got := jobCtx.stepEnv(config, step)
+	want := map[string]string{"A": "config", "B": "job", "C": "github_env", "D": "step"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stepEnv() = %v, want %v", got, want)
+	}
+
+	// Outside of a job only the config and the step's env apply
+	var noJob *JobContext
+	got = noJob.stepEnv(config, step)
+	want = map[string]string{"A": "config", "B": "config", "C": "config", "D": "step"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stepEnv() without a job = %v, want %v", got, want)
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []map[string]string
+		want   map[string]string
+	}{
+		{"none", nil, map[string]string{}},
+		{"nil layers", []map[string]string{nil, {"A": "1"}, nil}, map[string]string{"A": "1"}},
+		{"later wins", []map[string]string{{"A": "1", "B": "1"}, {"B": "2"}, {"B": "3", "C": "3"}}, map[string]string{"A": "1", "B": "3", "C": "3"}},
+		{"empty value still overrides", []map[string]string{{"A": "1"}, {"A": ""}}, map[string]string{"A": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveEnv(tt.layers...); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("resolveEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplicitEnvBeatsGitHubDefaults(t *testing.T) {
+	workflow := &Workflow{Name: "env-test", On: "workflow_dispatch"}
+	t.Setenv("HOME", t.TempDir()) // run numbers are kept under the home directory
+
+	// Computed identifiers are only defaults for variables the config doesn't set
+	config := &Config{Env: map[string]string{
+		"GITHUB_RUN_ID":     "12345",
+		"GITHUB_EVENT_NAME": "schedule",
+		"GITHUB_REF":        "refs/tags/v1.0.0",
+		"GITHUB_REF_NAME":   "custom",
+	}}
+	runConfig := withRunIdentifiers(config, workflow)
+	for key, want := range map[string]string{
+		"GITHUB_RUN_ID":      "12345",
+		"GITHUB_EVENT_NAME":  "schedule",
+		"GITHUB_REF":         "refs/tags/v1.0.0",
+		"GITHUB_REF_NAME":    "custom",
+		"GITHUB_REF_TYPE":    "tag",
+		"GITHUB_RUN_ATTEMPT": "1",
+	} {
+		if got := runConfig.Env[key]; got != want {
+			t.Errorf("withRunIdentifiers() %s = %q, want %q", key, got, want)
+		}
+	}
+	if config.Env["GITHUB_RUN_ATTEMPT"] != "" {
+		t.Error("withRunIdentifiers() changed the original config")
+	}
+
+	// A step's own env wins over every computed or configured GITHUB_* value
+	jobCtx := &JobContext{JobEnv: map[string]string{"GITHUB_REPOSITORY": "octo/job"}}
+	step := &Step{Env: map[string]string{"GITHUB_REPOSITORY": "octo/step", "GITHUB_RUN_ID": "1"}}
+	env := jobCtx.stepEnv(runConfig, step)
+	if env["GITHUB_REPOSITORY"] != "octo/step" || env["GITHUB_RUN_ID"] != "1" {
+		t.Errorf("stepEnv() = GITHUB_REPOSITORY %q, GITHUB_RUN_ID %q, want the step's values", env["GITHUB_REPOSITORY"], env["GITHUB_RUN_ID"])
+	}
+
+	// Action input defaults such as ${GITHUB_TOKEN} read the step's environment first
+	t.Setenv("GITHUB_TOKEN", "from-process")
+	tests := []struct {
+		value   string
+		stepEnv map[string]string
+		want    string
+	}{
+		{"${GITHUB_TOKEN}", map[string]string{"GITHUB_TOKEN": "from-step"}, "from-step"},
+		{"${GITHUB_TOKEN}", map[string]string{"GITHUB_TOKEN": ""}, "from-process"},
+		{"${GITHUB_TOKEN}", nil, "from-process"},
+		{"literal", map[string]string{"literal": "x"}, "literal"},
+	}
+	for _, tt := range tests {
+		if got := expandStepEnvValue(tt.value, tt.stepEnv); got != tt.want {
+			t.Errorf("expandStepEnvValue(%q, %v) = %q, want %q", tt.value, tt.stepEnv, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateMatrixCombinations(t *testing.T) {
+	tests := []struct {
+		name   string
+		matrix string
+		want   []map[string]interface{}
+	}{
+		{
+			name:   "declaration order",
+			matrix: "os: [linux, windows]\nnode: ['18', '20']",
+			want: []map[string]interface{}{
+				{"os": "linux", "node": "18"},
+				{"os": "linux", "node": "20"},
+				{"os": "windows", "node": "18"},
+				{"os": "windows", "node": "20"},
+			},
+		},
+		{
+			name:   "keys declared out of alphabetical order",
+			matrix: "zone: [b, a]\narch: [x64]",
+			want: []map[string]interface{}{
+				{"zone": "b", "arch": "x64"},
+				{"zone": "a", "arch": "x64"},
+			},
+		},
+		{
+			name:   "exclude",
+			matrix: "os: [linux, windows]\nnode: ['18', '20']\nexclude:\n  - os: windows\n    node: '18'",
+			want: []map[string]interface{}{
+				{"os": "linux", "node": "18"},
+				{"os": "linux", "node": "20"},
+				{"os": "windows", "node": "20"},
+			},
+		},
+		{
+			name:   "include extends matching combinations",
+			matrix: "os: [linux, windows]\ninclude:\n  - os: linux\n    experimental: 'true'",
+			want: []map[string]interface{}{
+				{"os": "linux", "experimental": "true"},
+				{"os": "windows"},
+			},
+		},
+		{
+			name:   "include that fits no combination is added",
+			matrix: "os: [linux]\ninclude:\n  - os: macos\n    xcode: '15'",
+			want: []map[string]interface{}{
+				{"os": "linux"},
+				{"os": "macos", "xcode": "15"},
+			},
+		},
+		{
+			name:   "include after exclude",
+			matrix: "os: [linux, windows]\nexclude:\n  - os: windows\ninclude:\n  - os: windows\n    shell: pwsh",
+			want: []map[string]interface{}{
+				{"os": "linux"},
+				{"os": "windows", "shell": "pwsh"},
+			},
+		},
+		{
+			name:   "only include",
+			matrix: "include:\n  - site: a\n  - site: b",
+			want: []map[string]interface{}{
+				{"site": "a"},
+				{"site": "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var strategy Strategy
+			if err := yaml.Unmarshal([]byte("matrix:\n"+indent(tt.matrix)), &strategy); err != nil {
+				t.Fatalf("failed to decode matrix: %v", err)
+			}
+			// Map iteration is random, so repeat to catch order that depends on it
+			for i := 0; i < 20; i++ {
+				got := generateMatrixCombinations(strategy.Matrix, strategy.MatrixKeys)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("generateMatrixCombinations() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func indent(text string) string {
+	return "  " + strings.ReplaceAll(text, "\n", "\n  ")
+}
+
+func TestResolveEnvScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "references resolve in dependency order",
+			env:  map[string]string{"A": "${{ env.B }}/a", "B": "${{ env.C }}/b", "C": "base"},
+			want: map[string]string{"A": "base/b/a", "B": "base/b", "C": "base"},
+		},
+		{
+			name: "references ignore case",
+			env:  map[string]string{"BAR": "${{ env.foo }}/sub", "FOO": "base"},
+			want: map[string]string{"BAR": "base/sub", "FOO": "base"},
+		},
+		{
+			name: "outer scope values",
+			env:  map[string]string{"URL": "${{ env.HOST }}:${{ env.PORT }}", "PORT": "8080"},
+			want: map[string]string{"URL": "outer-host:8080", "PORT": "8080"},
+		},
+		{
+			name: "self reference reads the outer value",
+			env:  map[string]string{"PATH_LIST": "${{ env.PATH_LIST }}:/opt/bin"},
+			want: map[string]string{"PATH_LIST": "/usr/bin:/opt/bin"},
+		},
+		{
+			name:    "two variable cycle",
+			env:     map[string]string{"A": "${{ env.B }}", "B": "${{ env.A }}"},
+			wantErr: "cycle: A -> B -> A",
+		},
+		{
+			name:    "cycle reached through another variable",
+			env:     map[string]string{"A": "${{ env.B }}", "B": "${{ env.C }}", "C": "${{ env.D }}", "D": "${{ env.B }}"},
+			wantErr: "cycle: B -> C -> D -> B",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator := &expression.Evaluator{Contexts: map[string]interface{}{
+				"env": map[string]interface{}{"HOST": "outer-host", "PATH_LIST": "/usr/bin"},
+			}}
+			got, err := resolveEnvScope(tt.env, evaluator)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveEnvScope() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveEnvScope() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveEnvScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionInputCoerce(t *testing.T) {
+	tests := []struct {
+		input   ActionInput
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{ActionInput{Type: "boolean"}, "yes", "true", false},
+		{ActionInput{Type: "boolean"}, "Off", "false", false},
+		{ActionInput{Type: "boolean"}, " TRUE ", "true", false},
+		{ActionInput{Type: "boolean"}, "1", "true", false},
+		{ActionInput{Type: "boolean"}, "0", "false", false},
+		{ActionInput{Type: "boolean"}, "maybe", "", true},
+		{ActionInput{Type: "number"}, "42", "42", false},
+		{ActionInput{Type: "number"}, "1.5", "1.5", false},
+		{ActionInput{Type: "number"}, "many", "", true},
+		{ActionInput{Type: "choice", Options: []string{"debug", "info"}}, "info", "info", false},
+		{ActionInput{Type: "choice", Options: []string{"debug", "info"}}, "Info", "", true},
+		{ActionInput{Type: "choice"}, "anything", "anything", false},
+		{ActionInput{Type: "string"}, "yes", "yes", false},
+		{ActionInput{}, "on", "on", false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.input.Coerce(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s input Coerce(%q) error = %v, wantErr %v", tt.input.Type, tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s input Coerce(%q) = %q, want %q", tt.input.Type, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWorkflowCallInputCoerce(t *testing.T) {
+	tests := []struct {
+		input   WorkflowCallInput
+		value   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{WorkflowCallInput{Type: "boolean"}, "true", true, false},
+		{WorkflowCallInput{Type: "boolean"}, false, false, false},
+		{WorkflowCallInput{Type: "boolean"}, "sure", nil, true},
+		{WorkflowCallInput{Type: "number"}, 3, float64(3), false},
+		{WorkflowCallInput{Type: "number"}, " 2.5 ", 2.5, false},
+		{WorkflowCallInput{Type: "number"}, "two", nil, true},
+		{WorkflowCallInput{Type: "choice", Options: []string{"staging", "production"}}, "staging", "staging", false},
+		{WorkflowCallInput{Type: "choice", Options: []string{"staging", "production"}}, "qa", nil, true},
+		{WorkflowCallInput{Type: "string"}, 7, "7", false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.input.Coerce(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s input Coerce(%v) error = %v, wantErr %v", tt.input.Type, tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s input Coerce(%v) = %v, want %v", tt.input.Type, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDispatchInputsRejectsChoiceWithoutOptions(t *testing.T) {
+	var on interface{}
+	if err := yaml.Unmarshal([]byte("workflow_dispatch:\n  inputs:\n    level:\n      type: choice\n"), &on); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseDispatchInputs(on); err == nil || !strings.Contains(err.Error(), "no options") {
+		t.Errorf("parseDispatchInputs() error = %v, want one about missing options", err)
+	}
+}
+
+func TestCheckActionInputs(t *testing.T) {
+	meta := &ActionMetadata{Inputs: map[string]ActionInput{
+		"verbose": {Type: "boolean"},
+		"level":   {Type: "choice", Options: []string{"debug", "info"}},
+		"name":    {},
+	}}
+
+	step := &Step{Uses: "./my-action", With: map[string]interface{}{
+		"verbose": "on",
+		"level":   "${{ inputs.level }}",
+		"name":    "yes",
+		"extra":   "off",
+	}}
+	checked, err := checkActionInputs(meta, step)
+	if err != nil {
+		t.Fatalf("checkActionInputs() error = %v", err)
+	}
+	want := StepWith{
+		"verbose": "true",
+		"level":   "${{ inputs.level }}",
+		"name":    "yes",
+		"extra":   "off",
+	}
+	if !reflect.DeepEqual(checked.With, want) {
+		t.Errorf("checkActionInputs() with = %v, want %v", checked.With, want)
+	}
+	if step.With["verbose"] != "on" {
+		t.Error("checkActionInputs() changed the original step")
+	}
+
+	step = &Step{Uses: "./my-action", With: map[string]interface{}{"level": "trace"}}
+	if _, err := checkActionInputs(meta, step); err == nil || !strings.Contains(err.Error(), "input level of ./my-action") {
+		t.Errorf("checkActionInputs() error = %v, want one naming the input and action", err)
+	}
+}
+
+func TestStepWithInputValues(t *testing.T) {
+	var step Step
+	data := `
+uses: ./my-action
+with:
+  yes-word: yes
+  bool: true
+  capital-bool: False
+  int: 1
+  quoted: "1"
+  version: 3.10
+  hex: 0x1F
+  empty:
+  list: [a, 2]
+  text: |
+    line one
+    line two
+`
+	if err := yaml.Unmarshal([]byte(data), &step); err != nil {
+		t.Fatalf("failed to decode step: %v", err)
+	}
+
+	want := map[string]string{
+		"yes-word":     "yes",
+		"bool":         "true",
+		"capital-bool": "false",
+		"int":          "1",
+		"quoted":       "1",
+		"version":      "3.10",
+		"hex":          "0x1F",
+		"empty":        "",
+		"list":         `["a",2]`,
+		"text":         "line one\nline two\n",
+	}
+	for name, expected := range want {
+		if got := inputValueString(step.With[name]); got != expected {
+			t.Errorf("with.%s = %q, want %q", name, got, expected)
+		}
+	}
+	if len(step.With) != len(want) {
+		t.Errorf("decoded %d with values, want %d", len(step.With), len(want))
+	}
+
+	if err := yaml.Unmarshal([]byte("with: [a, b]"), &step); err == nil {
+		t.Error("decoding a with list succeeded, want an error")
+	}
+}
+
+func TestMasker(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		text   string
+		want   string
+	}{
+		{"single value", []string{"hunter2"}, "password is hunter2", "password is ***"},
+		{"every occurrence", []string{"abc"}, "abc-abc", "***-***"},
+		{"value containing another", []string{"tok", "tok-123456"}, "token tok-123456 and tok", "***en *** and ***"},
+		{"longer value added first", []string{"tok-123456", "tok"}, "tok-123456", "***"},
+		{"overlapping values", []string{"abcd", "cdef"}, "abcdef!", "***!"},
+		{"overlapping occurrences", []string{"aba"}, "ababa", "***"},
+		{"adjacent values", []string{"ab", "cd"}, "abcd ab", "*** ***"},
+		{"multiline value", []string{"line one\r\n  line two  \n\n"}, "line one / line two", "*** / ***"},
+		{"blank value", []string{"  ", ""}, "a  b", "a  b"},
+		{"duplicates", []string{"dup", "dup"}, "dup", "***"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Masker{}
+			for _, value := range tt.values {
+				m.Add(value)
+			}
+			if got := m.Mask(tt.text); got != tt.want {
+				t.Errorf("Mask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	var nilMasker *Masker
+	if got := nilMasker.Mask("text"); got != "text" {
+		t.Errorf("nil Mask() = %q, want the text unchanged", got)
+	}
+}
+
+func TestMaskerMaskChunk(t *testing.T) {
+	m := &Masker{}
+	m.Add("supersecret")
+
+	// Feed the text in pieces of every size; no split may let part of the value through
+	maskInPieces := func(text string, size int) string {
+		var out, pending string
+		covered := 0
+		for start := 0; start < len(text); start += size {
+			end := min(start+size, len(text))
+			var masked string
+			masked, pending, covered = m.MaskChunk(pending+text[start:end], covered, end == len(text))
+			out += masked
+		}
+		return out
+	}
+
+	text := "token=supersecret; again supersecret, supersecret end"
+	for size := 1; size <= len(text); size++ {
+		if got, want := maskInPieces(text, size), "token=***; again ***, *** end"; got != want {
+			t.Fatalf("pieces of %d bytes: masked = %q, want %q", size, got, want)
+		}
+	}
+
+	// Adjacent values may come out as more than one ***, but none of them shows
+	text = "xsupersecretsupersecretsupersecretx"
+	for size := 1; size <= len(text); size++ {
+		got := maskInPieces(text, size)
+		middle, found := strings.CutPrefix(got, "x")
+		middle, foundEnd := strings.CutSuffix(middle, "x")
+		if !found || !foundEnd || middle == "" || strings.Trim(middle, "*") != "" {
+			t.Fatalf("pieces of %d bytes: masked = %q, want only *** between the x", size, got)
+		}
+	}
+
+	// Only the end that may start a value is held back
+	masked, rest, _ := m.MaskChunk("plain text super", 0, false)
+	if masked != "plain " || rest != "text super" {
+		t.Errorf("MaskChunk() = %q, %q, want %q, %q", masked, rest, "plain ", "text super")
+	}
+
+	var nilMasker *Masker
+	if masked, rest, _ := nilMasker.MaskChunk("text", 0, false); masked != "text" || rest != "" {
+		t.Errorf("nil MaskChunk() = %q, %q, want the text unchanged", masked, rest)
+	}
+}
+
+func TestStepOutputWriterOversizedLine(t *testing.T) {
+	jobCtx := &JobContext{Run: &RunContext{
+		Masker: &Masker{},
+		Config: &Config{Runner: RunnerConfig{MaxOutputBytes: 16}},
+	}}
+	jobCtx.Run.Masker.Add("supersecret")
+
+	var out strings.Builder
+	w := newStepOutputWriter(&out, jobCtx, "build")
+	line := strings.Repeat("x", 20) + "supersecret" + strings.Repeat("y", 20)
+	// Split the value across two writes after the line has passed the limit
+	for _, part := range []string{line[:25], line[25:], "\n", "short ::notice::line\n"} {
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	w.Flush()
+
+	want := strings.Repeat("x", 20) + "***" + strings.Repeat("y", 20) + "\nshort ::notice::line\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestOutputTail(t *testing.T) {
+	tail := newOutputTail(10)
+	tail.WriteString("12345")
+	if got := tail.String(); got != "12345" {
+		t.Errorf("String() = %q, want the output unchanged", got)
+	}
+
+	tail.WriteString("6789abcdef")
+	if got, want := tail.String(), outputTruncated+"6789abcdef"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	var nilTail *outputTail
+	nilTail.WriteString("discarded")
+	if got := nilTail.String(); got != "" {
+		t.Errorf("nil String() = %q, want empty", got)
+	}
+}
+
+func TestHeldOutputLimit(t *testing.T) {
+	var out strings.Builder
+	held := &heldOutput{limit: 10}
+	held.Write(&out, "one\n")
+	held.Write(&out, "two\n")
+	if out.Len() != 0 {
+		t.Fatalf("output below the limit was written: %q", out.String())
+	}
+
+	// Passing the limit writes what is held and streams the rest
+	held.Write(&out, "three\n")
+	held.Write(&out, "four\n")
+	if got, want := out.String(), "one\ntwo\nthree\nfour\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	held.Release(1, false)
+	if got, want := out.String(), "one\ntwo\nthree\nfour\n"; got != want {
+		t.Errorf("output after Release() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildReportMasksErrors(t *testing.T) {
+	run := newRunContext(&Options{}, &Config{})
+	run.Masker.Add("hunter2")
+	jobErr := fmt.Errorf("step 1: login with hunter2 failed")
+	run.Results.Set(JobResult{JobName: "deploy", Result: JobResultFailure, Error: jobErr})
+	run.RecordToleratedFailure("job lint: token hunter2 rejected")
+
+	report := buildReport(&Workflow{Name: "ci"}, run, time.Now(), fmt.Errorf("job deploy: %w", jobErr))
+	if report.Result != JobResultFailure {
+		t.Errorf("Result = %q, want %q", report.Result, JobResultFailure)
+	}
+	for _, text := range append([]string{report.Error, report.Jobs[0].Error}, report.ToleratedFailures...) {
+		if strings.Contains(text, "hunter2") || !strings.Contains(text, "***") {
+			t.Errorf("report text %q isn't masked", text)
+		}
+	}
+}
+
+// chdir changes the working directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestLocalActionDirInComposite(t *testing.T) {
+	root := t.TempDir()
+	composite := "runs:\n  using: composite\n  steps:\n    - uses: ./greet\n"
+	files := map[string]string{
+		"actions/with-sibling/action.yml":       composite,
+		"actions/with-sibling/greet/action.yml": "runs:\n  using: node20\n  main: sibling.js\n",
+		"actions/without-sibling/action.yml":    composite,
+		"greet/action.yml":                      "runs:\n  using: node20\n  main: root.js\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chdir(t, root)
+
+	// The uses of the composite's step resolves against the composite's directory first
+	tests := []struct {
+		composite string
+		wantMain  string
+	}{
+		{"actions/with-sibling", "sibling.js"},
+		{"actions/without-sibling", "root.js"},
+	}
+	for _, tt := range tests {
+		parentDir := filepath.Join(root, tt.composite)
+		meta, err := loadActionMetadata(parentDir)
+		if err != nil {
+			t.Fatalf("loadActionMetadata(%s) error = %v", tt.composite, err)
+		}
+		actionDir, err := localActionDir(meta.Runs.Steps[0].Uses, parentDir)
+		if err != nil {
+			t.Fatalf("localActionDir() in %s error = %v", tt.composite, err)
+		}
+		nested, err := loadActionMetadata(actionDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nested.Runs.Main != tt.wantMain {
+			t.Errorf("./greet in %s resolved to %s (%s), want the action running %s", tt.composite, actionDir, nested.Runs.Main, tt.wantMain)
+		}
+	}
+
+	// Outside a composite the path is relative to the repository root
+	if actionDir, err := localActionDir("./greet", ""); err != nil || actionDir != filepath.Join(root, "greet") {
+		t.Errorf("localActionDir(./greet) = %s, %v, want the root action", actionDir, err)
+	}
+
+	_, err := localActionDir("./missing", filepath.Join(root, "actions/with-sibling"))
+	if !errors.Is(err, errActionNotFound) || !strings.Contains(err.Error(), filepath.Join(root, "actions/with-sibling/missing")) {
+		t.Errorf("localActionDir(./missing) error = %v, want errActionNotFound naming both paths", err)
+	}
+}
+
+func TestCompositeActionTooDeep(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"loop/action.yml": "runs:\n  using: composite\n  steps:\n    - uses: ./loop\n",
+		"ping/action.yml": "runs:\n  using: composite\n  steps:\n    - uses: ./pong\n",
+		"pong/action.yml": "runs:\n  using: composite\n  steps:\n    - uses: ./ping\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chdir(t, root)
+
+	tests := []struct {
+		uses     string
+		maxDepth int
+		wantErr  string
+	}{
+		{"./loop", 3, "more than 3 levels (runner.maxActionDepth): ./loop -> ./loop"},
+		{"./ping", 4, "more than 4 levels (runner.maxActionDepth): ./ping -> ./pong -> ./ping"},
+		{"./loop", 0, fmt.Sprintf("more than %d levels", defaultMaxActionDepth)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s depth %d", tt.uses, tt.maxDepth), func(t *testing.T) {
+			config := &Config{}
+			config.Runner.MaxActionDepth = tt.maxDepth
+			jobCtx := &JobContext{}
+			_, err := executeAction(&Step{Uses: tt.uses}, t.TempDir(), "", config, t.TempDir(), jobCtx)
+			if !errors.Is(err, errActionTooDeep) {
+				t.Fatalf("executeAction(%s) error = %v, want errActionTooDeep", tt.uses, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("executeAction(%s) error = %q, want it to contain %q", tt.uses, err, tt.wantErr)
+			}
+			if len(jobCtx.actionStack) != 0 || len(jobCtx.actionDirs) != 0 {
+				t.Errorf("action stack = %v after the step, want it empty", jobCtx.actionStack)
+			}
+		})
+	}
+}
+
+func TestLoadConfigExpandsVariables(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("VERMONT_TEST_DIR", dir)
+	t.Setenv("VERMONT_TEST_TOKEN", "t0ken")
+	t.Setenv("VERMONT_TEST_EMPTY", "")
+	t.Setenv("VERMONT_TEST_UNSET", "") // restored after the test
+	os.Unsetenv("VERMONT_TEST_UNSET")
+
+	path := filepath.Join(dir, "config.json")
+	err := os.WriteFile(path, []byte(`{
+  "env": {"TOKEN": "${VERMONT_TEST_TOKEN}", "URL": "https://${VERMONT_TEST_TOKEN}@host", "UNSET": "${VERMONT_TEST_UNSET}", "EMPTY": "${VERMONT_TEST_EMPTY}", "PRICE": "$5"},
+  "secrets": {"PASSWORD": "pa$$word", "KEY": "${VERMONT_TEST_TOKEN}"},
+  "environments": {"prod": {"vars": {"ROOT": "${VERMONT_TEST_DIR}/prod"}}},
+  "container": {"runnersDir": "${VERMONT_TEST_DIR}/runners", "volumes": ["${VERMONT_TEST_DIR}/npm:/root/.npm:ro"]},
+  "storage": {"actionsCacheDir": "${VERMONT_TEST_DIR}/cache/${VERMONT_TEST_TOKEN}"},
+  "secretsCommand": ["sh", "-c", "echo ${1}"]
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	for _, tt := range []struct{ field, got, want string }{
+		{"env.TOKEN", config.Env["TOKEN"], "t0ken"},
+		{"env.URL", config.Env["URL"], "https://t0ken@host"},
+		{"env.UNSET", config.Env["UNSET"], ""},
+		{"env.EMPTY", config.Env["EMPTY"], ""},
+		{"env.PRICE", config.Env["PRICE"], "$5"},
+		{"secrets.PASSWORD", config.Secrets["PASSWORD"], "pa$$word"},
+		{"secrets.KEY", config.Secrets["KEY"], "t0ken"},
+		{"environments.prod.vars.ROOT", config.Environments["prod"].Vars["ROOT"], dir + "/prod"},
+		{"container.runnersDir", config.Container.RunnersDir, dir + "/runners"},
+		{"container.volumes", config.Container.Volumes[0], dir + "/npm:/root/.npm:ro"},
+		{"storage.actionsCacheDir", config.Storage.ActionsCacheDir, dir + "/cache/t0ken"},
+		{"secretsCommand", config.SecretsCommand[2], "echo ${1}"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestValidateJob(t *testing.T) {
+	steps := func(ids ...string) []*Step {
+		var steps []*Step
+		for _, id := range ids {
+			steps = append(steps, &Step{ID: id, Run: "true"})
+		}
+		return steps
+	}
+
+	tests := []struct {
+		name    string
+		steps   []*Step
+		wantErr string
+	}{
+		{"unique ids", steps("build", "test", "deploy"), ""},
+		{"steps without ids", steps("", "", ""), ""},
+		{"some ids empty", steps("", "build", "", "test"), ""},
+		{"no steps", nil, ""},
+		{"duplicate ids", steps("build", "test", "build"), `job ci: steps 1 and 3 have the same id "build"`},
+		{"duplicate after empty ids", steps("", "lint", "", "lint"), `job ci: steps 2 and 4 have the same id "lint"`},
+		{"first duplicate is reported", steps("a", "b", "b", "a"), `job ci: steps 2 and 3 have the same id "b"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJob("ci", &Job{Steps: tt.steps})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateJob() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateJob() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateJobOutputs(t *testing.T) {
+	// A registered handler stands in for an action that sets its value input as an output
+	actionHandlersMu.Lock()
+	saved := actionHandlers
+	actionHandlers = append(append([]actionHandler(nil), saved...), actionHandler{
+		prefix: "vermont-test/emit",
+		handler: func(actionRef *ActionRef, inputs map[string]interface{}, jobDir string, config *Config) (*ActionExecutionResult, error) {
+			return &ActionExecutionResult{Outputs: map[string]string{"value": fmt.Sprint(inputs["value"])}}, nil
+		},
+	})
+	actionHandlersMu.Unlock()
+	t.Cleanup(func() {
+		actionHandlersMu.Lock()
+		actionHandlers = saved
+		actionHandlersMu.Unlock()
+	})
+
+	var workflow Workflow
+	err := yaml.Unmarshal([]byte(`
+jobs:
+  build:
+    outputs:
+      version: ${{ steps.version.outputs.value }}
+      tag: ${{ steps.tag.outputs.value }}
+      unset: ${{ steps.version.outputs.missing }}
+      skipped: ${{ steps.skipped.outputs.value }}
+      unknown: ${{ steps.nowhere.outputs.value }}
+      mixed: ${{ steps.tag.outputs.value }}-${{ steps.skipped.outputs.value }}
+    steps:
+      - id: version
+        uses: vermont-test/emit@v1
+        with:
+          value: 1.2.3
+      - id: skipped
+        if: false
+        uses: vermont-test/emit@v1
+        with:
+          value: never
+      - id: tag
+        uses: vermont-test/emit@v1
+        with:
+          value: v${{ steps.version.outputs.value }}
+`), &workflow)
+	if err != nil {
+		t.Fatalf("failed to decode workflow: %v", err)
+	}
+	job := workflow.Jobs["build"]
+
+	config := &Config{}
+	jobCtx := newJobContext("build", job, config, newRunContext(&Options{}, config), nil)
+	if err := executeJobSteps(job, t.TempDir(), "", config, t.TempDir(), nil, jobCtx, context.Background()); err != nil {
+		t.Fatalf("executeJobSteps() error = %v", err)
+	}
+
+	// Outputs of steps that didn't set them, didn't run or don't exist resolve to ""
+	got := evaluateJobOutputs(job, jobCtx, config, nil)
+	want := map[string]string{
+		"version": "1.2.3",
+		"tag":     "v1.2.3",
+		"unset":   "",
+		"skipped": "",
+		"unknown": "",
+		"mixed":   "v1.2.3-",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("evaluateJobOutputs() = %v, want %v", got, want)
+	}
+
+	// The resolved outputs are what dependent jobs see as needs.<job>.outputs
+	deploy := &Job{Needs: JobNeeds{"build"}}
+	needs := map[string]JobResult{"build": {JobName: "build", Result: JobResultSuccess, Outputs: got}}
+	deployCtx := newJobContext("deploy", deploy, config, jobCtx.Run, needs)
+	resolved, err := newJobEvaluator(deploy, deployCtx, config, nil).Interpolate("${{ needs.build.outputs.tag }}")
+	if err != nil || resolved != "v1.2.3" {
+		t.Errorf("needs.build.outputs.tag = %q, %v, want v1.2.3", resolved, err)
+	}
+
+	if outputs := evaluateJobOutputs(&Job{}, jobCtx, config, nil); outputs != nil {
+		t.Errorf("evaluateJobOutputs() without declared outputs = %v, want nil", outputs)
+	}
+}
+
+func TestResolveStepShell(t *testing.T) {
+	var workflow Workflow
+	err := yaml.Unmarshal([]byte(`
+defaults:
+  run:
+    shell: sh
+jobs:
+  workflow-default:
+    steps:
+      - run: "true"
+      - run: "true"
+        shell: python
+  job-default:
+    defaults:
+      run:
+        shell: pwsh
+    steps:
+      - run: "true"
+      - run: "true"
+        shell: bash {0}
+`), &workflow)
+	if err != nil {
+		t.Fatalf("failed to decode workflow: %v", err)
+	}
+	applyWorkflowDefaults(&workflow)
+
+	tests := []struct {
+		name  string
+		job   *Job
+		step  *Step
+		image string
+		want  string
+	}{
+		{"step shell", workflow.Jobs["workflow-default"], workflow.Jobs["workflow-default"].Steps[1], "alpine:3.19", "python"},
+		{"workflow default", workflow.Jobs["workflow-default"], workflow.Jobs["workflow-default"].Steps[0], "ubuntu:22.04", "sh"},
+		{"job default beats workflow default", workflow.Jobs["job-default"], workflow.Jobs["job-default"].Steps[0], "alpine:3.19", "pwsh"},
+		{"step beats job default", workflow.Jobs["job-default"], workflow.Jobs["job-default"].Steps[1], "ubuntu:22.04", "bash {0}"},
+		{"image guess without defaults", &Job{}, &Step{Run: "true"}, "alpine:3.19", "sh"},
+		{"step shell without defaults", &Job{}, &Step{Run: "true", Shell: "bash"}, "busybox", "bash"},
+	}
+	for _, tt := range tests {
+		if got := resolveStepShell(tt.step, tt.job, tt.image); got != tt.want {
+			t.Errorf("%s: resolveStepShell() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultShellForImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"ubuntu:22.04", "bash"},
+		{"node:20", "bash"},
+		{"alpine:3.19", "sh"},
+		{"node:20-alpine", "sh"},
+		{"ghcr.io/acme/tools:Alpine-latest", "sh"},
+		{"busybox:1.36", "sh"},
+		{"mcr.microsoft.com/windows/servercore:ltsc2022", "pwsh"},
+		{"mcr.microsoft.com/windows/nanoserver:ltsc2022", "pwsh"},
+		// Runner images all have bash, whatever their name suggests
+		{"vermont-runner:alpine-latest", "bash"},
+		{"vermont-runner:windows-latest", "bash"},
+	}
+	for _, tt := range tests {
+		if got := defaultShellForImage(tt.image); got != tt.want {
+			t.Errorf("defaultShellForImage(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestJobNeedsUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    JobNeeds
+		wantErr bool
+	}{
+		{"single string", "needs: build", JobNeeds{"build"}, false},
+		{"array", "needs: [build, test]", JobNeeds{"build", "test"}, false},
+		{"block array", "needs:\n  - lint\n  - build", JobNeeds{"lint", "build"}, false},
+		{"omitted", "runs-on: ubuntu-latest", nil, false},
+		{"null", "needs:", nil, false},
+		{"empty string", `needs: ""`, nil, false},
+		{"empty array", "needs: []", nil, false},
+		{"duplicates dropped", "needs: [build, test, build]", JobNeeds{"build", "test"}, false},
+		{"names trimmed", `needs: [" build ", "build"]`, JobNeeds{"build"}, false},
+		{"empty name in array", `needs: [""]`, nil, true},
+		{"blank name in array", `needs: [build, "  "]`, nil, true},
+		{"blank string", `needs: "  "`, nil, true},
+		{"mapping", "needs: {build: true}", nil, true},
+		{"nested array", "needs: [[build]]", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var job Job
+			err := yaml.Unmarshal([]byte(tt.yaml), &job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(job.Needs, tt.want) {
+				t.Errorf("needs = %#v, want %#v", job.Needs, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{"  build  --verbose\t-o out ", []string{"build", "--verbose", "-o", "out"}, ""},
+		{`echo 'hello world' '$HOME' 'it''s'`, []string{"echo", "hello world", "$HOME", "its"}, ""},
+		{`'a\b' '"quoted"'`, []string{`a\b`, `"quoted"`}, ""},
+		{`-c "say \"hi\" to \\them"`, []string{"-c", `say "hi" to \them`}, ""},
+		{`"keep \n and \$"`, []string{`keep \n and \$`}, ""},
+		{`"" ''`, []string{"", ""}, ""},
+		{`pre"fix "'suffix'`, []string{"prefix suffix"}, ""},
+		{`one\ arg two\"three \\`, []string{"one arg", `two"three`, `\`}, ""},
+		{"multi\nline\r\nargs", []string{"multi", "line", "args"}, ""},
+		{`echo 'unterminated`, nil, "unterminated ' quote"},
+		{`echo "unterminated \"`, nil, `unterminated " quote`},
+		{`echo trailing\`, nil, "trailing backslash"},
+	}
+
+	for _, tt := range tests {
+		got, err := splitArgs(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("splitArgs(%q) error = %v, want one containing %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitArgs(%q) error = %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestDockerStepAction(t *testing.T) {
+	step := &Step{Uses: "docker://alpine:3.19", With: StepWith{
+		"entrypoint": "/bin/sh",
+		"args":       `-c "echo \"$INPUT_GREETING\""`,
+		"greeting":   "hello",
+		"log-level":  "debug",
+	}}
+
+	meta, dockerStep, err := dockerStepAction(step)
+	if err != nil {
+		t.Fatalf("dockerStepAction() error = %v", err)
+	}
+	if meta.Runs.Using != "docker" || meta.Runs.Image != "docker://alpine:3.19" || meta.Runs.Entrypoint != "/bin/sh" {
+		t.Errorf("action runs = %+v", meta.Runs)
+	}
+	if want := []string{"-c", `echo "$INPUT_GREETING"`}; !reflect.DeepEqual(meta.Runs.Args, want) {
+		t.Errorf("args = %q, want %q", meta.Runs.Args, want)
+	}
+
+	// entrypoint and args configure the container and don't become INPUT_ variables
+	inputs := actionInputs(meta, dockerStep, &Config{})
+	if want := map[string]interface{}{"greeting": "hello", "log-level": "debug"}; !reflect.DeepEqual(inputs, want) {
+		t.Errorf("inputs = %v, want %v", inputs, want)
+	}
+	if len(step.With) != 4 {
+		t.Error("dockerStepAction() changed the original step")
+	}
+
+	step = &Step{Uses: "docker://alpine", With: StepWith{"args": `echo "oops`}}
+	if _, _, err := dockerStepAction(step); err == nil || !strings.Contains(err.Error(), "invalid with.args") {
+		t.Errorf("dockerStepAction() error = %v, want an invalid with.args error", err)
+	}
+}
+
+func TestMatrixIncludeExcludeDependencies(t *testing.T) {
+	var workflow Workflow
+	err := yaml.Unmarshal([]byte(`
+jobs:
+  build:
+    strategy:
+      matrix:
+        os: [linux, windows]
+        arch: [x64, arm64]
+        exclude:
+          - os: windows
+            arch: arm64
+        include:
+          - os: linux
+            arch: x64
+            coverage: true
+          - os: macos
+            arch: arm64
+    steps:
+      - run: echo ${{ matrix.os }}
+  deploy:
+    needs: build
+    steps:
+      - run: echo deploy
+`), &workflow)
+	if err != nil {
+		t.Fatalf("failed to decode workflow: %v", err)
+	}
+
+	jobs := expandMatrixJobs(workflow.Jobs)
+	groups := matrixGroups(jobs)
+	members := []string{"build_0", "build_1", "build_2", "build_3"}
+	if !reflect.DeepEqual(groups["build"], members) {
+		t.Fatalf("matrix build expanded to %v, want %v", groups["build"], members)
+	}
+	// The include that fits no combination is a job of its own
+	if got := jobs["build_3"].Matrix; !reflect.DeepEqual(got, map[string]interface{}{"os": "macos", "arch": "arm64"}) {
+		t.Errorf("build_3 matrix = %v, want the standalone include", got)
+	}
+	if got := jobs["build_0"].Matrix["coverage"]; got != true {
+		t.Errorf("build_0 coverage = %v, want the include's value", got)
+	}
+
+	// deploy waits for every job of the matrix, the include-added one too
+	if got := expandNeeds(jobs["deploy"].Needs, groups); !reflect.DeepEqual(got, members) {
+		t.Errorf("deploy needs %v, want %v", got, members)
+	}
+	if err := validateJobDependencies(jobs, groups); err != nil {
+		t.Errorf("validateJobDependencies() error = %v", err)
+	}
+	waves, err := executionWaves(jobs, groups)
+	if err != nil {
+		t.Fatalf("executionWaves() error = %v", err)
+	}
+	if want := [][]string{members, {"deploy"}}; !reflect.DeepEqual(waves, want) {
+		t.Errorf("executionWaves() = %v, want %v", waves, want)
+	}
+
+	// deploy sees one result for the matrix, by the name it declared
+	tests := []struct {
+		name    string
+		results map[string]string
+		want    string
+	}{
+		{"all succeeded", map[string]string{"build_0": JobResultSuccess, "build_1": JobResultSuccess, "build_2": JobResultSuccess, "build_3": JobResultSuccess}, JobResultSuccess},
+		{"include-added job failed", map[string]string{"build_0": JobResultSuccess, "build_1": JobResultSuccess, "build_2": JobResultSuccess, "build_3": JobResultFailure}, JobResultFailure},
+		{"failure beats cancelled", map[string]string{"build_0": JobResultCancelled, "build_1": JobResultFailure, "build_2": JobResultSuccess, "build_3": JobResultSuccess}, JobResultFailure},
+		{"one cancelled", map[string]string{"build_0": JobResultSuccess, "build_1": JobResultSuccess, "build_2": JobResultCancelled, "build_3": JobResultSuccess}, JobResultCancelled},
+		{"some skipped", map[string]string{"build_0": JobResultSkipped, "build_1": JobResultSuccess, "build_2": JobResultSkipped, "build_3": JobResultSkipped}, JobResultSuccess},
+		{"all skipped", map[string]string{"build_0": JobResultSkipped, "build_1": JobResultSkipped, "build_2": JobResultSkipped, "build_3": JobResultSkipped}, JobResultSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newResultsStore()
+			for _, member := range members {
+				store.Set(JobResult{JobName: member, Result: tt.results[member], Outputs: map[string]string{"os": jobs[member].Matrix["os"].(string)}})
+			}
+
+			needs := store.SnapshotNeeds(jobs["deploy"].Needs, groups)
+			build, ok := needs["build"]
+			if !ok || len(needs) != 1 {
+				t.Fatalf("SnapshotNeeds() = %v, want only build", needs)
+			}
+			if build.Result != tt.want {
+				t.Errorf("needs.build.result = %q, want %q", build.Result, tt.want)
+			}
+			// Outputs merge in job name order, so the last job of the matrix wins
+			if build.Outputs["os"] != "macos" {
+				t.Errorf("needs.build.outputs.os = %q, want macos", build.Outputs["os"])
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package cron validates the POSIX cron expressions used by on.schedule.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field describes one of the five fields of a cron expression
+type field struct {
+	name     string
+	min, max int
+	names    []string // names[i] stands for min+i, e.g. JAN for 1
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 0, max: 6, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// Validate checks a five-field cron expression (minute, hour, day of month, month and
+// day of week). Each field is *, a value, a range a-b or a comma separated list of
+// these, optionally followed by /step. Months and weekdays may also be given by their
+// three letter English names.
+func Validate(expr string) error {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return fmt.Errorf("expected %d fields, got %d", len(fields), len(parts))
+	}
+
+	for i, part := range parts {
+		if err := fields[i].validate(part); err != nil {
+			return fmt.Errorf("%s: %w", fields[i].name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks one field of the expression
+func (f field) validate(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item == "" {
+			return fmt.Errorf("empty list entry in %q", value)
+		}
+
+		rangePart, step, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q", step)
+			}
+		}
+
+		if rangePart == "*" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(rangePart, "-")
+		start, err := f.value(low)
+		if err != nil {
+			return err
+		}
+		if !isRange {
+			continue
+		}
+		end, err := f.value(high)
+		if err != nil {
+			return err
+		}
+		if start > end {
+			return fmt.Errorf("range %q runs backwards", rangePart)
+		}
+	}
+	return nil
+}
+
+// value parses a number or name within the field's bounds
+func (f field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d is outside %d-%d", n, f.min, f.max)
+	}
+	return n, nil
+}
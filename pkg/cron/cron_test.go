@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"* * * * *", ""},
+		{"0 0 1 1 0", ""},
+		{"59 23 31 12 6", ""},
+		{"*/15 0-23/2 1,15 JAN-jun MON-FRI", ""},
+		{"30 5 * dec sun", ""},
+		{"  0   12 * * *  ", ""},
+
+		{"* * * *", "expected 5 fields, got 4"},
+		{"* * * * * *", "expected 5 fields, got 6"},
+		{"", "expected 5 fields, got 0"},
+
+		// Each field has its own bounds
+		{"60 * * * *", "minute: value 60 is outside 0-59"},
+		{"-1 * * * *", "minute: invalid value"},
+		{"* 24 * * *", "hour: value 24 is outside 0-23"},
+		{"* * 0 * *", "day of month: value 0 is outside 1-31"},
+		{"* * 32 * *", "day of month: value 32 is outside 1-31"},
+		{"* * * 0 *", "month: value 0 is outside 1-12"},
+		{"* * * 13 *", "month: value 13 is outside 1-12"},
+		{"* * * * 7", "day of week: value 7 is outside 0-6"},
+
+		// Names only belong to their own field
+		{"* * * MON *", "month: invalid value \"MON\""},
+		{"* * * * JAN", "day of week: invalid value \"JAN\""},
+		{"* * JAN * *", "day of month: invalid value \"JAN\""},
+
+		{"5-1 * * * *", "minute: range \"5-1\" runs backwards"},
+		{"1-70 * * * *", "minute: value 70 is outside 0-59"},
+		{"*/0 * * * *", "minute: invalid step \"0\""},
+		{"*/x * * * *", "minute: invalid step \"x\""},
+		{"1,,2 * * * *", "minute: empty list entry"},
+		{"? * * * *", "minute: invalid value \"?\""},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.expr)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("Validate(%q) error = %v, want nil", tt.expr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Validate(%q) error = %v, want one containing %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
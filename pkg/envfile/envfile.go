@@ -0,0 +1,68 @@
+// Package envfile parses the environment files steps write to, such as
+// GITHUB_OUTPUT and GITHUB_ENV.
+package envfile
+
+import (
+	"strings"
+)
+
+// ParseGitHubOutput parses the contents of a GITHUB_OUTPUT style file.
+// Each entry is either a single line in the form name=value, where the value
+// is everything after the first '=', or a multiline value in the form
+//
+//	name<<DELIMITER
+//	line one
+//	line two
+//	DELIMITER
+//
+// Later entries override earlier ones. Blank lines between entries, lines
+// without a name and heredocs missing their closing delimiter are ignored.
+func ParseGitHubOutput(data []byte) map[string]string {
+	outputs := make(map[string]string)
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		heredoc := strings.Index(line, "<<")
+
+		// A heredoc marker only counts when it comes before any '='
+		if heredoc > 0 && (eq < 0 || heredoc < eq) {
+			name := strings.TrimSpace(line[:heredoc])
+			delimiter := strings.TrimSpace(line[heredoc+2:])
+			if name == "" || delimiter == "" {
+				continue
+			}
+
+			end := -1
+			for j := i + 1; j < len(lines); j++ {
+				if lines[j] == delimiter {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				// Without a closing delimiter the value can't be told apart
+				// from later entries, so the rest of the file is skipped
+				break
+			}
+
+			outputs[name] = strings.Join(lines[i+1:end], "\n")
+			i = end
+			continue
+		}
+
+		if eq > 0 {
+			name := strings.TrimSpace(line[:eq])
+			if name != "" {
+				outputs[name] = line[eq+1:]
+			}
+		}
+	}
+
+	return outputs
+}
@@ -0,0 +1,40 @@
+package envfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGitHubOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"single line", "a=1\nb=two words\n", map[string]string{"a": "1", "b": "two words"}},
+		{"value with equals", "url=https://example.com/?a=b", map[string]string{"url": "https://example.com/?a=b"}},
+		{"empty value", "a=\n", map[string]string{"a": ""}},
+		{"later wins", "a=1\na=2\n", map[string]string{"a": "2"}},
+		{"windows line endings", "a=1\r\nb=2\r\n", map[string]string{"a": "1", "b": "2"}},
+		{"blank lines and lines without a name", "\n  \n=value\nnoequals\na=1\n", map[string]string{"a": "1"}},
+		{
+			"heredoc",
+			"notes<<EOF\nline one\n\nline=three\nEOF\nafter=yes\n",
+			map[string]string{"notes": "line one\n\nline=three", "after": "yes"},
+		},
+		{"empty heredoc", "notes<<EOF\nEOF\n", map[string]string{"notes": ""}},
+		{"heredoc with random delimiter", "json<<ghadelimiter_1234\n{\"a\": 1}\nghadelimiter_1234\n", map[string]string{"json": "{\"a\": 1}"}},
+		{"heredoc marker after equals", "cmd=cat <<EOF\n", map[string]string{"cmd": "cat <<EOF"}},
+		{"delimiter must match the whole line", "a<<EOF\n EOF\nEOF \nEOF\n", map[string]string{"a": " EOF\nEOF "}},
+		{"unterminated heredoc", "a=1\nb<<EOF\nnever closed\nc=3\n", map[string]string{"a": "1"}},
+		{"heredoc without delimiter", "a<<\nb=2\n", map[string]string{"b": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseGitHubOutput([]byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGitHubOutput(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package expression
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Function is a callable available to expressions
+type Function func(args ...interface{}) (interface{}, error)
+
+// Evaluator evaluates expressions against a set of named contexts.
+// Context values may be nil, bool, float64/int, string, maps and slices.
+type Evaluator struct {
+	Contexts  map[string]interface{}
+	Functions map[string]Function
+}
+
+// Lookup is a context whose properties are resolved when an expression reads them, such as
+// secrets that are fetched or masked on first use. It can't be enumerated, so object
+// filters over it are empty.
+type Lookup interface {
+	Lookup(name string) (interface{}, bool)
+}
+
+// filteredArray is the result of an object filter; property access maps over its elements
+type filteredArray []interface{}
+
+// Evaluate parses and evaluates an expression body (without the ${{ }} wrapper)
+func (e *Evaluator) Evaluate(expr string) (interface{}, error) {
+	node, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvaluateNode(node)
+}
+
+// EvaluateNode evaluates a parsed expression tree
+func (e *Evaluator) EvaluateNode(node Node) (interface{}, error) {
+	value, err := e.eval(node)
+	if err != nil {
+		return nil, err
+	}
+	if filtered, ok := value.(filteredArray); ok {
+		return []interface{}(filtered), nil
+	}
+	return value, nil
+}
+
+func (e *Evaluator) eval(node Node) (interface{}, error) {
+	switch n := node.(type) {
+	case *Literal:
+		return n.Value, nil
+
+	case *ContextAccess:
+		if value, ok := lookupKey(e.Contexts, n.Name); ok {
+			return normalize(value), nil
+		}
+		return nil, fmt.Errorf("unrecognized named-value: '%s'", n.Name)
+
+	case *PropertyAccess:
+		object, err := e.eval(n.Object)
+		if err != nil {
+			return nil, err
+		}
+		return property(object, n.Property), nil
+
+	case *IndexAccess:
+		object, err := e.eval(n.Object)
+		if err != nil {
+			return nil, err
+		}
+		index, err := e.eval(n.Index)
+		if err != nil {
+			return nil, err
+		}
+		return indexValue(object, index), nil
+
+	case *Filter:
+		object, err := e.eval(n.Object)
+		if err != nil {
+			return nil, err
+		}
+		return filter(object), nil
+
+	case *FunctionCall:
+		args := make([]interface{}, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := e.EvaluateNode(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		fn := e.lookupFunction(n.Name)
+		if fn == nil {
+			return nil, fmt.Errorf("unrecognized function: '%s'", n.Name)
+		}
+		return fn(args...)
+
+	case *Not:
+		operand, err := e.eval(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return !Truthy(operand), nil
+
+	case *Binary:
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		// Logical operators short-circuit and return the deciding operand
+		switch n.Op {
+		case TokenAnd:
+			if !Truthy(left) {
+				return left, nil
+			}
+			return e.eval(n.Right)
+		case TokenOr:
+			if Truthy(left) {
+				return left, nil
+			}
+			return e.eval(n.Right)
+		}
+
+		right, err := e.eval(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return compare(n.Op, left, right), nil
+	}
+
+	return nil, fmt.Errorf("unsupported expression node %T", node)
+}
+
+// lookupFunction resolves a function by case-insensitive name, preferring evaluator functions over builtins
+func (e *Evaluator) lookupFunction(name string) Function {
+	for fnName, fn := range e.Functions {
+		if strings.EqualFold(fnName, name) {
+			return fn
+		}
+	}
+	for fnName, fn := range builtinFunctions {
+		if strings.EqualFold(fnName, name) {
+			return fn
+		}
+	}
+	return nil
+}
+
+// lookupKey finds a key in a map, matching case-insensitively like GitHub does
+func lookupKey(m map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	for k, value := range m {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// normalize converts common Go types into the value types used by the evaluator
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = item
+		}
+		return m
+	case map[string]map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case []string:
+		a := make([]interface{}, len(v))
+		for i, item := range v {
+			a[i] = item
+		}
+		return a
+	}
+	return value
+}
+
+// property dereferences object.name, mapping over filtered arrays
+func property(object interface{}, name string) interface{} {
+	switch o := object.(type) {
+	case map[string]interface{}:
+		value, _ := lookupKey(o, name)
+		return normalize(value)
+	case Lookup:
+		value, _ := o.Lookup(name)
+		return normalize(value)
+	case filteredArray:
+		var result filteredArray
+		for _, item := range o {
+			if value := property(item, name); value != nil {
+				result = append(result, value)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// indexValue dereferences object[index]
+func indexValue(object, index interface{}) interface{} {
+	switch o := object.(type) {
+	case map[string]interface{}, filteredArray, Lookup:
+		if key, ok := index.(string); ok {
+			return property(o, key)
+		}
+		return property(o, ToString(index))
+	case []interface{}:
+		i := ToNumber(index)
+		if math.IsNaN(i) || i < 0 || int(i) >= len(o) {
+			return nil
+		}
+		return normalize(o[int(i)])
+	}
+	return nil
+}
+
+// filter applies an object filter, producing an array of the object's values
+func filter(object interface{}) interface{} {
+	switch o := object.(type) {
+	case map[string]interface{}:
+		result := make(filteredArray, 0, len(o))
+		for _, value := range o {
+			result = append(result, normalize(value))
+		}
+		return result
+	case []interface{}:
+		result := make(filteredArray, 0, len(o))
+		for _, value := range o {
+			result = append(result, normalize(value))
+		}
+		return result
+	case filteredArray:
+		var result filteredArray
+		for _, item := range o {
+			if inner, ok := filter(item).(filteredArray); ok {
+				result = append(result, inner...)
+			}
+		}
+		return result
+	}
+	return filteredArray{}
+}
+
+// compare evaluates an equality or relational operator using GitHub's coercion rules
+func compare(op TokenKind, left, right interface{}) bool {
+	left, right = normalize(left), normalize(right)
+
+	// Strings compare case-insensitively with each other
+	leftStr, leftIsStr := left.(string)
+	rightStr, rightIsStr := right.(string)
+	if leftIsStr && rightIsStr {
+		a, b := strings.ToUpper(leftStr), strings.ToUpper(rightStr)
+		switch op {
+		case TokenEq:
+			return a == b
+		case TokenNe:
+			return a != b
+		case TokenLt:
+			return a < b
+		case TokenLe:
+			return a <= b
+		case TokenGt:
+			return a > b
+		case TokenGe:
+			return a >= b
+		}
+	}
+
+	// Objects and arrays are only equal to themselves
+	if isComposite(left) || isComposite(right) {
+		equal := isComposite(left) && isComposite(right) && sameReference(left, right)
+		switch op {
+		case TokenEq:
+			return equal
+		case TokenNe:
+			return !equal
+		}
+		return false
+	}
+
+	// Null only equals null; other mismatched types are coerced to numbers
+	if left == nil && right == nil {
+		return op == TokenEq || op == TokenLe || op == TokenGe
+	}
+
+	a, b := ToNumber(left), ToNumber(right)
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return op == TokenNe
+	}
+	switch op {
+	case TokenEq:
+		return a == b
+	case TokenNe:
+		return a != b
+	case TokenLt:
+		return a < b
+	case TokenLe:
+		return a <= b
+	case TokenGt:
+		return a > b
+	case TokenGe:
+		return a >= b
+	}
+	return false
+}
+
+func isComposite(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, filteredArray, Lookup:
+		return true
+	}
+	return false
+}
+
+// sameReference reports whether two composite values are the same instance
+func sameReference(a, b interface{}) bool {
+	return fmt.Sprintf("%p", a) == fmt.Sprintf("%p", b)
+}
+
+// Truthy reports whether a value is truthy: false, 0, NaN, "" and null are falsy
+func Truthy(value interface{}) bool {
+	switch v := normalize(value).(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// ToNumber coerces a value to a number using GitHub's rules
+func ToNumber(value interface{}) float64 {
+	switch v := normalize(value).(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if n, err := parseNumber(s); err == nil {
+			return n
+		}
+		return math.NaN()
+	}
+	return math.NaN()
+}
+
+// ToString converts a value to its string form for interpolation
+func ToString(value interface{}) string {
+	switch v := normalize(value).(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case filteredArray:
+		return ToString([]interface{}(v))
+	case Lookup:
+		return "{}"
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,330 @@
+package expression
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testEvaluator() *Evaluator {
+	return &Evaluator{Contexts: map[string]interface{}{
+		"env": map[string]interface{}{"NAME": "vermont", "EMPTY": ""},
+		"obj": map[string]interface{}{"true": "yes", "null": "nothing", "a-b": "dash"},
+		"matrix": map[string]interface{}{
+			"os":       "ubuntu",
+			"versions": []interface{}{"1.21", "1.22"},
+		},
+		"jobs": map[string]interface{}{
+			"build": map[string]interface{}{"result": "success", "outputs": map[string]interface{}{"url": "a"}},
+			"test":  map[string]interface{}{"result": "failure", "outputs": map[string]interface{}{"url": "b"}},
+		},
+		"items": []interface{}{
+			map[string]interface{}{"name": "x"},
+			map[string]interface{}{"name": "y"},
+			map[string]interface{}{"other": "z"},
+		},
+	}}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want interface{}
+	}{
+		// Literals
+		{"escaped quote", "'it''s'", "it's"},
+		{"empty string", "''", ""},
+		{"hex", "0xff", float64(255)},
+		{"negative fraction", "-.5", -0.5},
+		{"fraction", ".5", 0.5},
+		{"exponent", "1e3", float64(1000)},
+		{"infinity", "Infinity", math.Inf(1)},
+		{"null", "null", nil},
+
+		// Property access
+		{"keyword property", "obj.true", "yes"},
+		{"null property", "obj.null", "nothing"},
+		{"dashed property", "obj.a-b", "dash"},
+		{"case-insensitive context", "ENV.name", "vermont"},
+		{"missing property", "env.MISSING", nil},
+		{"index", "matrix['os']", "ubuntu"},
+		{"array index", "matrix.versions[1]", "1.22"},
+		{"out of range index", "matrix.versions[5]", nil},
+
+		// Precedence: ! binds tighter than comparisons, which bind tighter than && and ||
+		{"and before or", "true || false && false", true},
+		{"comparison before and", "1 == 1 && 2 == 2", true},
+		{"not before comparison", "!false == true", true},
+		{"parentheses", "(true || false) && false", false},
+
+		// Logical operators return the deciding operand, not a boolean
+		{"or returns first truthy", "env.EMPTY || 'fallback'", "fallback"},
+		{"or returns left", "env.NAME || 'fallback'", "vermont"},
+		{"and returns first falsy", "env.EMPTY && 'never'", ""},
+		{"and returns right", "env.NAME && 'then'", "then"},
+		{"or short-circuits", "true || nope.missing", true},
+		{"and short-circuits", "false && nope.missing", false},
+
+		// Comparison coercion
+		{"null equals zero", "null == 0", true},
+		{"null equals null", "null == null", true},
+		{"null is not empty object", "null == obj", false},
+		{"strings ignore case", "'ABC' == 'abc'", true},
+		{"string ordering ignores case", "'a' < 'B'", true},
+		{"number string", "'10' == 10", true},
+		{"bool coerces to number", "true == 1", true},
+		{"nan is not equal to itself", "NaN == NaN", false},
+		{"nan is unequal to itself", "NaN != NaN", true},
+		{"non-numeric string is nan", "'abc' == 0", false},
+		{"nan is not greater", "NaN > 0", false},
+		{"empty string is zero", "'' == 0", true},
+		{"object equals itself", "obj == obj", true},
+
+		// Object filters
+		{"filter property", "jobs.*.result", []interface{}{"failure", "success"}},
+		{"array filter", "items.*.name", []interface{}{"x", "y"}},
+		{"index filter", "matrix.versions[*]", []interface{}{"1.21", "1.22"}},
+		{"contains filter", "contains(jobs.*.result, 'failure')", true},
+		{"filter of scalar", "env.NAME.*", []interface{}{}},
+
+		// Builtin functions
+		{"contains substring ignores case", "contains('Hello World', 'WORLD')", true},
+		{"contains array", "contains(matrix.versions, '1.21')", true},
+		{"contains array misses", "contains(matrix.versions, '1.2')", false},
+		{"startsWith", "startsWith('refs/heads/main', 'REFS/')", true},
+		{"endsWith", "endsWith('file.go', '.GO')", true},
+		{"format", "format('{0}-{1}-{0}', 'a', 'b')", "a-b-a"},
+		{"format escapes braces", "format('{{0}} is {0}}}', 'x')", "{0} is x}"},
+		{"join", "join(matrix.versions, ', ')", "1.21, 1.22"},
+		{"join default separator", "join(matrix.versions)", "1.21,1.22"},
+		{"join scalar", "join('one')", "one"},
+		{"toJSON", "toJSON(matrix.versions)", "[\n  \"1.21\",\n  \"1.22\"\n]"},
+		{"fromJSON", "fromJSON('{\"a\": [1, true]}').a[1]", true},
+		{"fromJSON number", "fromJSON('42')", float64(42)},
+		{"function names ignore case", "STARTSWITH('abc', 'a')", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testEvaluator().Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate(%q) error = %v", tt.expr, err)
+			}
+			if list, ok := got.([]interface{}); ok && strings.Contains(tt.expr, "jobs.*") {
+				got = sortedStrings(list)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+// sortedStrings orders a filter result over a map, whose order isn't defined
+func sortedStrings(list []interface{}) []interface{} {
+	sorted := append([]interface{}(nil), list...)
+	for i := range sorted {
+		for j := i + 1; j < len(sorted); j++ {
+			if ToString(sorted[j]) < ToString(sorted[i]) {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+	}
+	return sorted
+}
+
+func TestEvaluateNaN(t *testing.T) {
+	got, err := testEvaluator().Evaluate("NaN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := got.(float64); !ok || !math.IsNaN(n) {
+		t.Errorf("Evaluate(NaN) = %#v, want NaN", got)
+	}
+	if Truthy(got) {
+		t.Error("Truthy(NaN) = true, want false")
+	}
+	if s := ToString(got); s != "NaN" {
+		t.Errorf("ToString(NaN) = %q, want NaN", s)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"unknown context", "nope.x", "unrecognized named-value: 'nope'"},
+		{"unknown function", "nope()", "unrecognized function: 'nope'"},
+		{"unterminated string", "'abc", "unterminated string literal"},
+		{"format placeholder out of range", "format('{1}', 'a')", "invalid placeholder \"{1}\""},
+		{"format placeholder not a number", "format('{x}', 'a')", "invalid placeholder \"{x}\""},
+		{"format unclosed placeholder", "format('{0', 'a')", "unclosed placeholder"},
+		{"contains arguments", "contains('a')", "contains() expects 2 argument(s), got 1"},
+		{"fromJSON invalid", "fromJSON('{')", "fromJSON() failed"},
+		{"unexpected character", "1 # 2", "unexpected character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testEvaluator().Evaluate(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Evaluate(%q) error = %v, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+type lookupContext map[string]string
+
+func (l lookupContext) Lookup(name string) (interface{}, bool) {
+	value, ok := l[strings.ToUpper(name)]
+	if !ok {
+		return nil, false
+	}
+	return value, true
+}
+
+func TestEvaluateLookup(t *testing.T) {
+	evaluator := &Evaluator{Contexts: map[string]interface{}{
+		"secrets": lookupContext{"TOKEN": "abc"},
+	}}
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"secrets.token", "abc"},
+		{"secrets['TOKEN']", "abc"},
+		{"secrets.MISSING", nil},
+		{"secrets.*", []interface{}{}},
+		{"format('{0}', secrets)", "{}"},
+	}
+	for _, tt := range tests {
+		got, err := evaluator.Evaluate(tt.expr)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error = %v", tt.expr, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Evaluate(%q) = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFindExpressions(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		want  []string
+		error bool
+	}{
+		{"none", "plain text", nil, false},
+		{"several", "a ${{ env.A }} b ${{env.B}}", []string{"env.A", "env.B"}, false},
+		{"braces in string", "${{ format('}}{0}', 'x') }} done", []string{"format('}}{0}', 'x')"}, false},
+		{"escaped quote in string", "${{ 'it''s }}' }}", []string{"'it''s }}'"}, false},
+		{"unterminated expression", "${{ env.A", nil, true},
+		{"unterminated string", "${{ 'abc }}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans, err := FindExpressions(tt.text)
+			if (err != nil) != tt.error {
+				t.Fatalf("FindExpressions(%q) error = %v, want error %v", tt.text, err, tt.error)
+			}
+			var got []string
+			for _, span := range spans {
+				got = append(got, span.Expr)
+				if !strings.HasPrefix(tt.text[span.Start:], "${{") || !strings.HasSuffix(tt.text[:span.End], "}}") {
+					t.Errorf("span %+v doesn't cover the expression in %q", span, tt.text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindExpressions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	got, err := testEvaluator().Interpolate("name=${{ env.NAME }} os=${{ matrix.os }} ok=${{ 1 == 1 }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name=vermont os=ubuntu ok=true"; got != want {
+		t.Errorf("Interpolate() = %q, want %q", got, want)
+	}
+
+	if _, err := testEvaluator().Interpolate("${{ nope.x }}"); err == nil || !strings.Contains(err.Error(), "failed to evaluate 'nope.x'") {
+		t.Errorf("Interpolate() error = %v, want it to name the expression", err)
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	calls := 0
+	withStatus := func(succeeded bool) *Evaluator {
+		e := testEvaluator()
+		e.Functions = map[string]Function{
+			"success":   func(args ...interface{}) (interface{}, error) { calls++; return succeeded, nil },
+			"failure":   func(args ...interface{}) (interface{}, error) { return !succeeded, nil },
+			"always":    func(args ...interface{}) (interface{}, error) { return true, nil },
+			"cancelled": func(args ...interface{}) (interface{}, error) { return false, nil },
+		}
+		return e
+	}
+
+	tests := []struct {
+		name      string
+		evaluator *Evaluator
+		condition string
+		want      bool
+	}{
+		{"empty means success", withStatus(true), "", true},
+		{"empty after failure", withStatus(false), "", false},
+		{"implicit success", withStatus(false), "env.NAME == 'vermont'", false},
+		{"implicit success passes", withStatus(true), "env.NAME == 'vermont'", true},
+		{"wrapped", withStatus(true), "${{ env.NAME == 'vermont' }}", true},
+		{"wrapped with spaces", withStatus(true), "  ${{ matrix.os == 'windows' }}  ", false},
+		{"explicit status function", withStatus(false), "always() && env.NAME == 'vermont'", true},
+		{"failure", withStatus(false), "failure()", true},
+		{"status function in argument", withStatus(false), "contains(toJSON(failure()), 'true')", true},
+		{"without status functions", testEvaluator(), "", true},
+		{"without status functions evaluates as is", testEvaluator(), "matrix.os == 'ubuntu'", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.evaluator.EvaluateCondition(tt.condition)
+			if err != nil {
+				t.Fatalf("EvaluateCondition(%q) error = %v", tt.condition, err)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+
+	// The implicit success() is only added when the condition doesn't call a status function itself
+	calls = 0
+	if _, err := withStatus(true).EvaluateCondition("always()"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("EvaluateCondition(always()) called success() %d times, want 0", calls)
+	}
+}
+
+func TestEvaluateConditionRejectsSeveralWrappers(t *testing.T) {
+	_, err := testEvaluator().EvaluateCondition("${{ env.NAME }} && ${{ matrix.os }}")
+	if err == nil || !strings.Contains(err.Error(), "mixes ${{ }} with other text") {
+		t.Errorf("EvaluateCondition() error = %v, want it to explain the ${{ }} wrappers", err)
+	}
+}
+
+func TestReferencedProperties(t *testing.T) {
+	got, err := ReferencedProperties("env.A == env['B'] || ENV.a || secrets.C || format('{0}', env.D)", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A", "B", "a", "D"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReferencedProperties() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package expression
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// builtinFunctions are the context-independent functions available to every expression
+var builtinFunctions = map[string]Function{
+	"contains":   contains,
+	"startsWith": startsWith,
+	"endsWith":   endsWith,
+	"format":     format,
+	"join":       join,
+	"toJSON":     toJSON,
+	"fromJSON":   fromJSON,
+}
+
+// StatusFunctions are the job status check functions; they change how if conditions are evaluated
+var StatusFunctions = []string{"success", "always", "failure", "cancelled"}
+
+func checkArgs(name string, args []interface{}, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("%s() expects %d argument(s), got %d", name, min, len(args))
+		}
+		return fmt.Errorf("%s() expects %d to %d arguments, got %d", name, min, max, len(args))
+	}
+	return nil
+}
+
+// contains(search, item) checks array membership or case-insensitive substring
+func contains(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("contains", args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	switch search := normalize(args[0]).(type) {
+	case []interface{}:
+		for _, element := range search {
+			if compare(TokenEq, element, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case filteredArray:
+		for _, element := range search {
+			if compare(TokenEq, element, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return strings.Contains(strings.ToUpper(ToString(args[0])), strings.ToUpper(ToString(args[1]))), nil
+}
+
+// startsWith(searchString, searchValue) is a case-insensitive prefix check
+func startsWith(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("startsWith", args, 2, 2); err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(strings.ToUpper(ToString(args[0])), strings.ToUpper(ToString(args[1]))), nil
+}
+
+// endsWith(searchString, searchValue) is a case-insensitive suffix check
+func endsWith(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("endsWith", args, 2, 2); err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(strings.ToUpper(ToString(args[0])), strings.ToUpper(ToString(args[1]))), nil
+}
+
+// format(string, replaceValue0, ...) replaces {N} placeholders; {{ and }} escape braces
+func format(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("format() expects at least 1 argument")
+	}
+
+	pattern := ToString(args[0])
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '{' && i+1 < len(pattern) && pattern[i+1] == '{':
+			sb.WriteByte('{')
+			i++
+		case ch == '}' && i+1 < len(pattern) && pattern[i+1] == '}':
+			sb.WriteByte('}')
+			i++
+		case ch == '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("format() has an unclosed placeholder in %q", pattern)
+			}
+			index, err := strconv.Atoi(pattern[i+1 : i+end])
+			if err != nil || index < 0 || index+1 >= len(args) {
+				return nil, fmt.Errorf("format() has an invalid placeholder %q", pattern[i:i+end+1])
+			}
+			sb.WriteString(ToString(args[index+1]))
+			i += end
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// join(array, optionalSeparator) joins array elements, defaulting to a comma separator
+func join(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("join", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	separator := ","
+	if len(args) == 2 {
+		separator = ToString(args[1])
+	}
+
+	var elements []interface{}
+	switch array := normalize(args[0]).(type) {
+	case []interface{}:
+		elements = array
+	case filteredArray:
+		elements = array
+	default:
+		return ToString(args[0]), nil
+	}
+
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		parts[i] = ToString(element)
+	}
+	return strings.Join(parts, separator), nil
+}
+
+// toJSON(value) returns a pretty-printed JSON representation
+func toJSON(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("toJSON", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	value := normalize(args[0])
+	if filtered, ok := value.(filteredArray); ok {
+		value = []interface{}(filtered)
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("toJSON() failed: %w", err)
+	}
+	return string(data), nil
+}
+
+// fromJSON(value) parses a JSON string into a value
+func fromJSON(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("fromJSON", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(ToString(args[0])), &value); err != nil {
+		return nil, fmt.Errorf("fromJSON() failed: %w", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,228 @@
+// Package expression implements the GitHub Actions ${{ }} expression language:
+// locating expressions inside strings, parsing them and evaluating them against contexts.
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the type of a lexical token
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenNull
+	TokenBool
+	TokenNumber
+	TokenString
+	TokenIdent
+	TokenDot
+	TokenComma
+	TokenStar
+	TokenLParen
+	TokenRParen
+	TokenLBracket
+	TokenRBracket
+	TokenNot
+	TokenAnd
+	TokenOr
+	TokenEq
+	TokenNe
+	TokenLt
+	TokenLe
+	TokenGt
+	TokenGe
+)
+
+// Token represents a single lexical token in an expression
+type Token struct {
+	Kind  TokenKind
+	Value string
+	Pos   int
+}
+
+// Tokenize splits an expression body (without the ${{ }} wrapper) into tokens
+func Tokenize(input string) ([]Token, error) {
+	var tokens []Token
+
+	for i := 0; i < len(input); {
+		ch := input[i]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+
+		case ch == '\'':
+			value, end, err := scanString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Value: value, Pos: i})
+			i = end
+
+		case isDigit(ch) || (ch == '-' && i+1 < len(input) && (isDigit(input[i+1]) || input[i+1] == '.')) ||
+			(ch == '.' && i+1 < len(input) && isDigit(input[i+1]) && !endsValue(tokens)):
+			end := scanNumber(input, i)
+			tokens = append(tokens, Token{Kind: TokenNumber, Value: input[i:end], Pos: i})
+			i = end
+
+		case isIdentStart(ch):
+			end := i + 1
+			for end < len(input) && isIdentChar(input[end]) {
+				end++
+			}
+			word := input[i:end]
+			kind := TokenIdent
+			switch word {
+			case "true", "false":
+				kind = TokenBool
+			case "null":
+				kind = TokenNull
+			case "NaN", "Infinity":
+				kind = TokenNumber
+			}
+			tokens = append(tokens, Token{Kind: kind, Value: word, Pos: i})
+			i = end
+
+		default:
+			kind, width := scanOperator(input[i:])
+			if width == 0 {
+				return nil, fmt.Errorf("unexpected character %q at position %d", ch, i)
+			}
+			tokens = append(tokens, Token{Kind: kind, Value: input[i : i+width], Pos: i})
+			i += width
+		}
+	}
+
+	tokens = append(tokens, Token{Kind: TokenEOF, Pos: len(input)})
+	return tokens, nil
+}
+
+// scanString reads a single-quoted string literal starting at start; a doubled quote escapes a quote
+func scanString(input string, start int) (string, int, error) {
+	var sb strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		if input[i] != '\'' {
+			sb.WriteByte(input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == '\'' {
+			sb.WriteByte('\'')
+			i++
+			continue
+		}
+		return sb.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string literal at position %d", start)
+}
+
+// scanNumber returns the end offset of the number literal starting at start
+func scanNumber(input string, start int) int {
+	i := start
+	if input[i] == '-' {
+		i++
+	}
+
+	// Hexadecimal literal
+	if i+1 < len(input) && input[i] == '0' && (input[i+1] == 'x' || input[i+1] == 'X') {
+		i += 2
+		for i < len(input) && isHexDigit(input[i]) {
+			i++
+		}
+		return i
+	}
+
+	for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+		i++
+	}
+
+	// Exponent
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if j < len(input) && isDigit(input[j]) {
+			i = j
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+		}
+	}
+
+	return i
+}
+
+// scanOperator matches punctuation and operators at the start of input
+func scanOperator(input string) (TokenKind, int) {
+	if len(input) >= 2 {
+		switch input[:2] {
+		case "&&":
+			return TokenAnd, 2
+		case "||":
+			return TokenOr, 2
+		case "==":
+			return TokenEq, 2
+		case "!=":
+			return TokenNe, 2
+		case "<=":
+			return TokenLe, 2
+		case ">=":
+			return TokenGe, 2
+		}
+	}
+
+	switch input[0] {
+	case '.':
+		return TokenDot, 1
+	case ',':
+		return TokenComma, 1
+	case '*':
+		return TokenStar, 1
+	case '(':
+		return TokenLParen, 1
+	case ')':
+		return TokenRParen, 1
+	case '[':
+		return TokenLBracket, 1
+	case ']':
+		return TokenRBracket, 1
+	case '!':
+		return TokenNot, 1
+	case '<':
+		return TokenLt, 1
+	case '>':
+		return TokenGt, 1
+	}
+
+	return TokenEOF, 0
+}
+
+// endsValue reports whether the last token can end an operand, making a following '.' a property access
+func endsValue(tokens []Token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch tokens[len(tokens)-1].Kind {
+	case TokenIdent, TokenRParen, TokenRBracket, TokenStar:
+		return true
+	}
+	return false
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func isIdentStart(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch) || ch == '-'
+}
@@ -0,0 +1,322 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Node is a node in a parsed expression tree
+type Node interface {
+	node()
+}
+
+// Literal is a null, boolean, number or string constant
+type Literal struct {
+	Value interface{}
+}
+
+// ContextAccess is a reference to a named context such as github or matrix
+type ContextAccess struct {
+	Name string
+}
+
+// PropertyAccess is a dereference like object.property
+type PropertyAccess struct {
+	Object   Node
+	Property string
+}
+
+// IndexAccess is a dereference like object['property'] or array[0]
+type IndexAccess struct {
+	Object Node
+	Index  Node
+}
+
+// Filter is an object filter like object.* or object[*]
+type Filter struct {
+	Object Node
+}
+
+// FunctionCall is a call like contains(a, b)
+type FunctionCall struct {
+	Name string
+	Args []Node
+}
+
+// Not is a logical negation
+type Not struct {
+	Operand Node
+}
+
+// Binary is a logical or comparison operation
+type Binary struct {
+	Op    TokenKind
+	Left  Node
+	Right Node
+}
+
+func (*Literal) node()        {}
+func (*ContextAccess) node()  {}
+func (*PropertyAccess) node() {}
+func (*IndexAccess) node()    {}
+func (*Filter) node()         {}
+func (*FunctionCall) node()   {}
+func (*Not) node()            {}
+func (*Binary) node()         {}
+
+// Parse parses an expression body (without the ${{ }} wrapper) into a tree
+func Parse(input string) (Node, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != TokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.Value, tok.Pos)
+	}
+
+	return node, nil
+}
+
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind TokenKind, what string) (Token, error) {
+	tok := p.next()
+	if tok.Kind != kind {
+		if tok.Kind == TokenEOF {
+			return tok, fmt.Errorf("expected %s at end of expression", what)
+		}
+		return tok, fmt.Errorf("expected %s at position %d, got %q", what, tok.Pos, tok.Value)
+	}
+	return tok, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == TokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: TokenOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseEquality()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == TokenAnd {
+		p.next()
+		right, err := p.parseEquality()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: TokenAnd, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseEquality() (Node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for kind := p.peek().Kind; kind == TokenEq || kind == TokenNe; kind = p.peek().Kind {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: kind, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComparison() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for kind := p.peek().Kind; kind == TokenLt || kind == TokenLe || kind == TokenGt || kind == TokenGe; kind = p.peek().Kind {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: kind, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().Kind == TokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (Node, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peek().Kind {
+		case TokenDot:
+			p.next()
+			tok := p.next()
+			switch tok.Kind {
+			case TokenStar:
+				node = &Filter{Object: node}
+			case TokenIdent, TokenBool, TokenNull, TokenNumber:
+				if tok.Kind == TokenNumber && !isIdentStart(tok.Value[0]) {
+					return nil, fmt.Errorf("expected property name at position %d, got %q", tok.Pos, tok.Value)
+				}
+				node = &PropertyAccess{Object: node, Property: tok.Value}
+			default:
+				return nil, fmt.Errorf("expected property name at position %d", tok.Pos)
+			}
+
+		case TokenLBracket:
+			p.next()
+			if p.peek().Kind == TokenStar {
+				p.next()
+				node = &Filter{Object: node}
+			} else {
+				index, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				node = &IndexAccess{Object: node, Index: index}
+			}
+			if _, err := p.expect(TokenRBracket, "']'"); err != nil {
+				return nil, err
+			}
+
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.next()
+
+	switch tok.Kind {
+	case TokenNull:
+		return &Literal{Value: nil}, nil
+
+	case TokenBool:
+		return &Literal{Value: tok.Value == "true"}, nil
+
+	case TokenNumber:
+		value, err := parseNumber(tok.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.Value, tok.Pos)
+		}
+		return &Literal{Value: value}, nil
+
+	case TokenString:
+		return &Literal{Value: tok.Value}, nil
+
+	case TokenIdent:
+		if p.peek().Kind != TokenLParen {
+			return &ContextAccess{Name: tok.Value}, nil
+		}
+
+		p.next()
+		call := &FunctionCall{Name: tok.Value}
+		if p.peek().Kind != TokenRParen {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.Args = append(call.Args, arg)
+				if p.peek().Kind != TokenComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if _, err := p.expect(TokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return call, nil
+
+	case TokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return node, nil
+
+	case TokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.Value, tok.Pos)
+}
+
+// parseNumber converts a number literal, including hex and NaN/Infinity, to a float64
+func parseNumber(literal string) (float64, error) {
+	switch literal {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	}
+
+	negative := strings.HasPrefix(literal, "-")
+	digits := strings.TrimPrefix(literal, "-")
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		value, err := strconv.ParseInt(digits[2:], 16, 64)
+		if err != nil {
+			return 0, err
+		}
+		if negative {
+			value = -value
+		}
+		return float64(value), nil
+	}
+
+	return strconv.ParseFloat(literal, 64)
+}
@@ -0,0 +1,220 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Span describes the location of a ${{ }} expression within a string
+type Span struct {
+	Start int    // offset of "${{"
+	End   int    // offset just past "}}"
+	Expr  string // trimmed expression body
+}
+
+// FindExpressions locates every ${{ }} expression in text.
+// A "}}" inside a string literal does not terminate the expression.
+func FindExpressions(text string) ([]Span, error) {
+	var spans []Span
+
+	for offset := 0; ; {
+		start := strings.Index(text[offset:], "${{")
+		if start == -1 {
+			return spans, nil
+		}
+		start += offset
+
+		end := -1
+		for i := start + 3; i < len(text); i++ {
+			if text[i] == '\'' {
+				_, stringEnd, err := scanString(text, i)
+				if err != nil {
+					return nil, fmt.Errorf("unterminated string literal in expression at offset %d", start)
+				}
+				i = stringEnd - 1
+				continue
+			}
+			if text[i] == '}' && i+1 < len(text) && text[i+1] == '}' {
+				end = i + 2
+				break
+			}
+		}
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated expression at offset %d", start)
+		}
+
+		spans = append(spans, Span{
+			Start: start,
+			End:   end,
+			Expr:  strings.TrimSpace(text[start+3 : end-2]),
+		})
+		offset = end
+	}
+}
+
+// ReplaceFunc replaces each ${{ }} expression in text with the result of fn applied to its body
+func ReplaceFunc(text string, fn func(expr string) (string, error)) (string, error) {
+	spans, err := FindExpressions(text)
+	if err != nil {
+		return "", err
+	}
+	if len(spans) == 0 {
+		return text, nil
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, span := range spans {
+		replacement, err := fn(span.Expr)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(text[last:span.Start])
+		sb.WriteString(replacement)
+		last = span.End
+	}
+	sb.WriteString(text[last:])
+
+	return sb.String(), nil
+}
+
+// Interpolate evaluates every ${{ }} expression in text and substitutes its string value
+func (e *Evaluator) Interpolate(text string) (string, error) {
+	return ReplaceFunc(text, func(expr string) (string, error) {
+		value, err := e.Evaluate(expr)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate '%s': %w", expr, err)
+		}
+		return ToString(value), nil
+	})
+}
+
+// EvaluateCondition evaluates an if condition, which may omit the ${{ }} wrapper but can't
+// combine several wrapped expressions.
+// Like GitHub, a condition without a status function is implicitly prefixed with success() &&
+// when the evaluator provides a success function, and an empty condition means success().
+func (e *Evaluator) EvaluateCondition(condition string) (bool, error) {
+	condition = strings.TrimSpace(condition)
+	if strings.HasPrefix(condition, "${{") && strings.HasSuffix(condition, "}}") {
+		if spans, err := FindExpressions(condition); err == nil && len(spans) == 1 && spans[0].End == len(condition) {
+			condition = spans[0].Expr
+		}
+	}
+
+	hasSuccess := e.lookupFunction("success") != nil
+	if condition == "" {
+		if !hasSuccess {
+			return true, nil
+		}
+		condition = "success()"
+	}
+
+	node, err := Parse(condition)
+	if err != nil && strings.Contains(condition, "${{") {
+		// The parse error of "${{ a }} && ${{ b }}" would only name an unexpected token
+		return false, fmt.Errorf("condition %q mixes ${{ }} with other text: wrap the whole condition in one ${{ }} or leave the wrappers out", condition)
+	}
+	if err != nil {
+		return false, err
+	}
+	if hasSuccess && !usesStatusFunction(node) {
+		node = &Binary{Op: TokenAnd, Left: &FunctionCall{Name: "success"}, Right: node}
+	}
+
+	value, err := e.EvaluateNode(node)
+	if err != nil {
+		return false, err
+	}
+	return Truthy(value), nil
+}
+
+// ReferencedContexts returns the distinct context names an expression body refers to
+func ReferencedContexts(expr string) ([]string, error) {
+	node, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	walk(node, func(n Node) {
+		if ctx, ok := n.(*ContextAccess); ok && !seen[ctx.Name] {
+			seen[ctx.Name] = true
+			names = append(names, ctx.Name)
+		}
+	})
+	return names, nil
+}
+
+// ReferencedProperties returns the distinct properties of a context that an expression body reads,
+// such as FOO for env.FOO or env['FOO']
+func ReferencedProperties(expr, context string) ([]string, error) {
+	node, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	walk(node, func(n Node) {
+		switch access := n.(type) {
+		case *PropertyAccess:
+			if ctx, ok := access.Object.(*ContextAccess); ok && strings.EqualFold(ctx.Name, context) {
+				add(access.Property)
+			}
+		case *IndexAccess:
+			ctx, ok := access.Object.(*ContextAccess)
+			literal, isLiteral := access.Index.(*Literal)
+			if ok && isLiteral && strings.EqualFold(ctx.Name, context) {
+				if name, isString := literal.Value.(string); isString {
+					add(name)
+				}
+			}
+		}
+	})
+	return names, nil
+}
+
+// usesStatusFunction reports whether the tree calls success(), always(), failure() or cancelled()
+func usesStatusFunction(node Node) bool {
+	found := false
+	walk(node, func(n Node) {
+		if call, ok := n.(*FunctionCall); ok {
+			for _, name := range StatusFunctions {
+				if strings.EqualFold(call.Name, name) {
+					found = true
+				}
+			}
+		}
+	})
+	return found
+}
+
+// walk visits every node in the tree depth-first
+func walk(node Node, visit func(Node)) {
+	visit(node)
+	switch n := node.(type) {
+	case *PropertyAccess:
+		walk(n.Object, visit)
+	case *IndexAccess:
+		walk(n.Object, visit)
+		walk(n.Index, visit)
+	case *Filter:
+		walk(n.Object, visit)
+	case *FunctionCall:
+		for _, arg := range n.Args {
+			walk(arg, visit)
+		}
+	case *Not:
+		walk(n.Operand, visit)
+	case *Binary:
+		walk(n.Left, visit)
+		walk(n.Right, visit)
+	}
+}
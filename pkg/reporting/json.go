@@ -0,0 +1,55 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// formatJSON writes the report as indented JSON, with durations in seconds
+func formatJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// Step names often contain shell redirections; keep them readable
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
+
+// marshalJSON encodes v like json.Marshal without escaping HTML characters; the encoder
+// doesn't pass its own setting on to MarshalJSON methods
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// MarshalJSON adds the run's duration in seconds
+func (r Report) MarshalJSON() ([]byte, error) {
+	type plain Report
+	return marshalJSON(struct {
+		plain
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{plain(r), r.Duration.Seconds()})
+}
+
+// MarshalJSON adds the job's duration in seconds
+func (j Job) MarshalJSON() ([]byte, error) {
+	type plain Job
+	return marshalJSON(struct {
+		plain
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{plain(j), j.Duration.Seconds()})
+}
+
+// MarshalJSON adds the step's duration in seconds
+func (s Step) MarshalJSON() ([]byte, error) {
+	type plain Step
+	return marshalJSON(struct {
+		plain
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{plain(s), s.Duration.Seconds()})
+}
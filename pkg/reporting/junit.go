@@ -0,0 +1,121 @@
+package reporting
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// JUnit XML elements; encoding/xml escapes attribute values and output text
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	ClassName  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+// junitProperties carry the step id, so tools can match test cases to workflow steps
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitTime formats a duration in seconds the way JUnit reports expect
+func junitTime(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// JUnitTests returns the number of test cases a JUnit report of the report has
+func JUnitTests(report *Report) int {
+	return junitReport(report).Tests
+}
+
+// junitReport converts a report to JUnit XML elements: a test suite per job that ran and a
+// test case per step. A step fails its test case by its outcome, so a failure continue-on-error
+// tolerated still fails it.
+func junitReport(report *Report) junitTestSuites {
+	suites := junitTestSuites{Name: report.Workflow, Suites: []junitTestSuite{}}
+	var total time.Duration
+
+	for _, job := range report.Jobs {
+		if !job.Ran {
+			continue
+		}
+		suite := junitTestSuite{Name: job.Name}
+		var elapsed time.Duration
+		for _, step := range job.Steps {
+			testCase := junitTestCase{Name: step.DisplayName(), ClassName: job.Name, Time: junitTime(step.Duration)}
+			if step.ID != "" {
+				testCase.Properties = &junitProperties{Properties: []junitProperty{{Name: "id", Value: step.ID}}}
+			}
+			switch step.Outcome {
+			case "failure":
+				// The step's output explains the failure better than the exit status alone
+				testCase.Failure = &junitMessage{Message: step.Message, Text: step.Output}
+				suite.Failures++
+			case "skipped":
+				testCase.Skipped = &junitMessage{Message: step.Message}
+				suite.Skipped++
+			default:
+				testCase.SystemOut = step.Output
+			}
+			suite.Cases = append(suite.Cases, testCase)
+			elapsed += step.Duration
+		}
+		suite.Tests = len(job.Steps)
+		suite.Time = junitTime(elapsed)
+
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		total += elapsed
+	}
+	suites.Time = junitTime(total)
+	return suites
+}
+
+// formatJUnit writes the report as JUnit XML for CI dashboards
+func formatJUnit(w io.Writer, report *Report) error {
+	data, err := xml.MarshalIndent(junitReport(report), "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,88 @@
+package reporting
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// resultIcons mark job and step results in the Markdown summary
+var resultIcons = map[string]string{
+	"success":   "✅",
+	"failure":   "❌",
+	"skipped":   "⏭️",
+	"cancelled": "🚫",
+}
+
+// formatMarkdown writes the report as a summary that reads well on GitHub, e.g. as a pull
+// request comment or in $GITHUB_STEP_SUMMARY
+func formatMarkdown(w io.Writer, report *Report) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s %s\n\n", resultIcon(report.Result), markdownText(report.Workflow))
+	fmt.Fprintf(&b, "**Result:** %s", report.Result)
+	if report.RunNumber != "" {
+		fmt.Fprintf(&b, " · **Run:** #%s", report.RunNumber)
+	}
+	if report.Event != "" {
+		fmt.Fprintf(&b, " · **Event:** %s", report.Event)
+	}
+	fmt.Fprintf(&b, " · **Duration:** %s\n", markdownDuration(report.Duration))
+	if report.Error != "" {
+		fmt.Fprintf(&b, "\n> %s\n", markdownText(report.Error))
+	}
+
+	b.WriteString("\n## Jobs\n\n| Job | Result | Duration |\n|-----|--------|----------|\n")
+	for _, job := range report.Jobs {
+		fmt.Fprintf(&b, "| %s | %s %s | %s |\n", markdownCell(job.Name), resultIcon(job.Result), job.Result, markdownDuration(job.Duration))
+	}
+
+	for _, job := range report.Jobs {
+		if len(job.Steps) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n| Step | Id | Outcome | Conclusion | Duration |\n|------|----|---------|------------|----------|\n", markdownText(job.Name))
+		for _, step := range job.Steps {
+			fmt.Fprintf(&b, "| %s | %s | %s %s | %s | %s |\n",
+				markdownCell(step.DisplayName()), markdownCell(step.ID),
+				resultIcon(step.Outcome), step.Outcome, step.Conclusion, markdownDuration(step.Duration))
+		}
+		if job.Error != "" {
+			fmt.Fprintf(&b, "\n> %s\n", markdownText(job.Error))
+		}
+	}
+
+	if len(report.ToleratedFailures) > 0 {
+		b.WriteString("\n## Tolerated failures (continue-on-error)\n\n")
+		for _, failure := range report.ToleratedFailures {
+			fmt.Fprintf(&b, "- %s\n", markdownText(failure))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// resultIcon returns the icon for a result, or nothing for results without one
+func resultIcon(result string) string {
+	return resultIcons[result]
+}
+
+// markdownText puts text on a single line, since errors can span several
+func markdownText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// markdownCell makes text safe for a table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(markdownText(text), "|", "\\|")
+}
+
+// markdownDuration rounds a duration for display, e.g. 1m3.2s
+func markdownDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,152 @@
+// Package reporting serializes the results of a workflow run. A Report is
+// written by the Formatter registered for the extension of the file it goes
+// to, so supporting another format only takes registering a Formatter.
+package reporting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report is the outcome of a workflow run
+type Report struct {
+	Workflow  string        `json:"workflow"`
+	RunID     string        `json:"runId,omitempty"`
+	RunNumber string        `json:"runNumber,omitempty"`
+	Event     string        `json:"event,omitempty"`
+	Result    string        `json:"result"`
+	Error     string        `json:"error,omitempty"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"-"`
+	Jobs      []Job         `json:"jobs"`
+	// ToleratedFailures lists the job and step failures continue-on-error let pass
+	ToleratedFailures []string `json:"toleratedFailures,omitempty"`
+}
+
+// Job is the outcome of a job; jobs that were skipped or cancelled before they
+// started have no steps
+type Job struct {
+	Name     string            `json:"name"`
+	Result   string            `json:"result"`
+	Error    string            `json:"error,omitempty"`
+	Duration time.Duration     `json:"-"`
+	Outputs  map[string]string `json:"outputs,omitempty"`
+	Steps    []Step            `json:"steps"`
+	// Ran is set for jobs that started running steps, even if they have none
+	Ran bool `json:"-"`
+}
+
+// Step is the outcome of a step. Outcome is the step's own result and
+// Conclusion the result after continue-on-error.
+type Step struct {
+	Number     int           `json:"number"`
+	ID         string        `json:"id,omitempty"`
+	Name       string        `json:"name"`
+	Outcome    string        `json:"outcome"`
+	Conclusion string        `json:"conclusion"`
+	Duration   time.Duration `json:"-"`
+	// Message says why the step failed or was skipped
+	Message string `json:"message,omitempty"`
+	// Output is the end of the step's output, already masked
+	Output string `json:"output,omitempty"`
+}
+
+// DisplayName names the step the way a run prints it, "Step <n>: <name>"
+func (s Step) DisplayName() string {
+	if s.Name == "" {
+		return fmt.Sprintf("Step %d", s.Number)
+	}
+	return fmt.Sprintf("Step %d: %s", s.Number, s.Name)
+}
+
+// Formatter writes a report in one format
+type Formatter interface {
+	Format(w io.Writer, report *Report) error
+}
+
+// FormatterFunc adapts a function to a Formatter
+type FormatterFunc func(w io.Writer, report *Report) error
+
+// Format calls f
+func (f FormatterFunc) Format(w io.Writer, report *Report) error {
+	return f(w, report)
+}
+
+// The built-in formats
+var (
+	JSON     Formatter = FormatterFunc(formatJSON)
+	Markdown Formatter = FormatterFunc(formatMarkdown)
+	JUnit    Formatter = FormatterFunc(formatJUnit)
+)
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		".json": JSON,
+		".md":   Markdown,
+		".xml":  JUnit,
+	}
+)
+
+// Register makes a formatter available for files with the given extension,
+// such as ".html", replacing any formatter registered for it before
+func Register(ext string, formatter Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[strings.ToLower(ext)] = formatter
+}
+
+// Extensions returns the extensions formatters are registered for, in order
+func Extensions() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	exts := make([]string, 0, len(formatters))
+	for ext := range formatters {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// FormatterFor returns the formatter for a path's extension
+func FormatterFor(path string) (Formatter, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	formattersMu.RLock()
+	formatter, ok := formatters[ext]
+	formattersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no report format for %q (supported extensions: %s)", path, strings.Join(Extensions(), ", "))
+	}
+	return formatter, nil
+}
+
+// WriteFile writes the report to path in the format its extension selects
+func WriteFile(path string, report *Report) error {
+	formatter, err := FormatterFor(path)
+	if err != nil {
+		return err
+	}
+	return Write(path, formatter, report)
+}
+
+// Write writes the report to path in the given format. The file is only
+// replaced once the report was formatted completely.
+func Write(path string, formatter Formatter, report *Report) error {
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, report); err != nil {
+		return fmt.Errorf("failed to format report: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package reporting
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testReport is a run with a failed job, a job whose failure was tolerated and a skipped job
+func testReport() *Report {
+	return &Report{
+		Workflow:  "CI <main>",
+		RunNumber: "7",
+		Event:     "push",
+		Result:    "failure",
+		Error:     "job test failed:\n  exit status 1",
+		Duration:  1500 * time.Millisecond,
+		Jobs: []Job{
+			{
+				Name:     "build",
+				Result:   "success",
+				Duration: time.Second,
+				Outputs:  map[string]string{"version": "1.2.3"},
+				Ran:      true,
+				Steps: []Step{
+					{Number: 1, ID: "compile", Name: "make > build.log", Outcome: "success", Conclusion: "success", Duration: time.Second, Output: "ok\n"},
+					{Number: 2, Name: "lint | tee", Outcome: "failure", Conclusion: "success", Message: "exit status 2"},
+				},
+			},
+			{
+				Name:     "test",
+				Result:   "failure",
+				Error:    "step 2: exit status 1",
+				Duration: 500 * time.Millisecond,
+				Ran:      true,
+				Steps: []Step{
+					{Number: 1, Outcome: "skipped", Conclusion: "skipped", Message: "if: false"},
+					{Number: 2, Name: "go test", Outcome: "failure", Conclusion: "failure", Duration: 500 * time.Millisecond, Message: "exit status 1", Output: "FAIL\n"},
+				},
+			},
+			{Name: "deploy", Result: "skipped", Steps: []Step{}},
+		},
+		ToleratedFailures: []string{"job build, step 2 (lint | tee): exit status 2"},
+	}
+}
+
+func TestFormatterFor(t *testing.T) {
+	tests := []struct {
+		path string
+		want Formatter
+	}{
+		{"report.json", JSON},
+		{"out/summary.md", Markdown},
+		{"results.xml", JUnit},
+		{"RESULTS.XML", JUnit},
+		{"report.v2.json", JSON},
+	}
+	for _, tt := range tests {
+		got, err := FormatterFor(tt.path)
+		if err != nil {
+			t.Errorf("FormatterFor(%q) error = %v", tt.path, err)
+			continue
+		}
+		if reflect.ValueOf(got).Pointer() != reflect.ValueOf(tt.want).Pointer() {
+			t.Errorf("FormatterFor(%q) returned the wrong formatter", tt.path)
+		}
+	}
+
+	for _, path := range []string{"report.html", "report", "json"} {
+		_, err := FormatterFor(path)
+		if err == nil || !strings.Contains(err.Error(), "supported extensions: .json, .md, .xml") {
+			t.Errorf("FormatterFor(%q) error = %v, want one listing the supported extensions", path, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		formattersMu.Lock()
+		delete(formatters, ".txt")
+		formattersMu.Unlock()
+	})
+
+	text := FormatterFunc(func(w io.Writer, report *Report) error {
+		_, err := io.WriteString(w, report.Workflow+": "+report.Result+"\n")
+		return err
+	})
+	Register(".TXT", text)
+
+	if got, want := Extensions(), []string{".json", ".md", ".txt", ".xml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Extensions() = %v, want %v", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := WriteFile(path, testReport()); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "CI <main>: failure\n"; got != want {
+		t.Errorf("report = %q, want %q", got, want)
+	}
+}
+
+func TestWriteFileUnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := WriteFile(path, testReport()); err == nil {
+		t.Fatal("WriteFile() succeeded for an unknown extension")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("WriteFile() created %s for an unknown extension", path)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	var b strings.Builder
+	if err := JSON.Format(&b, testReport()); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	out := b.String()
+
+	// Names are kept readable instead of being escaped for HTML
+	for _, want := range []string{`"workflow": "CI <main>"`, `"name": "make > build.log"`, `"durationSeconds": 1.5`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("JSON report doesn't contain %s:\n%s", want, out)
+		}
+	}
+
+	var decoded struct {
+		Result          string  `json:"result"`
+		DurationSeconds float64 `json:"durationSeconds"`
+		Jobs            []struct {
+			Name            string            `json:"name"`
+			Error           string            `json:"error"`
+			Outputs         map[string]string `json:"outputs"`
+			DurationSeconds float64           `json:"durationSeconds"`
+			Steps           []struct {
+				Number          int     `json:"number"`
+				ID              string  `json:"id"`
+				Outcome         string  `json:"outcome"`
+				Conclusion      string  `json:"conclusion"`
+				DurationSeconds float64 `json:"durationSeconds"`
+			} `json:"steps"`
+		} `json:"jobs"`
+		ToleratedFailures []string `json:"toleratedFailures"`
+	}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("JSON report doesn't decode: %v", err)
+	}
+	if decoded.Result != "failure" || len(decoded.Jobs) != 3 || len(decoded.ToleratedFailures) != 1 {
+		t.Errorf("decoded report = %+v", decoded)
+	}
+	build := decoded.Jobs[0]
+	if build.Outputs["version"] != "1.2.3" || build.DurationSeconds != 1 || build.Steps[0].ID != "compile" {
+		t.Errorf("decoded build job = %+v", build)
+	}
+	if lint := build.Steps[1]; lint.Outcome != "failure" || lint.Conclusion != "success" {
+		t.Errorf("decoded lint step = %+v, want outcome failure and conclusion success", lint)
+	}
+	if decoded.Jobs[2].Steps == nil {
+		t.Error("a job without steps has no steps list, want an empty one")
+	}
+}
+
+func TestFormatMarkdown(t *testing.T) {
+	var b strings.Builder
+	if err := Markdown.Format(&b, testReport()); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# ❌ CI <main>\n",
+		"**Result:** failure · **Run:** #7 · **Event:** push · **Duration:** 1.5s\n",
+		// Multiline errors stay on one line of the quote
+		"> job test failed: exit status 1\n",
+		"| build | ✅ success | 1s |\n",
+		"| deploy | ⏭️ skipped | 0s |\n",
+		"| Step 1: make > build.log | compile | ✅ success | success | 1s |\n",
+		// Pipes in cells are escaped so they don't split the table
+		"| Step 2: lint \\| tee |  | ❌ failure | success | 0s |\n",
+		"| Step 1 |  | ⏭️ skipped | skipped | 0s |\n",
+		"> step 2: exit status 1\n",
+		"## Tolerated failures (continue-on-error)\n\n- job build, step 2 (lint | tee): exit status 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Markdown report doesn't contain %q:\n%s", want, out)
+		}
+	}
+	// Jobs without steps get no steps table
+	if strings.Contains(out, "### deploy") {
+		t.Errorf("Markdown report has a steps table for a job without steps:\n%s", out)
+	}
+}
+
+func TestFormatJUnit(t *testing.T) {
+	var b strings.Builder
+	if err := JUnit.Format(&b, testReport()); err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	out := b.String()
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Errorf("JUnit report doesn't start with the XML header:\n%s", out)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &suites); err != nil {
+		t.Fatalf("JUnit report doesn't decode: %v", err)
+	}
+	// Jobs that never ran get no test suite
+	if suites.Name != "CI <main>" || len(suites.Suites) != 2 || suites.Tests != 4 || suites.Failures != 2 || suites.Skipped != 1 || suites.Time != "1.500" {
+		t.Errorf("testsuites = name %q, %d suites, tests %d, failures %d, skipped %d, time %s",
+			suites.Name, len(suites.Suites), suites.Tests, suites.Failures, suites.Skipped, suites.Time)
+	}
+	if got := JUnitTests(testReport()); got != 4 {
+		t.Errorf("JUnitTests() = %d, want 4", got)
+	}
+
+	build := suites.Suites[0]
+	compile, lint := build.Cases[0], build.Cases[1]
+	if compile.ClassName != "build" || compile.Time != "1.000" || compile.SystemOut != "ok\n" || compile.Failure != nil {
+		t.Errorf("compile test case = %+v", compile)
+	}
+	if compile.Properties == nil || compile.Properties.Properties[0] != (junitProperty{Name: "id", Value: "compile"}) {
+		t.Errorf("compile test case properties = %+v, want the step id", compile.Properties)
+	}
+	// A failure continue-on-error tolerated still fails its test case
+	if lint.Failure == nil || lint.Failure.Message != "exit status 2" || lint.Properties != nil {
+		t.Errorf("lint test case = %+v, want a failure without properties", lint)
+	}
+
+	test := suites.Suites[1]
+	if skipped := test.Cases[0]; skipped.Skipped == nil || skipped.Skipped.Message != "if: false" {
+		t.Errorf("skipped test case = %+v", skipped)
+	}
+	if failed := test.Cases[1]; failed.Failure == nil || failed.Failure.Text != "FAIL\n" {
+		t.Errorf("failed test case = %+v, want the step output as the failure text", failed)
+	}
+}